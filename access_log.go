@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessLogFormatter 与gin默认的访问日志格式相同，查询参数中的令牌替换为******
+func accessLogFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		maskQueryToken(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// maskQueryToken 隐藏路径中token查询参数的值，其他参数保持原样
+func maskQueryToken(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		// 参数名可能经过转义，如tok%65n
+		if unescaped, err := url.QueryUnescape(name); err == nil && unescaped == "token" {
+			params[i] = "token=" + maskedSecret
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
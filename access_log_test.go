@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestMaskQueryToken(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/capture/current", "/capture/current"},
+		{"/ws/capture?token=abc", "/ws/capture?token=******"},
+		{"/sse/capture?task_id=t1&token=abc&x=%20", "/sse/capture?task_id=t1&token=******&x=%20"},
+		{"/ws/capture?tok%65n=abc", "/ws/capture?token=******"},
+		{"/ws/capture?token", "/ws/capture?token=******"},
+		{"/ws/capture?tokens=abc", "/ws/capture?tokens=abc"},
+	}
+	for _, tt := range tests {
+		if got := maskQueryToken(tt.path); got != tt.want {
+			t.Errorf("maskQueryToken(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"abc/a/util"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志文件，每行一条JSON记录，只追加不修改，可通过配置的audit.log_file修改
+var auditLogPath = "data/audit.log"
+
+const (
+	// 查询审计日志默认和最多返回的记录数
+	defaultAuditQueryLimit = 100
+	maxAuditQueryLimit     = 1000
+	// 查询时单条审计记录的最大长度
+	maxAuditLineSize = 1 << 20
+)
+
+// 审计的操作类型
+const (
+	auditActionStart  = "start"  // 启动抓包或快照任务
+	auditActionStop   = "stop"   // 手动或自动停止任务
+	auditActionExport = "export" // 导出全部结果或下载请求内容
+	auditActionReplay = "replay" // WebSocket或SSE补发历史数据包
+	auditActionDelete = "delete" // 清空结果，删除计划任务、触发器、描述符或预触发缓冲
+	auditActionCreate = "create" // 创建计划任务或触发器
+	auditActionUpdate = "update" // 修改计划任务或触发器
+)
+
+// 自动操作的执行者
+const (
+	auditUserSystem = "system"
+)
+
+// 一条审计记录
+type AuditEntry struct {
+	Time      time.Time        `json:"time"`
+	Action    string           `json:"action"`
+	User      string           `json:"user"` // 认证的用户或令牌名称，未启用认证时为anonymous，自动操作为system或计划任务、触发器
+	Role      string           `json:"role,omitempty"`
+	ClientIP  string           `json:"client_ip,omitempty"`     // 连接的对端地址
+	Forwarded string           `json:"forwarded_for,omitempty"` // 请求中的X-Forwarded-For，只作参考，不可信
+	TaskID    string           `json:"task_id,omitempty"`
+	Target    string           `json:"target,omitempty"` // 操作的对象，如schedule:<ID>、seq:<序号>
+	Config    *CaptureConfig   `json:"config,omitempty"` // 启动任务时使用的抓包配置
+	Counts    map[string]int64 `json:"counts,omitempty"` // 数据包数量、字节数等
+	Detail    string           `json:"detail,omitempty"` // 停止原因等补充说明
+	Error     string           `json:"error,omitempty"`  // 操作失败的原因
+}
+
+// 操作的执行者
+type auditActor struct {
+	User      string
+	Role      string
+	ClientIP  string
+	Forwarded string
+}
+
+// 审计日志文件，写入由mutex串行化
+var auditLog = struct {
+	mutex sync.Mutex
+	file  *os.File
+}{}
+
+// actorFromContext 返回HTTP请求的执行者，IP取连接的对端地址，X-Forwarded-For可以伪造，单独记录
+func actorFromContext(c *gin.Context) auditActor {
+	actor := identityActor(requestIdentity(c), c.RemoteIP())
+	actor.Forwarded = c.GetHeader("X-Forwarded-For")
+	return actor
+}
+
+// identityActor 返回认证身份对应的执行者
+func identityActor(identity authIdentity, clientIP string) auditActor {
+	return auditActor{User: identity.Name, Role: identity.Role, ClientIP: clientIP}
+}
+
+// originActor 返回任务来源对应的执行者，手动启动时为请求的用户，计划任务和触发器以其名称记录
+func originActor(origin taskOrigin, requestIP string) auditActor {
+	if origin.User != "" {
+		return auditActor{User: origin.User, Role: origin.Role, ClientIP: requestIP}
+	}
+	if origin.ID != "" {
+		return auditActor{User: origin.Type + ":" + origin.ID}
+	}
+	return auditActor{User: auditUserSystem, ClientIP: requestIP}
+}
+
+// recordAudit 追加一条审计记录，写入失败时只记录错误日志，不影响操作本身
+func recordAudit(actor auditActor, entry AuditEntry) {
+	entry.Time = time.Now()
+	entry.User = actor.User
+	entry.Role = actor.Role
+	entry.ClientIP = actor.ClientIP
+	entry.Forwarded = actor.Forwarded
+	data, err := json.Marshal(entry)
+	if err != nil {
+		util.Log.Logger.Error("审计记录序列化失败: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	auditLog.mutex.Lock()
+	defer auditLog.mutex.Unlock()
+	if auditLog.file == nil {
+		if err := os.MkdirAll(filepath.Dir(auditLogPath), 0755); err != nil {
+			util.Log.Logger.Error("创建审计日志目录失败: %v", err)
+			return
+		}
+		// 只追加写入，其他用户不能读取
+		file, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			util.Log.Logger.Error("打开审计日志失败: %v", err)
+			return
+		}
+		auditLog.file = file
+	}
+	if _, err := auditLog.file.Write(data); err != nil {
+		util.Log.Logger.Error("写入审计日志失败: %v", err)
+		return
+	}
+	if err := auditLog.file.Sync(); err != nil {
+		util.Log.Logger.Error("同步审计日志失败: %v", err)
+	}
+}
+
+// recordReplay 记录补发的历史数据包，没有补发时不记录
+func recordReplay(actor auditActor, channel, taskID string, replayed int) {
+	if replayed == 0 {
+		return
+	}
+	recordAudit(actor, AuditEntry{Action: auditActionReplay, TaskID: taskID, Target: channel, Counts: map[string]int64{"packets": int64(replayed)}})
+}
+
+// auditError 返回操作失败的原因，成功时为空
+func auditError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// taskCounts 返回审计记录中任务的数据包计数
+func taskCounts(task *captureTask) map[string]int64 {
+	task.packetsMu.Lock()
+	stored := len(task.packets)
+	task.packetsMu.Unlock()
+	return map[string]int64{
+		"stored_packets":   int64(stored),
+		"matched_requests": task.matchedRequests.Load(),
+		"captured_bytes":   task.capturedBytes.Load(),
+		"packets_seen":     task.counters.seen.Load(),
+	}
+}
+
+// 审计日志查询条件
+type auditQuery struct {
+	Action string    `form:"action"`
+	User   string    `form:"user"`
+	TaskID string    `form:"task_id"`
+	Since  time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until  time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int       `form:"limit"`
+}
+
+// matches 判断记录是否满足所有非空的查询条件
+func (query auditQuery) matches(entry AuditEntry) bool {
+	return (query.Action == "" || entry.Action == query.Action) &&
+		(query.User == "" || entry.User == query.User) &&
+		(query.TaskID == "" || entry.TaskID == query.TaskID) &&
+		(query.Since.IsZero() || !entry.Time.Before(query.Since)) &&
+		(query.Until.IsZero() || entry.Time.Before(query.Until))
+}
+
+// GetAuditLog 按条件查询审计日志，最新的记录在前
+func GetAuditLog(c *gin.Context) {
+	var query auditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultAuditQueryLimit
+	}
+	if query.Limit > maxAuditQueryLimit {
+		query.Limit = maxAuditQueryLimit
+	}
+
+	entries, total, err := readAuditLog(query)
+	if err != nil {
+		util.Log.Logger.Error("读取审计日志失败: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取审计日志失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"count":   len(entries),
+		"matched": total,
+	})
+}
+
+// readAuditLog 读取满足条件的记录，返回最新的limit条和满足条件的总数
+func readAuditLog(query auditQuery) ([]AuditEntry, int, error) {
+	entries := make([]AuditEntry, 0)
+	file, err := os.Open(auditLogPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	total := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), maxAuditLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			util.Log.Logger.Warn("审计日志第%d行无法解析: %v", line, err)
+			continue
+		}
+		if !query.matches(entry) {
+			continue
+		}
+		total++
+		entries = append(entries, entry)
+		// 只保留最新的limit条
+		if len(entries) > query.Limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"abc/a/util"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 静态API令牌和WebSocket来源白名单，与配置文件的auth合并
+	authConfigPath = "data/auth.json"
+	// 登录令牌的有效期
+	sessionTTL = 12 * time.Hour
+	// gin.Context中保存当前身份的键
+	identityContextKey = "auth_identity"
+)
+
+// 角色，权限依次增加：viewer只能查看结果，operator可以启动和停止抓包，admin可以管理计划任务、触发器等设置
+const (
+	roleViewer   = "viewer"
+	roleOperator = "operator"
+	roleAdmin    = "admin"
+)
+
+var roleLevels = map[string]int{roleViewer: 1, roleOperator: 2, roleAdmin: 3}
+
+// 本地用户文件，密码以bcrypt保存，由配置的auth.users_file设置，启动后只读
+var authUsersPath = "data/users.json"
+
+// 认证配置，来自data/auth.json和配置文件的auth
+type authConfig struct {
+	Tokens         []staticToken `json:"tokens" yaml:"tokens" toml:"tokens"`
+	AllowedOrigins []string      `json:"allowed_origins" yaml:"allowed_origins" toml:"allowed_origins"` // 允许连接WebSocket的Origin，如"https://capture.example.com"，"*"表示全部
+	UsersFile      string        `json:"users_file,omitempty" yaml:"users_file" toml:"users_file"`      // 本地用户文件，只在配置文件中有效
+}
+
+// 静态API令牌，用于脚本和CI
+type staticToken struct {
+	Name  string `json:"name" yaml:"name" toml:"name"`
+	Token string `json:"token" yaml:"token" toml:"token"`
+	Role  string `json:"role" yaml:"role" toml:"role"`
+}
+
+// 本地用户
+type authUser struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Role         string `json:"role"`
+}
+
+// 请求的身份
+type authIdentity struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	Kind string `json:"kind"` // token、user，未启用认证时为anonymous
+}
+
+// 登录后发放的令牌
+type authSession struct {
+	identity  authIdentity
+	expiresAt time.Time
+}
+
+// 认证状态，令牌和会话以SHA-256摘要为键，避免按原文比较
+var auth = struct {
+	mutex          sync.RWMutex
+	tokens         map[[sha256.Size]byte]authIdentity
+	users          map[string]authUser
+	sessions       map[[sha256.Size]byte]authSession
+	allowedOrigins []string
+}{
+	tokens:   make(map[[sha256.Size]byte]authIdentity),
+	users:    make(map[string]authUser),
+	sessions: make(map[[sha256.Size]byte]authSession),
+}
+
+// 未启用认证时的身份，拥有全部权限
+var anonymousIdentity = authIdentity{Name: "anonymous", Role: roleAdmin, Kind: "anonymous"}
+
+// LoadAuthConfig 启动时加载静态令牌和本地用户，两者都没有配置时不启用认证。
+// data/auth.json和配置文件auth中的令牌与来源白名单合并使用
+func LoadAuthConfig() {
+	var config authConfig
+	if err := readJSONFile(authConfigPath, &config); err != nil {
+		util.Log.Logger.Fatal("读取认证配置失败: %v, 文件: %s", err, authConfigPath)
+	}
+	config.Tokens = append(config.Tokens, appConfig.Auth.Tokens...)
+	config.AllowedOrigins = append(config.AllowedOrigins, appConfig.Auth.AllowedOrigins...)
+	users, err := loadAuthUsers()
+	if err != nil {
+		util.Log.Logger.Fatal("读取用户文件失败: %v, 文件: %s", err, authUsersPath)
+	}
+
+	tokens := make(map[[sha256.Size]byte]authIdentity)
+	for i, token := range config.Tokens {
+		if token.Token == "" {
+			util.Log.Logger.Fatal("认证配置中第%d个令牌为空", i+1)
+		}
+		if _, ok := roleLevels[token.Role]; !ok {
+			util.Log.Logger.Fatal("令牌 %s 的角色无效: %s", token.Name, token.Role)
+		}
+		tokens[sha256.Sum256([]byte(token.Token))] = authIdentity{Name: token.Name, Role: token.Role, Kind: "token"}
+	}
+
+	auth.mutex.Lock()
+	auth.tokens = tokens
+	auth.users = users
+	auth.allowedOrigins = config.AllowedOrigins
+	auth.mutex.Unlock()
+
+	if len(tokens) == 0 && len(users) == 0 {
+		warnAnonymousAccess(appConfig.Listen)
+		return
+	}
+	util.Log.Logger.Info("已启用API认证，令牌: %d, 用户: %d", len(tokens), len(users))
+}
+
+// warnAnonymousAccess 未启用认证时输出警告，监听地址不只是本机时所有人都以admin身份访问，用错误级别提示
+func warnAnonymousAccess(listen string) {
+	host, _, _ := net.SplitHostPort(listen)
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		util.Log.Logger.Warn("未配置API令牌或用户，所有接口无需认证即可访问，只监听本机地址: %s", listen)
+		return
+	}
+	util.Log.Logger.Error("========================================================================")
+	util.Log.Logger.Error("未配置API令牌或用户，监听地址 %s 可从其他主机访问，任何人都能以admin身份抓包和下载结果", listen)
+	util.Log.Logger.Error("请在data/auth.json或配置文件的auth中添加令牌、使用user子命令添加用户，或通过-listen 127.0.0.1:8081只监听本机")
+	util.Log.Logger.Error("========================================================================")
+}
+
+// readJSONFile 读取JSON文件，文件不存在时保持target不变
+func readJSONFile(path string, target interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// loadAuthUsers 读取本地用户文件
+func loadAuthUsers() (map[string]authUser, error) {
+	var list []authUser
+	if err := readJSONFile(authUsersPath, &list); err != nil {
+		return nil, err
+	}
+	users := make(map[string]authUser, len(list))
+	for _, user := range list {
+		if _, ok := roleLevels[user.Role]; !ok {
+			return nil, fmt.Errorf("用户 %s 的角色无效: %s", user.Username, user.Role)
+		}
+		users[user.Username] = user
+	}
+	return users, nil
+}
+
+// saveAuthUsers 按用户名排序写入用户文件，先写临时文件再重命名，只有当前用户可以读取
+func saveAuthUsers(users map[string]authUser) error {
+	list := make([]authUser, 0, len(users))
+	for _, user := range users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(authUsersPath), 0755); err != nil {
+		return err
+	}
+	tmpPath := authUsersPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, authUsersPath)
+}
+
+// authEnabled 是否配置了令牌或用户
+func authEnabled() bool {
+	auth.mutex.RLock()
+	defer auth.mutex.RUnlock()
+	return len(auth.tokens) > 0 || len(auth.users) > 0
+}
+
+// 可以通过token查询参数传递令牌的路由：浏览器的WebSocket和EventSource无法设置请求头。
+// 其他接口只接受请求头，避免令牌出现在链接、浏览器历史和代理日志中
+var queryTokenRoutes = map[string]bool{
+	"/ws/capture":  true,
+	"/sse/capture": true,
+}
+
+// requestToken 从Authorization: Bearer请求头读取令牌，WebSocket和SSE连接也可以使用token查询参数
+func requestToken(c *gin.Context) string {
+	if scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	if queryTokenRoutes[c.FullPath()] {
+		return c.Query("token")
+	}
+	return ""
+}
+
+// lookupIdentity 查找令牌对应的身份，依次查找静态令牌和未过期的登录令牌
+func lookupIdentity(token string) (authIdentity, bool) {
+	if token == "" {
+		return authIdentity{}, false
+	}
+	key := sha256.Sum256([]byte(token))
+
+	auth.mutex.RLock()
+	defer auth.mutex.RUnlock()
+	if identity, ok := auth.tokens[key]; ok {
+		return identity, true
+	}
+	if session, ok := auth.sessions[key]; ok && time.Now().Before(session.expiresAt) {
+		return session.identity, true
+	}
+	return authIdentity{}, false
+}
+
+// requireRole 返回检查角色的中间件，未启用认证时所有请求都以anonymous身份通过
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authEnabled() {
+			c.Set(identityContextKey, anonymousIdentity)
+			c.Next()
+			return
+		}
+
+		identity, ok := lookupIdentity(requestToken(c))
+		if !ok {
+			util.Log.Logger.Warn("未认证的请求: %s %s, IP: %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未认证或令牌已失效"})
+			return
+		}
+		if !roleAllows(identity.Role, role) {
+			util.Log.Logger.Warn("权限不足: %s %s, 用户: %s, 角色: %s, IP: %s", c.Request.Method, c.Request.URL.Path, identity.Name, identity.Role, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "需要" + role + "角色"})
+			return
+		}
+		c.Set(identityContextKey, identity)
+		c.Next()
+	}
+}
+
+// roleAllows 判断角色是否具有required角色的权限
+func roleAllows(role, required string) bool {
+	return roleLevels[role] >= roleLevels[required]
+}
+
+// requestIdentity 返回中间件保存的身份
+func requestIdentity(c *gin.Context) authIdentity {
+	if value, ok := c.Get(identityContextKey); ok {
+		return value.(authIdentity)
+	}
+	return anonymousIdentity
+}
+
+// newSession 为登录成功的用户生成随机令牌，同时清理已过期的令牌
+func newSession(identity authIdentity) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(buf)
+	expiresAt := time.Now().Add(sessionTTL)
+
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+	now := time.Now()
+	for key, session := range auth.sessions {
+		if now.After(session.expiresAt) {
+			delete(auth.sessions, key)
+		}
+	}
+	auth.sessions[sha256.Sum256([]byte(token))] = authSession{identity: identity, expiresAt: expiresAt}
+	return token, expiresAt, nil
+}
+
+// checkWebSocketOrigin 检查WebSocket握手的Origin：没有Origin（非浏览器客户端）或与请求的Host相同时允许，
+// 其他来源需要在allowed_origins中
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	auth.mutex.RLock()
+	defer auth.mutex.RUnlock()
+	for _, allowed := range auth.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	util.Log.Logger.Warn("拒绝WebSocket连接，来源不在白名单中: %s, 地址: %s", origin, r.RemoteAddr)
+	return false
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"abc/a/util"
+	"bufio"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 用户不存在时用于比较的bcrypt摘要，与默认cost相同
+const missingUserPasswordHash = "$2a$10$uVuTGuAs6J0828Vbq9IvH.ObqEy9cN5gUkB8jJCM6emWl1ja//2GG"
+
+// 登录请求
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Login 用本地用户的用户名和密码登录，返回有效期为12小时的令牌
+func Login(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	auth.mutex.RLock()
+	user, ok := auth.users[req.Username]
+	auth.mutex.RUnlock()
+	passwordHash := user.PasswordHash
+	if !ok {
+		// 用户不存在时同样比较一次密码，避免通过响应时间判断用户是否存在
+		passwordHash = missingUserPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)) != nil || !ok {
+		util.Log.Logger.Warn("登录失败，用户: %s, IP: %s", req.Username, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		return
+	}
+
+	identity := authIdentity{Name: user.Username, Role: user.Role, Kind: "user"}
+	token, expiresAt, err := newSession(identity)
+	if err != nil {
+		util.Log.Logger.Error("生成登录令牌失败: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成登录令牌失败"})
+		return
+	}
+	util.Log.Logger.Info("用户登录: %s, 角色: %s, IP: %s", user.Username, user.Role, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_at": expiresAt, "identity": identity})
+}
+
+// Logout 使当前的登录令牌失效，静态令牌不受影响
+func Logout(c *gin.Context) {
+	key := sha256.Sum256([]byte(requestToken(c)))
+	auth.mutex.Lock()
+	delete(auth.sessions, key)
+	auth.mutex.Unlock()
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
+// GetCurrentIdentity 返回当前请求的身份以及是否启用了认证
+func GetCurrentIdentity(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"auth_enabled": authEnabled(),
+		"identity":     requestIdentity(c),
+	})
+}
+
+// runUserCommand 管理本地用户文件：
+// packet-capture-tool user -add <用户名> -role <角色>，密码从标准输入读取；
+// packet-capture-tool user -delete <用户名>；packet-capture-tool user -list。
+// 服务运行中修改用户文件后需要重启才会生效
+func runUserCommand(args []string) {
+	flags := flag.NewFlagSet("user", flag.ExitOnError)
+	add := flags.String("add", "", "添加或修改用户，密码从标准输入读取")
+	role := flags.String("role", roleViewer, "用户角色：viewer、operator或admin")
+	remove := flags.String("delete", "", "删除用户")
+	list := flags.Bool("list", false, "列出用户")
+	flags.Parse(args)
+
+	users, err := loadAuthUsers()
+	if err != nil {
+		util.Log.Logger.Fatal("读取用户文件失败: %v, 文件: %s", err, authUsersPath)
+	}
+
+	switch {
+	case *add != "":
+		if _, ok := roleLevels[*role]; !ok {
+			util.Log.Logger.Fatal("无效的角色: %s", *role)
+		}
+		fmt.Fprint(os.Stderr, "输入密码: ")
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		password = strings.TrimRight(password, "\r\n")
+		if password == "" {
+			util.Log.Logger.Fatal("密码不能为空: %v", err)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			util.Log.Logger.Fatal("生成密码摘要失败: %v", err)
+		}
+		users[*add] = authUser{Username: *add, PasswordHash: string(hash), Role: *role}
+		if err := saveAuthUsers(users); err != nil {
+			util.Log.Logger.Fatal("保存用户文件失败: %v", err)
+		}
+		fmt.Printf("已保存用户 %s，角色: %s\n", *add, *role)
+	case *remove != "":
+		if _, ok := users[*remove]; !ok {
+			util.Log.Logger.Fatal("用户不存在: %s", *remove)
+		}
+		delete(users, *remove)
+		if err := saveAuthUsers(users); err != nil {
+			util.Log.Logger.Fatal("保存用户文件失败: %v", err)
+		}
+		fmt.Printf("已删除用户 %s\n", *remove)
+	case *list:
+		names := make([]string, 0, len(users))
+		for name := range users {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s\t%s\n", name, users[name].Role)
+		}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
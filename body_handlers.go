@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+)
+
+// 十六进制转储一次最多输出的字节数
+const maxHexdumpLength = 1 << 20
+
+// findRequestedPacket 按task_id和seq查询参数查找数据包，找不到时返回错误响应
+func findRequestedPacket(c *gin.Context) (*captureTask, PacketInfo, bool) {
+	task := findTask(c.Query("task_id"))
+	if task == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有正在运行的抓包任务"})
+		return nil, PacketInfo{}, false
+	}
+	seq, err := strconv.ParseUint(c.Query("seq"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "seq必须为数据包序号"})
+		return nil, PacketInfo{}, false
+	}
+	packet, ok := task.findPacket(seq)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "数据包不存在"})
+		return nil, PacketInfo{}, false
+	}
+	return task, packet, true
+}
+
+// requestedBodyBytes 返回请求的内容，decoded=false时返回原始内容，默认返回解码后的内容。
+// 请求没有内容时返回错误响应
+func requestedBodyBytes(c *gin.Context, packet PacketInfo) ([]byte, bool) {
+	if packet.Body == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该请求没有内容"})
+		return nil, false
+	}
+	if c.Query("decoded") == "false" {
+		return packet.Body.rawContent(), true
+	}
+	return packet.Body.content(), true
+}
+
+// GetPacketBody 返回任务中一个请求的解析结果，指定jsonpath时同时返回查询结果
+func GetPacketBody(c *gin.Context) {
+	task, packet, ok := findRequestedPacket(c)
+	if !ok {
+		return
+	}
+
+	parsed := parseRequestBody(packet, bodyParseOptions{ProtobufMessage: c.Query("message")})
+	response := gin.H{
+		"task_id":      task.id,
+		"seq":          packet.Seq,
+		"content_type": packet.ContentType,
+		"parsed_body":  parsed,
+	}
+	if path := c.Query("jsonpath"); path != "" {
+		if parsed == nil || parsed.JSON == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求内容不是JSON，无法使用JSONPath查询"})
+			return
+		}
+		result, err := queryJSONPath(parsed.JSON, path)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		response["jsonpath"] = path
+		response["result"] = result
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadPacketBody 以附件形式下载请求内容，Content-Type为根据内容识别的类型
+func DownloadPacketBody(c *gin.Context) {
+	task, packet, ok := findRequestedPacket(c)
+	if !ok {
+		return
+	}
+
+	data, ok := requestedBodyBytes(c, packet)
+	if !ok {
+		return
+	}
+	detected := mimetype.Detect(data)
+	filename := fmt.Sprintf("%s_%d%s", task.id, packet.Seq, detected.Extension())
+	if detected.Extension() == "" {
+		filename += ".bin"
+	}
+	recordAudit(actorFromContext(c), AuditEntry{
+		Action: auditActionExport,
+		TaskID: task.id,
+		Target: fmt.Sprintf("body:%d", packet.Seq),
+		Counts: map[string]int64{"bytes": int64(len(data))},
+	})
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, detected.String(), data)
+}
+
+// GetPacketBodyHexdump 以十六进制转储的形式返回请求内容，每行16字节，带偏移量和可打印字符。
+// offset和length指定输出的范围，length最大为1MB
+func GetPacketBodyHexdump(c *gin.Context) {
+	_, packet, ok := findRequestedPacket(c)
+	if !ok {
+		return
+	}
+
+	data, ok := requestedBodyBytes(c, packet)
+	if !ok {
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset必须为非负整数"})
+		return
+	}
+	length, err := strconv.Atoi(c.DefaultQuery("length", strconv.Itoa(maxHexdumpLength)))
+	if err != nil || length <= 0 || length > maxHexdumpLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("length必须在1到%d之间", maxHexdumpLength)})
+		return
+	}
+	if offset > len(data) {
+		offset = len(data)
+	}
+	end := offset + length
+	if end > len(data) {
+		end = len(data)
+	}
+
+	c.Header("X-Body-Size", strconv.Itoa(len(data)))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", formatHexdump(data[offset:end], offset))
+}
+
+// formatHexdump 按hexdump -C的格式输出，每行为偏移量、16个字节的十六进制和可打印字符，
+// 偏移量从baseOffset开始计算
+func formatHexdump(data []byte, baseOffset int) []byte {
+	var output bytes.Buffer
+	for lineStart := 0; lineStart < len(data); lineStart += 16 {
+		line := data[lineStart:min(lineStart+16, len(data))]
+		fmt.Fprintf(&output, "%08x  ", baseOffset+lineStart)
+		for i := 0; i < 16; i++ {
+			if i < len(line) {
+				output.WriteString(hex.EncodeToString(line[i : i+1]))
+				output.WriteByte(' ')
+			} else {
+				output.WriteString("   ")
+			}
+			if i == 7 {
+				output.WriteByte(' ')
+			}
+		}
+		output.WriteString(" |")
+		for _, b := range line {
+			if b < 0x20 || b > 0x7e {
+				b = '.'
+			}
+			output.WriteByte(b)
+		}
+		output.WriteString("|\n")
+	}
+	return output.Bytes()
+}
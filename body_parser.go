@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// multipart中文本内容最多保存的字节数，文件只记录大小
+const maxMultipartTextSize = 64 << 10
+
+// 按Content-Type解析后的请求内容
+type ParsedBody struct {
+	Kind            string          `json:"kind"` // json、form、multipart、xml、protobuf，无法识别时为text
+	MediaType       string          `json:"media_type,omitempty"`
+	Pretty          string          `json:"pretty,omitempty"`           // 格式化后的JSON或XML
+	JSON            interface{}     `json:"json,omitempty"`             // JSON树，可以用JSONPath查询
+	Form            []FormField     `json:"form,omitempty"`             // 表单字段，保持原始顺序
+	Parts           []MultipartPart `json:"parts,omitempty"`            // multipart的各部分
+	XMLRoot         string          `json:"xml_root,omitempty"`         // XML根元素名称
+	Protobuf        interface{}     `json:"protobuf,omitempty"`         // 无schema解码的protobuf字段
+	ProtobufMessage string          `json:"protobuf_message,omitempty"` // 使用描述符解码时的消息类型，结果在json和pretty中
+	Error           string          `json:"error,omitempty"`            // 解析失败的原因，已解析的部分仍然保留
+}
+
+// url-encoded表单的一个字段
+type FormField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// multipart的一部分
+type MultipartPart struct {
+	Headers     []HTTPHeader `json:"headers"`
+	Name        string       `json:"name,omitempty"`
+	Filename    string       `json:"filename,omitempty"`
+	ContentType string       `json:"content_type,omitempty"`
+	Size        int64        `json:"size"`
+	Content     string       `json:"content,omitempty"` // 不是文件时的文本内容
+}
+
+// 解析请求内容的选项
+type bodyParseOptions struct {
+	// protobuf消息类型，为空时使用Content-Type的messageType或proto参数，都没有时无schema解码
+	ProtobufMessage string
+}
+
+// 内容解析器，parse的params为Content-Type的参数
+type bodyParser struct {
+	kind  string
+	parse func(parsed *ParsedBody, body []byte, params map[string]string, options bodyParseOptions) error
+}
+
+var (
+	jsonBodyParser      = bodyParser{kind: "json", parse: parseJSONBody}
+	formBodyParser      = bodyParser{kind: "form", parse: parseFormBody}
+	multipartBodyParser = bodyParser{kind: "multipart", parse: parseMultipartBody}
+	xmlBodyParser       = bodyParser{kind: "xml", parse: parseXMLBody}
+	protobufBodyParser  = bodyParser{kind: "protobuf", parse: parseProtobufBody}
+)
+
+// 按媒体类型注册的解析器，+json、+xml后缀的类型分别按JSON和XML解析
+var bodyParsers = map[string]bodyParser{
+	"application/json":                  jsonBodyParser,
+	"text/json":                         jsonBodyParser,
+	"application/x-www-form-urlencoded": formBodyParser,
+	"multipart/form-data":               multipartBodyParser,
+	"multipart/mixed":                   multipartBodyParser,
+	"application/xml":                   xmlBodyParser,
+	"text/xml":                          xmlBodyParser,
+	"application/x-protobuf":            protobufBodyParser,
+	"application/protobuf":              protobufBodyParser,
+	"application/vnd.google.protobuf":   protobufBodyParser,
+}
+
+// parseRequestBody 按Content-Type解析数据包的请求内容，没有内容时返回nil
+func parseRequestBody(packet PacketInfo, options bodyParseOptions) *ParsedBody {
+	body := packet.Body.content()
+	if len(body) == 0 {
+		return nil
+	}
+
+	parsed := &ParsedBody{Kind: "text"}
+	mediaType, params, _ := mime.ParseMediaType(packet.ContentType)
+	parsed.MediaType = mediaType
+
+	parser, ok := findBodyParser(mediaType, body)
+	if !ok {
+		return parsed
+	}
+	parsed.Kind = parser.kind
+	if err := parser.parse(parsed, body, params, options); err != nil {
+		parsed.Error = err.Error()
+	}
+	return parsed
+}
+
+// findBodyParser 查找媒体类型对应的解析器，没有Content-Type时根据内容推测是否为JSON
+func findBodyParser(mediaType string, body []byte) (bodyParser, bool) {
+	if parser, ok := bodyParsers[mediaType]; ok {
+		return parser, true
+	}
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		return jsonBodyParser, true
+	case strings.HasSuffix(mediaType, "+xml"):
+		return xmlBodyParser, true
+	case mediaType == "" && json.Valid(body):
+		return jsonBodyParser, true
+	}
+	return bodyParser{}, false
+}
+
+// parseJSONBody 格式化JSON并解析为JSON树
+func parseJSONBody(parsed *ParsedBody, body []byte, params map[string]string, options bodyParseOptions) error {
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, body, "", "  "); err != nil {
+		return err
+	}
+	parsed.Pretty = pretty.String()
+	return parseJSONTree(parsed, body)
+}
+
+// parseJSONTree 解析JSON为可以用JSONPath查询的树，数字保留原始精度
+func parseJSONTree(parsed *ParsedBody, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return err
+	}
+	parsed.JSON = tree
+	return nil
+}
+
+// parseFormBody 按原始顺序解析url-encoded表单
+func parseFormBody(parsed *ParsedBody, body []byte, params map[string]string, options bodyParseOptions) error {
+	parsed.Form = make([]FormField, 0)
+	var firstErr error
+	for _, pair := range strings.Split(string(body), "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		unescapedName, err := url.QueryUnescape(name)
+		if err == nil {
+			name = unescapedName
+		} else if firstErr == nil {
+			firstErr = err
+		}
+		unescapedValue, err := url.QueryUnescape(value)
+		if err == nil {
+			value = unescapedValue
+		} else if firstErr == nil {
+			firstErr = err
+		}
+		parsed.Form = append(parsed.Form, FormField{Name: name, Value: value})
+	}
+	return firstErr
+}
+
+// parseMultipartBody 解析multipart的各部分，文件只记录大小
+func parseMultipartBody(parsed *ParsedBody, body []byte, params map[string]string, options bodyParseOptions) error {
+	boundary := params["boundary"]
+	if boundary == "" {
+		return errors.New("Content-Type中缺少boundary")
+	}
+
+	parsed.Parts = make([]MultipartPart, 0)
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		// NextRawPart不会按Content-Transfer-Encoding转换内容，保留原始大小
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		info := MultipartPart{
+			Headers:     mimeHeaders(part.Header),
+			Name:        part.FormName(),
+			Filename:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+		}
+		var content bytes.Buffer
+		limit := int64(maxMultipartTextSize)
+		if info.Filename != "" {
+			limit = 0
+		}
+		copied, err := io.Copy(&content, io.LimitReader(part, limit))
+		info.Size = copied
+		if err == nil {
+			var rest int64
+			rest, err = io.Copy(io.Discard, part)
+			info.Size += rest
+		}
+		if info.Filename == "" {
+			info.Content = content.String()
+		}
+		parsed.Parts = append(parsed.Parts, info)
+		if err != nil {
+			// 数据包中的内容不完整时保留已解析的部分
+			return err
+		}
+	}
+}
+
+// multipart中一部分在原始内容中的位置
+type multipartSpan struct {
+	header     textproto.MIMEHeader
+	name       string // Content-Disposition的name参数
+	filename   string // Content-Disposition的filename参数，不为空时是文件
+	start, end int    // 内容（不含头部）在原始内容中的范围
+}
+
+// multipartSpans 按boundary切分multipart内容，返回各部分内容的位置，用于只替换某一部分而不改变其他字节。
+// 内容在数据包中不完整时返回已找到的部分和io.ErrUnexpectedEOF，最后一部分延伸到内容末尾
+func multipartSpans(body []byte, boundary string) ([]multipartSpan, error) {
+	delimiter := []byte("--" + boundary)
+	var pos int
+	if !bytes.HasPrefix(body, delimiter) {
+		index := bytes.Index(body, append([]byte("\r\n"), delimiter...))
+		if index < 0 {
+			return nil, errors.New("内容中没有boundary分隔线")
+		}
+		pos = index + 2
+	}
+
+	var spans []multipartSpan
+	for {
+		after := pos + len(delimiter)
+		if bytes.HasPrefix(body[after:], []byte("--")) {
+			return spans, nil
+		}
+		lineEnd := bytes.IndexByte(body[after:], '\n')
+		if lineEnd < 0 {
+			return spans, io.ErrUnexpectedEOF
+		}
+		headerStart := after + lineEnd + 1
+		var start int
+		switch headerEnd := bytes.Index(body[headerStart:], []byte("\r\n\r\n")); {
+		case bytes.HasPrefix(body[headerStart:], []byte("\r\n")):
+			// 没有头部的部分
+			start = headerStart + 2
+		case headerEnd < 0:
+			return spans, io.ErrUnexpectedEOF
+		default:
+			start = headerStart + headerEnd + 4
+		}
+
+		header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(body[headerStart:start]))).ReadMIMEHeader()
+		if err != nil {
+			return spans, err
+		}
+		span := multipartSpan{header: header, start: start, end: len(body)}
+		if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+			span.name, span.filename = params["name"], params["filename"]
+		}
+
+		next := bytes.Index(body[start:], append([]byte("\r\n"), delimiter...))
+		if next < 0 {
+			spans = append(spans, span)
+			return spans, io.ErrUnexpectedEOF
+		}
+		span.end = start + next
+		spans = append(spans, span)
+		pos = span.end + 2
+	}
+}
+
+// mimeHeaders 把MIME头转换为按名称排序的列表
+func mimeHeaders(header map[string][]string) []HTTPHeader {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	headers := make([]HTTPHeader, 0, len(names))
+	for _, name := range names {
+		for _, value := range header[name] {
+			headers = append(headers, HTTPHeader{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// parseXMLBody 格式化XML，保留原始的命名空间前缀
+func parseXMLBody(parsed *ParsedBody, body []byte, params map[string]string, options bodyParseOptions) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	var pretty strings.Builder
+	depth := 0
+	// 元素为空或只包含文本时，结束标签与开始标签写在同一行
+	inline := false
+	newline := func() {
+		if pretty.Len() > 0 {
+			pretty.WriteByte('\n')
+		}
+		pretty.WriteString(strings.Repeat("  ", depth))
+	}
+
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			parsed.Pretty = pretty.String()
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if parsed.XMLRoot == "" {
+				parsed.XMLRoot = xmlName(t.Name)
+			}
+			newline()
+			pretty.WriteString("<" + xmlName(t.Name))
+			for _, attr := range t.Attr {
+				pretty.WriteString(" " + xmlName(attr.Name) + `="`)
+				xml.EscapeText(&pretty, []byte(attr.Value))
+				pretty.WriteString(`"`)
+			}
+			pretty.WriteString(">")
+			depth++
+			inline = true
+		case xml.EndElement:
+			depth--
+			if !inline {
+				newline()
+			}
+			pretty.WriteString("</" + xmlName(t.Name) + ">")
+			inline = false
+		case xml.CharData:
+			text := bytes.TrimSpace(t)
+			if len(text) > 0 {
+				xml.EscapeText(&pretty, text)
+			}
+		case xml.Comment:
+			inline = false
+			newline()
+			pretty.WriteString("<!--" + string(t) + "-->")
+		case xml.ProcInst:
+			newline()
+			pretty.WriteString("<?" + t.Target + " " + string(t.Inst) + "?>")
+		case xml.Directive:
+			newline()
+			pretty.WriteString("<!" + string(t) + ">")
+		}
+	}
+	parsed.Pretty = pretty.String()
+	return nil
+}
+
+// xmlName 返回带前缀的元素或属性名称
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// parseProtobufBody 解码protobuf，消息类型依次取选项、Content-Type的messageType和proto参数
+func parseProtobufBody(parsed *ParsedBody, body []byte, params map[string]string, options bodyParseOptions) error {
+	messageType := options.ProtobufMessage
+	for _, key := range []string{"messagetype", "proto"} {
+		if messageType == "" {
+			messageType = params[key]
+		}
+	}
+	return decodeProtobufBody(parsed, body, messageType)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// bodyPacket 构造只有Content-Type和内容的数据包
+func bodyPacket(contentType, body string) PacketInfo {
+	return PacketInfo{
+		ContentType: contentType,
+		Body:        &HTTPBody{Raw: []byte(body), RawSize: len(body)},
+	}
+}
+
+func TestParseRequestBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		kind        string
+		wantErr     bool
+		check       func(t *testing.T, parsed *ParsedBody)
+	}{
+		{
+			name:        "json",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"a":[1,2],"big":12345678901234567890}`,
+			kind:        "json",
+			check: func(t *testing.T, parsed *ParsedBody) {
+				if parsed.Pretty == "" {
+					t.Error("pretty is empty")
+				}
+				// 数字保留原始精度
+				big := parsed.JSON.(map[string]interface{})["big"]
+				if number, ok := big.(json.Number); !ok || number.String() != "12345678901234567890" {
+					t.Errorf("big = %#v", big)
+				}
+			},
+		},
+		{name: "vendor json suffix", contentType: "application/vnd.api+json", body: `{}`, kind: "json"},
+		{name: "json guessed without content type", body: `[1]`, kind: "json"},
+		{name: "invalid json", contentType: "application/json", body: `{"a":`, kind: "json", wantErr: true},
+		{name: "plain text", contentType: "text/plain", body: "hello", kind: "text"},
+		{name: "unknown without content type", body: "hello", kind: "text"},
+		{
+			name:        "form keeps order and unescapes",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "b=2&a=hello+world&c=%E4%BD%A0&empty=",
+			kind:        "form",
+			check: func(t *testing.T, parsed *ParsedBody) {
+				want := []FormField{{"b", "2"}, {"a", "hello world"}, {"c", "你"}, {"empty", ""}}
+				if len(parsed.Form) != len(want) {
+					t.Fatalf("form = %v", parsed.Form)
+				}
+				for i := range want {
+					if parsed.Form[i] != want[i] {
+						t.Errorf("form[%d] = %v, want %v", i, parsed.Form[i], want[i])
+					}
+				}
+			},
+		},
+		{name: "form with bad escape", contentType: "application/x-www-form-urlencoded", body: "a=%zz&b=1", kind: "form", wantErr: true},
+		{
+			name:        "multipart",
+			contentType: "multipart/form-data; boundary=B",
+			body: "--B\r\nContent-Disposition: form-data; name=\"note\"\r\n\r\nhi\r\n" +
+				"--B\r\nContent-Disposition: form-data; name=\"up\"; filename=\"f.bin\"\r\nContent-Type: application/octet-stream\r\n\r\n12345\r\n" +
+				"--B--\r\n",
+			kind: "multipart",
+			check: func(t *testing.T, parsed *ParsedBody) {
+				if len(parsed.Parts) != 2 {
+					t.Fatalf("parts = %v", parsed.Parts)
+				}
+				if p := parsed.Parts[0]; p.Name != "note" || p.Content != "hi" || p.Size != 2 {
+					t.Errorf("text part = %+v", p)
+				}
+				// 文件只记录大小
+				if p := parsed.Parts[1]; p.Filename != "f.bin" || p.Content != "" || p.Size != 5 || p.ContentType != "application/octet-stream" {
+					t.Errorf("file part = %+v", p)
+				}
+			},
+		},
+		{name: "multipart without boundary", contentType: "multipart/form-data", body: "--B\r\n", kind: "multipart", wantErr: true},
+		{
+			name:        "multipart cut off keeps parsed parts",
+			contentType: "multipart/form-data; boundary=B",
+			body:        "--B\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\n1\r\n--B\r\nContent-Disposition: form-data; name=\"b\"\r\n\r\n2",
+			kind:        "multipart",
+			wantErr:     true,
+			check: func(t *testing.T, parsed *ParsedBody) {
+				if len(parsed.Parts) == 0 || parsed.Parts[0].Content != "1" {
+					t.Errorf("parts = %+v", parsed.Parts)
+				}
+			},
+		},
+		{
+			name:        "xml",
+			contentType: "application/soap+xml",
+			body:        `<?xml version="1.0"?><s:Envelope xmlns:s="urn:x"><s:Body><a k="v">text</a><b/></s:Body></s:Envelope>`,
+			kind:        "xml",
+			check: func(t *testing.T, parsed *ParsedBody) {
+				want := "<?xml version=\"1.0\"?>\n<s:Envelope xmlns:s=\"urn:x\">\n  <s:Body>\n    <a k=\"v\">text</a>\n    <b></b>\n  </s:Body>\n</s:Envelope>"
+				if parsed.XMLRoot != "s:Envelope" {
+					t.Errorf("root = %q", parsed.XMLRoot)
+				}
+				if parsed.Pretty != want {
+					t.Errorf("pretty =\n%s\nwant\n%s", parsed.Pretty, want)
+				}
+			},
+		},
+		{
+			name:        "protobuf without schema",
+			contentType: "application/x-protobuf",
+			body:        "\x08\x96\x01",
+			kind:        "protobuf",
+			check: func(t *testing.T, parsed *ParsedBody) {
+				fields, ok := parsed.Protobuf.([]protobufField)
+				if !ok || len(fields) != 1 || fields[0].Value != uint64(150) {
+					t.Errorf("protobuf = %#v", parsed.Protobuf)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parseRequestBody(bodyPacket(tt.contentType, tt.body), bodyParseOptions{})
+			if parsed == nil {
+				t.Fatal("parsed is nil")
+			}
+			if parsed.Kind != tt.kind {
+				t.Errorf("kind = %q, want %q", parsed.Kind, tt.kind)
+			}
+			if (parsed.Error != "") != tt.wantErr {
+				t.Errorf("error = %q, wantErr %v", parsed.Error, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, parsed)
+			}
+		})
+	}
+
+	if parsed := parseRequestBody(bodyPacket("application/json", ""), bodyParseOptions{}); parsed != nil {
+		t.Errorf("empty body: parsed = %+v, want nil", parsed)
+	}
+}
+
+func TestMultipartSpans(t *testing.T) {
+	body := "preamble\r\n--B\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\none\r\n" +
+		"--B\r\n\r\nno headers\r\n" +
+		"--B\r\nContent-Disposition: form-data; name=\"f\"; filename=\"x.txt\"\r\n\r\nfile\r\n--B--\r\n"
+	spans, err := multipartSpans([]byte(body), "B")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	want := []struct{ name, filename, content string }{
+		{"a", "", "one"},
+		{"", "", "no headers"},
+		{"f", "x.txt", "file"},
+	}
+	if len(spans) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(spans), len(want))
+	}
+	for i, w := range want {
+		span := spans[i]
+		if span.name != w.name || span.filename != w.filename || body[span.start:span.end] != w.content {
+			t.Errorf("span %d = %q %q %q, want %+v", i, span.name, span.filename, body[span.start:span.end], w)
+		}
+	}
+
+	// 内容不完整时最后一部分延伸到末尾
+	spans, err = multipartSpans([]byte("--B\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\npart"), "B")
+	if err != io.ErrUnexpectedEOF || len(spans) != 1 || spans[0].end != len("--B\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\npart") {
+		t.Errorf("incomplete: spans = %+v, err = %v", spans, err)
+	}
+	if _, err := multipartSpans([]byte("no delimiter"), "B"); err == nil {
+		t.Error("missing delimiter: want error")
+	}
+}
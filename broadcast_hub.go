@@ -0,0 +1,307 @@
+package main
+
+import (
+	"abc/a/util"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 每个客户端发送队列的容量，队列满时丢弃新消息
+const clientSendQueueSize = 256
+
+// 推送给客户端的消息
+type outboundMessage struct {
+	event string // 消息类型，如new_packet、task_update
+	id    string // 事件ID，仅new_packet携带，格式为"任务ID:序号"
+	data  []byte // JSON编码后的消息内容
+}
+
+// 客户端订阅条件
+type clientSubscription struct {
+	TaskID string        `json:"task_id"` // 为空时匹配所有任务
+	Filter *PacketFilter `json:"filter"`
+
+	// 订阅时已补发过历史数据的任务及其截止序号，序号不大于它的实时数据包不再重复推送
+	replayedTaskID string
+	replayedSeq    uint64
+}
+
+// 历史数据补发选项，Last和SinceSeq都为0时不补发
+type replayOptions struct {
+	Last     int    `json:"last" form:"last"`           // 补发最近N条
+	SinceSeq uint64 `json:"since_seq" form:"since_seq"` // 补发序号大于该值的全部数据包
+}
+
+// 推送中心的客户端，每个客户端拥有独立的有界发送队列，由各自的写协程消费
+type hubClient struct {
+	id       string
+	identity authIdentity // 连接的身份，角色决定能否发送控制指令
+	send     chan outboundMessage
+	// 订阅条件，为nil时接收所有任务的全部数据包
+	subscription *clientSubscription
+	// 因队列已满而丢弃、尚未通知客户端的消息数
+	dropped int
+	// 已注销，发送队列已关闭
+	closed bool
+}
+
+// 推送中心，负责把消息按顺序非阻塞地分发到各客户端的发送队列
+type broadcastHub struct {
+	mutex   sync.Mutex
+	clients map[string]*hubClient
+}
+
+// 全局推送中心
+var hub = &broadcastHub{clients: make(map[string]*hubClient)}
+
+// newHubClient 创建客户端，需通过subscribe加入推送中心后才会收到广播
+func newHubClient(id string) *hubClient {
+	return &hubClient{
+		id:   id,
+		send: make(chan outboundMessage, clientSendQueueSize),
+	}
+}
+
+// add 将客户端加入推送中心，调用方需持有hub锁
+func (h *broadcastHub) add(client *hubClient) {
+	if old, ok := h.clients[client.id]; ok && old != client {
+		old.close()
+	}
+	h.clients[client.id] = client
+}
+
+// unregister 注销客户端并关闭其发送队列，写协程随之退出
+func (h *broadcastHub) unregister(client *hubClient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.clients[client.id] == client {
+		delete(h.clients, client.id)
+	}
+	client.close()
+}
+
+// close 关闭客户端的发送队列，调用方需持有hub锁
+func (c *hubClient) close() {
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// queue 返回客户端当前的发送队列，以及客户端是否仍处于注册状态。
+// 补发时队列可能被替换为更大的队列，旧队列随之关闭；写协程读到队列关闭后应重新调用queue，
+// 仍处于注册状态时继续消费新队列，否则退出
+func (h *broadcastHub) queue(client *hubClient) (<-chan outboundMessage, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return client.send, !client.closed
+}
+
+// reserve 保证发送队列至少还能放入n条消息，不足时换成更大的队列，调用方需持有hub锁。
+// 旧队列中尚未取走的消息按顺序移入新队列；写协程可能同时从旧队列取走消息，
+// 它取走的消息一定排在移入新队列的消息之前，顺序不会改变
+func (c *hubClient) reserve(n int) {
+	if c.closed || cap(c.send)-len(c.send) >= n {
+		return
+	}
+	queue := make(chan outboundMessage, len(c.send)+n+clientSendQueueSize)
+	close(c.send)
+	for msg := range c.send {
+		queue <- msg
+	}
+	c.send = queue
+}
+
+// subscribe 更新客户端的订阅条件，客户端尚未注册时一并注册。
+// replay不为nil时先补发订阅任务中已存储的数据包，再接收实时数据包，两者之间不重复也不遗漏；
+// 返回补发的数据包数量
+func (h *broadcastHub) subscribe(client *hubClient, subscription *clientSubscription, replay *replayOptions) int {
+	if subscription == nil || replay == nil || (replay.Last <= 0 && replay.SinceSeq == 0) {
+		h.mutex.Lock()
+		h.add(client)
+		client.subscription = subscription
+		h.mutex.Unlock()
+		return 0
+	}
+
+	task := findTask(subscription.TaskID)
+	if task == nil {
+		h.mutex.Lock()
+		h.add(client)
+		client.subscription = subscription
+		h.mutex.Unlock()
+		return 0
+	}
+
+	// 持有packetsMu期间不会有新数据包入库，快照之后入库的数据包一定在注册之后广播；
+	// 快照之前入库但尚未广播的数据包由replayedSeq过滤掉
+	task.packetsMu.Lock()
+	defer task.packetsMu.Unlock()
+
+	var matched []PacketInfo
+	for _, packet := range task.packets {
+		if packet.Seq > replay.SinceSeq && subscription.Filter.Match(packet) {
+			matched = append(matched, packet)
+		}
+	}
+	if replay.Last > 0 && len(matched) > replay.Last {
+		matched = matched[len(matched)-replay.Last:]
+	}
+	subscription.TaskID = task.id
+	subscription.replayedTaskID = task.id
+	subscription.replayedSeq = task.lastSeq
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// 按补发数量和结束标记扩大队列，避免补发时丢弃；已注册的客户端重新订阅时同样适用
+	client.reserve(len(matched) + 1)
+	h.add(client)
+	client.subscription = subscription
+	for _, packet := range matched {
+		if msg, ok := newPacketMessage(task.id, packet); ok {
+			client.enqueue(msg)
+		}
+	}
+
+	// 补发结束标记，之后收到的都是实时数据包
+	if msg, ok := newOutboundMessage(gin.H{
+		"type":     "replay_complete",
+		"task_id":  task.id,
+		"replayed": len(matched),
+		"last_seq": task.lastSeq,
+	}); ok {
+		client.enqueue(msg)
+	}
+	return len(matched)
+}
+
+// subscriptionFromQuery 从连接请求的查询参数中解析订阅条件和补发选项，
+// 未指定任何条件时返回nil，表示接收全部数据包
+func subscriptionFromQuery(c *gin.Context) (*clientSubscription, *replayOptions, error) {
+	var filter PacketFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		return nil, nil, err
+	}
+	var replay replayOptions
+	if err := c.ShouldBindQuery(&replay); err != nil {
+		return nil, nil, err
+	}
+
+	taskID := c.Query("task_id")
+	if taskID == "" && filter.IsEmpty() && replay.Last <= 0 && replay.SinceSeq == 0 {
+		return nil, nil, nil
+	}
+	subscription := &clientSubscription{TaskID: taskID, Filter: &filter}
+	if replay.Last <= 0 && replay.SinceSeq == 0 {
+		return subscription, nil, nil
+	}
+	return subscription, &replay, nil
+}
+
+// sendTo 向单个客户端发送消息
+func (h *broadcastHub) sendTo(client *hubClient, response gin.H) {
+	msg, ok := newOutboundMessage(response)
+	if !ok {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !client.closed {
+		client.enqueue(msg)
+	}
+}
+
+// hasClient 判断是否有满足条件的客户端，用于在没有接收者时跳过消息的序列化
+func (h *broadcastHub) hasClient(match func(client *hubClient) bool) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, client := range h.clients {
+		if match(client) {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast 向所有满足条件的客户端发送消息，match为nil时发送给全部客户端
+func (h *broadcastHub) broadcast(msg outboundMessage, match func(client *hubClient) bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, client := range h.clients {
+		if match == nil || match(client) {
+			client.enqueue(msg)
+		}
+	}
+}
+
+// enqueue 非阻塞地将消息放入发送队列，调用方需持有hub锁。
+// 队列满时丢弃消息并计数，队列恢复后先补发一条lagged通知
+func (c *hubClient) enqueue(msg outboundMessage) {
+	if c.dropped > 0 {
+		notice, _ := newOutboundMessage(gin.H{
+			"type":    "lagged",
+			"dropped": c.dropped,
+			"message": "客户端处理过慢，部分消息已被丢弃",
+		})
+		select {
+		case c.send <- notice:
+			util.Log.Logger.Warn("客户端消费过慢，已丢弃 %d 条消息，连接ID: %s", c.dropped, c.id)
+			c.dropped = 0
+		default:
+			c.dropped++
+			return
+		}
+	}
+
+	select {
+	case c.send <- msg:
+	default:
+		c.dropped++
+	}
+}
+
+// 判断订阅是否需要接收该数据包
+func (s *clientSubscription) wants(taskID string, packet PacketInfo) bool {
+	if s == nil {
+		return true
+	}
+	if s.TaskID != "" && s.TaskID != taskID {
+		return false
+	}
+	if s.replayedTaskID == taskID && packet.Seq <= s.replayedSeq {
+		return false
+	}
+	return s.Filter.Match(packet)
+}
+
+// newOutboundMessage 将消息序列化为待发送的消息
+func newOutboundMessage(response gin.H) (outboundMessage, bool) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		util.Log.Logger.Error("JSON序列化失败: %v", err)
+		return outboundMessage{}, false
+	}
+	event, _ := response["type"].(string)
+	return outboundMessage{event: event, data: jsonData}, true
+}
+
+// newPacketMessage 生成new_packet消息，事件ID为"任务ID:序号"
+func newPacketMessage(taskID string, packet PacketInfo) (outboundMessage, bool) {
+	msg, ok := newOutboundMessage(gin.H{
+		"type":    "new_packet",
+		"task_id": taskID,
+		"packet":  packet,
+	})
+	msg.id = taskID + ":" + strconv.FormatUint(packet.Seq, 10)
+	return msg, ok
+}
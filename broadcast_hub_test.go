@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+)
+
+// 已注册的客户端重新订阅并补发超过队列容量的数据包时，队列应按补发数量扩大，不丢弃消息
+func TestSubscribeReplayGrowsRegisteredQueue(t *testing.T) {
+	const total = clientSendQueueSize * 2
+	task := &captureTask{id: "task_replay_test"}
+	for seq := uint64(1); seq <= total; seq++ {
+		task.packets = append(task.packets, PacketInfo{Seq: seq, Method: "GET"})
+	}
+	task.lastSeq = total
+
+	TaskMutex.Lock()
+	snapshotTasks[task.id] = task
+	TaskMutex.Unlock()
+	defer func() {
+		TaskMutex.Lock()
+		delete(snapshotTasks, task.id)
+		TaskMutex.Unlock()
+	}()
+
+	testHub := &broadcastHub{clients: make(map[string]*hubClient)}
+	client := newHubClient("replay-test")
+	testHub.subscribe(client, nil, nil)
+	defer testHub.unregister(client)
+
+	// 写协程已在消费旧队列，重新订阅后应能从新队列读到全部补发消息
+	queue, _ := testHub.queue(client)
+	pending := len(queue)
+
+	subscription := &clientSubscription{TaskID: task.id}
+	replayed := testHub.subscribe(client, subscription, &replayOptions{Last: total})
+	if replayed != total {
+		t.Fatalf("replayed = %d, want %d", replayed, total)
+	}
+	if client.dropped != 0 {
+		t.Fatalf("dropped = %d, want 0", client.dropped)
+	}
+
+	received := 0
+	for received < pending+total+1 {
+		msg, ok := <-queue
+		if !ok {
+			var registered bool
+			if queue, registered = testHub.queue(client); !registered {
+				t.Fatal("client unregistered unexpectedly")
+			}
+			continue
+		}
+		if received == pending+total && msg.event != "replay_complete" {
+			t.Fatalf("last event = %q, want replay_complete", msg.event)
+		}
+		received++
+	}
+
+	// 队列已足够时不应再替换
+	before, _ := testHub.queue(client)
+	testHub.subscribe(client, subscription, &replayOptions{Last: 1})
+	if after, _ := testHub.queue(client); after != before {
+		t.Error("queue replaced although it had enough room")
+	}
+}
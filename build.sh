@@ -26,7 +26,7 @@ go build -o packet-capture-tool
 # 检查是否为Linux系统
 if [ "$(uname -s)" = "Linux" ]; then
     echo "正在设置网络权限..."
-    sudo setcap cap_net_raw+ep packet-capture-tool
+    sudo setcap cap_net_raw,cap_net_admin=eip packet-capture-tool
     # 验证
 getcap packet-capture-tool
 else
@@ -0,0 +1,146 @@
+//go:build linux
+
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+// afpacket每次等待数据包的最长时间，关闭时最多需要等待这么久
+const afpacketPollTimeout = 100 * time.Millisecond
+
+// 使用AF_PACKET内存映射环形缓冲区（TPACKET_V3）读取数据包，比libpcap逐包读取的开销小
+type afpacketSource struct {
+	// 读取期间持有读锁，Close持有写锁，避免关闭时释放正在读取的环形缓冲区
+	mutex   sync.RWMutex
+	tpacket *afpacket.TPacket
+	closed  bool
+}
+
+// openAFPacketSource 打开AF_PACKET抓包，设置了FanoutGroup时加入该fanout组，
+// 内核按流的哈希值把数据包分给组内的各个socket，同一个TCP连接的数据包总是由同一个socket读取
+func openAFPacketSource(options captureSourceOptions) (captureSource, error) {
+	ringSizeMB := options.RingSizeMB
+	if ringSizeMB <= 0 {
+		ringSizeMB = defaultRingSizeMB
+	}
+	frameSize, blockSize, numBlocks := afpacketRingSize(ringSizeMB, int(options.SnapLen), os.Getpagesize())
+
+	// any表示所有网卡，afpacket不绑定网卡即可
+	device := options.Device
+	if device == "any" {
+		device = ""
+	}
+	tpacket, err := afpacket.NewTPacket(
+		afpacket.OptInterface(device),
+		afpacket.OptFrameSize(frameSize),
+		afpacket.OptBlockSize(blockSize),
+		afpacket.OptNumBlocks(numBlocks),
+		afpacket.OptPollTimeout(afpacketPollTimeout),
+		afpacket.TPacketVersion3,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.BPFFilter != "" {
+		instructions, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, int(options.SnapLen), options.BPFFilter)
+		if err != nil {
+			tpacket.Close()
+			return nil, err
+		}
+		raw := make([]bpf.RawInstruction, len(instructions))
+		for i, instruction := range instructions {
+			raw[i] = bpf.RawInstruction{Op: instruction.Code, Jt: instruction.Jt, Jf: instruction.Jf, K: instruction.K}
+		}
+		if err := tpacket.SetBPF(raw); err != nil {
+			tpacket.Close()
+			return nil, err
+		}
+	}
+
+	if options.FanoutGroup != 0 {
+		if err := tpacket.SetFanout(afpacket.FanoutHashWithDefrag, options.FanoutGroup); err != nil {
+			tpacket.Close()
+			return nil, err
+		}
+	}
+	return &afpacketSource{tpacket: tpacket}, nil
+}
+
+// afpacketRingSize 根据环形缓冲区大小和抓取长度计算帧大小、块大小和块数量，
+// 帧大小需要能放下一个完整的数据包，块大小需要是页大小和帧大小的整数倍
+func afpacketRingSize(ringSizeMB, snapLen, pageSize int) (frameSize, blockSize, numBlocks int) {
+	if snapLen <= 0 {
+		snapLen = 65535
+	}
+	if snapLen < pageSize {
+		frameSize = pageSize / (pageSize / snapLen)
+	} else {
+		frameSize = (snapLen/pageSize + 1) * pageSize
+	}
+	blockSize = frameSize * 128
+	numBlocks = ringSizeMB * 1024 * 1024 / blockSize
+	if numBlocks < 1 {
+		numBlocks = 1
+	}
+	return frameSize, blockSize, numBlocks
+}
+
+// ReadPacketData 读取下一个数据包，超时返回pcap.NextErrorTimeoutExpired，关闭后返回io.EOF
+func (s *afpacketSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.closed {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+	data, info, err := s.tpacket.ReadPacketData()
+	if err == afpacket.ErrTimeout {
+		return nil, info, pcap.NextErrorTimeoutExpired
+	}
+	return data, info, err
+}
+
+// captureStats 返回socket的累计统计，AF_PACKET不区分内核丢包和网卡丢包
+func (s *afpacketSource) captureStats() (captureSourceStats, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.closed {
+		return captureSourceStats{}, io.EOF
+	}
+	_, stats, err := s.tpacket.SocketStats()
+	if err != nil {
+		return captureSourceStats{}, err
+	}
+	return captureSourceStats{
+		Received:      int64(stats.Packets()),
+		DroppedKernel: int64(stats.Drops()),
+	}, nil
+}
+
+// LinkType AF_PACKET的SOCK_RAW返回以太网帧
+func (s *afpacketSource) LinkType() layers.LinkType {
+	return layers.LinkTypeEthernet
+}
+
+// Close 等待正在进行的读取结束后释放环形缓冲区
+func (s *afpacketSource) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		s.tpacket.Close()
+	}
+}
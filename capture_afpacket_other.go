@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// openAFPacketSource AF_PACKET只在Linux上可用
+func openAFPacketSource(options captureSourceOptions) (captureSource, error) {
+	return nil, errors.New("afpacket抓包后端仅支持Linux")
+}
@@ -25,8 +25,5 @@ func GetCurrentRunningTask(c *gin.Context) {
 	}
 
 	util.Log.Logger.Info("获取运行中任务信息成功，IP: %s", c.ClientIP())
-	c.JSON(http.StatusOK, gin.H{
-		"running": true,
-		"config":  task.config,
-	})
+	c.JSON(http.StatusOK, task.status())
 }
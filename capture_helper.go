@@ -0,0 +1,397 @@
+package main
+
+import (
+	"abc/a/util"
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// 特权抓包进程与API服务之间的协议：
+//  1. API服务连接Unix socket，发送一行JSON格式的captureSourceOptions
+//  2. 抓包进程打开网卡，返回一行JSON格式的helperOpenResponse
+//  3. 打开成功后，抓包进程持续发送数据包，每个数据包为16字节头部加数据：
+//     时间戳（Unix纳秒，int64）、数据长度（uint32）、原始长度（uint32），均为大端序
+//  4. 抓包进程每隔helperStatsInterval发送一次网卡统计，数据长度为helperStatsFrame，
+//     原始长度为之后JSON格式captureSourceStats的长度
+//  5. API服务关闭连接即关闭网卡
+const (
+	helperFrameHeaderSize = 16
+	// 统计帧的数据长度标记
+	helperStatsFrame = 0xFFFFFFFF
+	// 抓包进程发送网卡统计的间隔
+	helperStatsInterval = time.Second
+	// 默认的Unix socket路径
+	defaultHelperSocket = "/run/websnatch/capture.sock"
+	// 抓包进程读取网卡的超时时间，超时后把已缓冲的数据包发给API服务
+	helperFlushInterval = 100 * time.Millisecond
+	// 网卡名称的最大字节数，Windows的网卡名称包含GUID，比Linux的长
+	maxDeviceNameLength = 256
+)
+
+// 打开网卡的结果
+type helperOpenResponse struct {
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+	LinkType int    `json:"link_type"`
+}
+
+// runCaptureHelper 以特权抓包进程运行，只负责打开网卡并转发数据包，不提供HTTP服务
+func runCaptureHelper(args []string) {
+	flags := flag.NewFlagSet("capture-helper", flag.ExitOnError)
+	socketPath := flags.String("socket", defaultHelperSocket, "监听的Unix socket路径")
+	group := flags.String("group", "", "允许连接的用户组，为空时只有当前用户可以连接")
+	flags.Parse(args)
+
+	if err := os.MkdirAll(filepath.Dir(*socketPath), 0755); err != nil {
+		util.Log.Logger.Fatal("创建socket目录失败: %v", err)
+	}
+	// 删除上次退出时残留的socket文件
+	os.Remove(*socketPath)
+	listener, err := net.Listen("unix", *socketPath)
+	if err != nil {
+		util.Log.Logger.Fatal("监听Unix socket失败: %v", err)
+	}
+
+	// socket的权限决定哪些用户可以通过抓包进程抓包
+	mode := os.FileMode(0600)
+	if *group != "" {
+		gid, err := lookupGroupID(*group)
+		if err != nil {
+			util.Log.Logger.Fatal("查找用户组失败: %v", err)
+		}
+		if err := os.Chown(*socketPath, -1, gid); err != nil {
+			util.Log.Logger.Fatal("修改socket属组失败: %v", err)
+		}
+		mode = 0660
+	}
+	if err := os.Chmod(*socketPath, mode); err != nil {
+		util.Log.Logger.Fatal("修改socket权限失败: %v", err)
+	}
+
+	// 退出时删除socket文件
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	util.Log.Logger.Info("特权抓包进程已启动，socket: %s, 用户组: %s", *socketPath, *group)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			util.Log.Logger.Error("接受连接失败: %v", err)
+			continue
+		}
+		go serveHelperConn(conn)
+	}
+	os.Remove(*socketPath)
+	util.Log.Logger.Info("特权抓包进程已退出")
+}
+
+// lookupGroupID 返回用户组的ID，也可以直接传入数字ID
+func lookupGroupID(name string) (int, error) {
+	if gid, err := strconv.Atoi(name); err == nil {
+		return gid, nil
+	}
+	group, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(group.Gid)
+}
+
+// serveHelperConn 处理一个连接：打开请求的网卡，把数据包转发给API服务，直到任意一方关闭
+func serveHelperConn(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	var options captureSourceOptions
+	line, err := reader.ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &options)
+	}
+	if err == io.EOF {
+		// API服务检查抓包进程是否可用时只建立连接
+		return
+	}
+	if err != nil {
+		util.Log.Logger.Error("读取抓包请求失败: %v", err)
+		return
+	}
+
+	// 抓包进程以root运行，不信任连接方发来的参数，按与抓包配置相同的范围重新校验
+	encoder := json.NewEncoder(conn)
+	if err := validateHelperOptions(options); err != nil {
+		util.Log.Logger.Warn("拒绝打开网卡: %v, 设备: %s", err, options.Device)
+		encoder.Encode(helperOpenResponse{Error: err.Error()})
+		return
+	}
+
+	// API服务请求的超时时间由helperSource实现，这里使用较短的超时以便及时发送数据包
+	localOptions := options
+	localOptions.Timeout = helperFlushInterval
+	handle, err := openLocalSource(localOptions)
+	if err != nil {
+		util.Log.Logger.Error("打开网卡失败: %v, 设备: %s", err, options.Device)
+		encoder.Encode(helperOpenResponse{Error: err.Error()})
+		return
+	}
+	if err := encoder.Encode(helperOpenResponse{OK: true, LinkType: int(handle.LinkType())}); err != nil {
+		handle.Close()
+		return
+	}
+	util.Log.Logger.Info("为API服务打开网卡: %s", options.Device)
+
+	// API服务关闭连接时关闭网卡，使下面的读取循环退出。
+	// 读取统计与关闭网卡互斥，libpcap的网卡关闭后不能再读取统计
+	var handleMutex sync.Mutex
+	handleClosed := false
+	closeHandle := func() {
+		handleMutex.Lock()
+		defer handleMutex.Unlock()
+		if !handleClosed {
+			handleClosed = true
+			handle.Close()
+		}
+	}
+	defer closeHandle()
+	go func() {
+		io.Copy(io.Discard, reader)
+		closeHandle()
+	}()
+
+	writer := bufio.NewWriter(conn)
+	header := make([]byte, helperFrameHeaderSize)
+	lastStats := time.Now()
+	for {
+		if time.Since(lastStats) >= helperStatsInterval {
+			lastStats = time.Now()
+			handleMutex.Lock()
+			stats, ok := captureSourceStats{}, false
+			if !handleClosed {
+				stats, ok = readSourceStats(handle)
+			}
+			handleMutex.Unlock()
+			if ok {
+				payload, _ := json.Marshal(stats)
+				binary.BigEndian.PutUint64(header[0:8], uint64(lastStats.UnixNano()))
+				binary.BigEndian.PutUint32(header[8:12], helperStatsFrame)
+				binary.BigEndian.PutUint32(header[12:16], uint32(len(payload)))
+				if _, err := writer.Write(header); err != nil {
+					break
+				}
+				if _, err := writer.Write(payload); err != nil {
+					break
+				}
+			}
+		}
+
+		data, info, err := handle.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			// 没有数据包时把缓冲区中的数据发出去
+			if writer.Flush() != nil {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			break
+		}
+
+		binary.BigEndian.PutUint64(header[0:8], uint64(info.Timestamp.UnixNano()))
+		binary.BigEndian.PutUint32(header[8:12], uint32(len(data)))
+		binary.BigEndian.PutUint32(header[12:16], uint32(info.Length))
+		if _, err := writer.Write(header); err != nil {
+			break
+		}
+		if _, err := writer.Write(data); err != nil {
+			break
+		}
+		if writer.Available() < 2048 {
+			if writer.Flush() != nil {
+				break
+			}
+		}
+	}
+	util.Log.Logger.Info("网卡已关闭: %s", options.Device)
+}
+
+// validateHelperOptions 校验API服务请求打开网卡的参数，取值范围与normalizeCaptureConfig相同
+func validateHelperOptions(options captureSourceOptions) error {
+	if options.Device == "" || len(options.Device) > maxDeviceNameLength || strings.ContainsFunc(options.Device, unicode.IsControl) {
+		return fmt.Errorf("无效的网卡名称: %q", options.Device)
+	}
+	if options.SnapLen < 1 || options.SnapLen > maxSnapshotLen {
+		return fmt.Errorf("snap_len应在1到%d之间", maxSnapshotLen)
+	}
+	if len(options.BPFFilter) > maxFilterLength {
+		return fmt.Errorf("bpf_filter不能超过%d字节", maxFilterLength)
+	}
+	switch options.Backend {
+	case "", captureBackendPcap:
+		if options.RingSizeMB != 0 || options.FanoutGroup != 0 {
+			return errors.New("ring_size_mb和fanout_group仅支持afpacket后端")
+		}
+	case captureBackendAFPacket:
+		if options.RingSizeMB < 0 || options.RingSizeMB > maxRingSizeMB {
+			return fmt.Errorf("ring_size_mb应在0到%d之间", maxRingSizeMB)
+		}
+	default:
+		return fmt.Errorf("不支持的抓包后端: %s", options.Backend)
+	}
+	return nil
+}
+
+// 通过特权抓包进程打开的数据包来源
+type helperSource struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	linkType layers.LinkType
+	timeout  time.Duration
+	header   []byte
+
+	statsMutex sync.Mutex
+	stats      captureSourceStats // 抓包进程最近一次发送的网卡统计
+	hasStats   bool
+}
+
+// dialCaptureHelper 连接特权抓包进程并请求打开网卡
+func dialCaptureHelper(socketPath string, options captureSourceOptions) (*helperSource, error) {
+	conn, err := net.DialTimeout("unix", socketPath, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("无法连接特权抓包进程: %v", err)
+	}
+
+	request, _ := json.Marshal(options)
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(append(request, '\n')); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("无法连接特权抓包进程: %v", err)
+	}
+	reader := bufio.NewReaderSize(conn, 256*1024)
+	var response helperOpenResponse
+	line, err := reader.ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &response)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("特权抓包进程响应无效: %v", err)
+	}
+	if !response.OK {
+		conn.Close()
+		return nil, fmt.Errorf("特权抓包进程无法打开网卡: %s", response.Error)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &helperSource{
+		conn:     conn,
+		reader:   reader,
+		linkType: layers.LinkType(response.LinkType),
+		timeout:  options.Timeout,
+		header:   make([]byte, helperFrameHeaderSize),
+	}, nil
+}
+
+// ReadPacketData 读取下一个数据包，超过打开时指定的超时时间没有数据包时返回pcap.NextErrorTimeoutExpired
+func (s *helperSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		// 只在等待下一个数据包时设置超时，避免读到一半的数据包被打断
+		if s.timeout > 0 && s.reader.Buffered() == 0 {
+			s.conn.SetReadDeadline(time.Now().Add(s.timeout))
+			_, err := s.reader.Peek(1)
+			s.conn.SetReadDeadline(time.Time{})
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, gopacket.CaptureInfo{}, pcap.NextErrorTimeoutExpired
+			}
+			if err != nil {
+				return nil, gopacket.CaptureInfo{}, io.EOF
+			}
+		}
+
+		if _, err := io.ReadFull(s.reader, s.header); err != nil {
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+		captureLength := binary.BigEndian.Uint32(s.header[8:12])
+		length := binary.BigEndian.Uint32(s.header[12:16])
+		if captureLength == helperStatsFrame {
+			if err := s.readStats(int(length)); err != nil {
+				return nil, gopacket.CaptureInfo{}, io.EOF
+			}
+			continue
+		}
+
+		info := gopacket.CaptureInfo{
+			Timestamp:     time.Unix(0, int64(binary.BigEndian.Uint64(s.header[0:8]))),
+			CaptureLength: int(captureLength),
+			Length:        int(length),
+		}
+		data := make([]byte, info.CaptureLength)
+		if _, err := io.ReadFull(s.reader, data); err != nil {
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+		return data, info, nil
+	}
+}
+
+// readStats 读取统计帧并保存
+func (s *helperSource) readStats(length int) error {
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, payload); err != nil {
+		return err
+	}
+	var stats captureSourceStats
+	if err := json.Unmarshal(payload, &stats); err != nil {
+		return err
+	}
+	s.statsMutex.Lock()
+	s.stats = stats
+	s.hasStats = true
+	s.statsMutex.Unlock()
+	return nil
+}
+
+// captureStats 返回抓包进程最近一次发送的网卡统计，最多延迟helperStatsInterval
+func (s *helperSource) captureStats() (captureSourceStats, error) {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+	if !s.hasStats {
+		return captureSourceStats{}, errors.New("尚未收到网卡统计")
+	}
+	return s.stats, nil
+}
+
+// LinkType 返回网卡的链路类型
+func (s *helperSource) LinkType() layers.LinkType {
+	return s.linkType
+}
+
+// Close 关闭连接，特权抓包进程随之关闭网卡
+func (s *helperSource) Close() {
+	s.conn.Close()
+}
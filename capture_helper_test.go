@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestHelper 在临时目录的Unix socket上运行抓包进程的连接处理，返回socket路径
+func startTestHelper(t *testing.T) string {
+	socketPath := filepath.Join(t.TempDir(), "capture.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveHelperConn(conn)
+		}
+	}()
+	return socketPath
+}
+
+func TestCaptureHelperRejectsInvalidOptions(t *testing.T) {
+	socketPath := startTestHelper(t)
+	valid := captureSourceOptions{Device: "eth0", SnapLen: 1024, Timeout: time.Second}
+
+	tests := []struct {
+		name    string
+		modify  func(options *captureSourceOptions)
+		wantErr string
+	}{
+		{name: "empty device", modify: func(o *captureSourceOptions) { o.Device = "" }, wantErr: "无效的网卡名称"},
+		{name: "device with control characters", modify: func(o *captureSourceOptions) { o.Device = "eth0\n" }, wantErr: "无效的网卡名称"},
+		{name: "device name too long", modify: func(o *captureSourceOptions) { o.Device = strings.Repeat("e", maxDeviceNameLength+1) }, wantErr: "无效的网卡名称"},
+		{name: "zero snaplen", modify: func(o *captureSourceOptions) { o.SnapLen = 0 }, wantErr: "snap_len"},
+		{name: "negative snaplen", modify: func(o *captureSourceOptions) { o.SnapLen = -1 }, wantErr: "snap_len"},
+		{name: "snaplen too large", modify: func(o *captureSourceOptions) { o.SnapLen = maxSnapshotLen + 1 }, wantErr: "snap_len"},
+		{name: "bpf filter too long", modify: func(o *captureSourceOptions) { o.BPFFilter = strings.Repeat("x", maxFilterLength+1) }, wantErr: "bpf_filter"},
+		{name: "unknown backend", modify: func(o *captureSourceOptions) { o.Backend = "dpdk" }, wantErr: "不支持的抓包后端"},
+		{name: "ring size for pcap", modify: func(o *captureSourceOptions) { o.RingSizeMB = 64 }, wantErr: "ring_size_mb"},
+		{name: "fanout group for pcap", modify: func(o *captureSourceOptions) { o.FanoutGroup = 7 }, wantErr: "fanout_group"},
+		{name: "ring size too large", modify: func(o *captureSourceOptions) {
+			o.Backend, o.RingSizeMB = captureBackendAFPacket, maxRingSizeMB+1
+		}, wantErr: "ring_size_mb"},
+		{name: "negative ring size", modify: func(o *captureSourceOptions) {
+			o.Backend, o.RingSizeMB = captureBackendAFPacket, -1
+		}, wantErr: "ring_size_mb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := valid
+			tt.modify(&options)
+			source, err := dialCaptureHelper(socketPath, options)
+			if err == nil {
+				source.Close()
+				t.Fatal("抓包进程应拒绝打开网卡")
+			}
+			if !strings.Contains(err.Error(), "特权抓包进程无法打开网卡") || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("错误为 %q，应包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateHelperOptions(t *testing.T) {
+	for _, options := range []captureSourceOptions{
+		{Device: "eth0", SnapLen: 1},
+		{Device: "eth0", SnapLen: maxSnapshotLen, Backend: captureBackendPcap, BPFFilter: "tcp"},
+		{Device: "eth0", SnapLen: 1024, Backend: captureBackendAFPacket, RingSizeMB: maxRingSizeMB, FanoutGroup: 7},
+	} {
+		if err := validateHelperOptions(options); err != nil {
+			t.Errorf("%+v 应通过校验: %v", options, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+const (
+	// 多网卡抓包时数据包在合并队列中等待的时间，用于按时间戳重新排序
+	mergeDelay = 100 * time.Millisecond
+	// 合并队列最多保存的数据包数，超出时立即输出最早的数据包
+	mergeQueueLimit = 10000
+	// 不同网卡上内容相同的数据包在该时间内视为重复
+	dedupWindow = 200 * time.Millisecond
+)
+
+// 任务打开的一个网卡
+type captureHandle struct {
+	device string
+	handle captureSource
+}
+
+// 带有来源网卡的数据包
+type sourcePacket struct {
+	device string
+	packet gopacket.Packet
+}
+
+// mergePacketSources 读取所有网卡的数据包，按时间戳合并为一个流并去除重复的数据包。
+// 所有网卡读取结束后关闭返回的通道；done关闭后停止输出
+func mergePacketSources(handles []captureHandle, done <-chan struct{}) <-chan sourcePacket {
+	input := make(chan sourcePacket, 1024)
+	finished := make(chan struct{}, len(handles))
+
+	for _, h := range handles {
+		go func(h captureHandle) {
+			defer func() { finished <- struct{}{} }()
+			packetSource := gopacket.NewPacketSource(h.handle, h.handle.LinkType())
+			// 延迟解码，由流水线的解码协程完成；各数据包来源每次返回新的缓冲区，不需要复制
+			packetSource.DecodeOptions = gopacket.DecodeOptions{Lazy: true, NoCopy: true}
+			for packet := range packetSource.Packets() {
+				select {
+				case input <- sourcePacket{device: h.device, packet: packet}:
+				case <-done:
+					return
+				}
+			}
+		}(h)
+	}
+
+	// 只有一个网卡时不需要排序和去重，数据包不经过合并队列，没有mergeDelay的延迟。
+	// afpacket fanout的多个socket属于同一个网卡，内核按连接分配数据包，同一个数据包不会出现在两个socket上，
+	// 同一个连接的数据包也总是来自同一个socket，顺序不变
+	if singleDevice(handles) {
+		go func() {
+			for range handles {
+				<-finished
+			}
+			close(input)
+		}()
+		return input
+	}
+
+	out := make(chan sourcePacket, 1024)
+	go func() {
+		defer close(out)
+
+		queue := &packetQueue{}
+		dedup := newPacketDeduper()
+		ticker := time.NewTicker(mergeDelay / 4)
+		defer ticker.Stop()
+
+		// 输出已经等待足够久的数据包，all为true时输出全部数据包
+		flush := func(all bool) bool {
+			cutoff := time.Now().Add(-mergeDelay)
+			for queue.Len() > 0 {
+				next := (*queue)[0]
+				if !all && queue.Len() <= mergeQueueLimit && packetTimestamp(next.packet).After(cutoff) {
+					break
+				}
+				heap.Pop(queue)
+				select {
+				case out <- next:
+				case <-done:
+					return false
+				}
+			}
+			return true
+		}
+
+		for remaining := len(handles); remaining > 0; {
+			select {
+			case packet := <-input:
+				if !dedup.duplicate(packet) {
+					heap.Push(queue, packet)
+				}
+				if queue.Len() > mergeQueueLimit && !flush(false) {
+					return
+				}
+			case <-finished:
+				remaining--
+			case <-ticker.C:
+				dedup.expire(time.Now())
+				if !flush(false) {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+
+		// 网卡全部结束后，读取通道中剩余的数据包并全部输出
+		for {
+			select {
+			case packet := <-input:
+				if !dedup.duplicate(packet) {
+					heap.Push(queue, packet)
+				}
+				continue
+			default:
+			}
+			break
+		}
+		flush(true)
+	}()
+	return out
+}
+
+// singleDevice 判断所有来源是否属于同一个网卡
+func singleDevice(handles []captureHandle) bool {
+	for i := 1; i < len(handles); i++ {
+		if handles[i].device != handles[0].device {
+			return false
+		}
+	}
+	return true
+}
+
+// 按时间戳排序的数据包队列，实现heap.Interface
+type packetQueue []sourcePacket
+
+func (q packetQueue) Len() int { return len(q) }
+func (q packetQueue) Less(i, j int) bool {
+	return packetTimestamp(q[i].packet).Before(packetTimestamp(q[j].packet))
+}
+func (q packetQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *packetQueue) Push(x interface{}) { *q = append(*q, x.(sourcePacket)) }
+func (q *packetQueue) Pop() interface{} {
+	old := *q
+	last := old[len(old)-1]
+	old[len(old)-1] = sourcePacket{}
+	*q = old[:len(old)-1]
+	return last
+}
+
+// 数据包去重，例如同时抓取网桥和它的成员网卡时，同一个数据包会在两个网卡上各出现一次
+type packetDeduper struct {
+	seen map[uint64]dedupEntry
+}
+
+type dedupEntry struct {
+	device    string
+	timestamp time.Time
+}
+
+func newPacketDeduper() *packetDeduper {
+	return &packetDeduper{seen: make(map[uint64]dedupEntry)}
+}
+
+// duplicate 判断数据包是否已经在其他网卡上出现过。
+// 比较网络层及以上的内容，不同网卡的链路层头部（如any设备的SLL头）可能不同
+func (d *packetDeduper) duplicate(p sourcePacket) bool {
+	data := p.packet.Data()
+	if network := p.packet.NetworkLayer(); network != nil {
+		data = append(append([]byte(nil), network.LayerContents()...), network.LayerPayload()...)
+	}
+	hash := fnv.New64a()
+	hash.Write(data)
+	key := hash.Sum64()
+
+	timestamp := packetTimestamp(p.packet)
+	if entry, ok := d.seen[key]; ok && entry.device != p.device {
+		diff := timestamp.Sub(entry.timestamp)
+		if diff < dedupWindow && diff > -dedupWindow {
+			return true
+		}
+	}
+	// 同一网卡上的相同数据包（如TCP重传）不视为重复
+	d.seen[key] = dedupEntry{device: p.device, timestamp: timestamp}
+	return false
+}
+
+// expire 清理超出去重时间窗口的记录
+func (d *packetDeduper) expire(now time.Time) {
+	cutoff := now.Add(-2 * dedupWindow)
+	for key, entry := range d.seen {
+		if entry.timestamp.Before(cutoff) {
+			delete(d.seen, key)
+		}
+	}
+}
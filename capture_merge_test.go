@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// 按顺序返回给定数据包的来源，读完后返回io.EOF
+type sliceSource struct {
+	packets [][]byte
+	times   []time.Time
+	next    int
+}
+
+func (s *sliceSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if s.next >= len(s.packets) {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+	data := s.packets[s.next]
+	info := gopacket.CaptureInfo{Timestamp: s.times[s.next], CaptureLength: len(data), Length: len(data)}
+	s.next++
+	return data, info, nil
+}
+
+func (s *sliceSource) LinkType() layers.LinkType { return layers.LinkTypeEthernet }
+func (s *sliceSource) Close()                    {}
+
+// dedupPacket 构造指定时间戳的数据包，srcMAC不同时链路层头部不同
+func dedupPacket(data []byte, timestamp time.Time, srcMAC byte) gopacket.Packet {
+	data = append([]byte(nil), data...)
+	data[11] = srcMAC
+	packet := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+	packet.Metadata().CaptureInfo = gopacket.CaptureInfo{Timestamp: timestamp, CaptureLength: len(data), Length: len(data)}
+	return packet
+}
+
+func TestPacketDeduper(t *testing.T) {
+	packets := newBenchmarkPackets(t)
+	base := time.Unix(1700000000, 0)
+
+	// 按顺序交给同一个去重器
+	steps := []struct {
+		name      string
+		device    string
+		packet    int
+		offset    time.Duration
+		srcMAC    byte
+		duplicate bool
+	}{
+		{name: "first sighting", device: "br0", packet: 0},
+		{name: "same packet on another device", device: "eth0", packet: 0, offset: 50 * time.Millisecond, duplicate: true},
+		{name: "retransmission on the same device", device: "br0", packet: 0, offset: 60 * time.Millisecond},
+		{name: "different link layer header", device: "any", packet: 0, offset: 70 * time.Millisecond, srcMAC: 9, duplicate: true},
+		{name: "different packet", device: "eth0", packet: 1, offset: 80 * time.Millisecond},
+		{name: "earlier timestamp within the window", device: "br0", packet: 1, offset: 10 * time.Millisecond, duplicate: true},
+		{name: "outside the window", device: "eth0", packet: 0, offset: 70*time.Millisecond + dedupWindow},
+		{name: "exactly at the window edge", device: "br0", packet: 0, offset: 70*time.Millisecond + 2*dedupWindow},
+	}
+	dedup := newPacketDeduper()
+	for _, step := range steps {
+		p := sourcePacket{device: step.device, packet: dedupPacket(packets[step.packet], base.Add(step.offset), step.srcMAC)}
+		if got := dedup.duplicate(p); got != step.duplicate {
+			t.Errorf("%s: duplicate = %v, want %v", step.name, got, step.duplicate)
+		}
+	}
+
+	// 过期后不再视为重复
+	dedup.expire(base.Add(time.Hour))
+	if len(dedup.seen) != 0 {
+		t.Fatalf("seen = %d entries after expire", len(dedup.seen))
+	}
+	if dedup.duplicate(sourcePacket{device: "eth0", packet: dedupPacket(packets[0], base.Add(time.Hour), 0)}) {
+		t.Error("packet after expire reported as duplicate")
+	}
+}
+
+func TestMergePacketSources(t *testing.T) {
+	packets := newBenchmarkPackets(t)
+	// 时间戳递减的数据包，合并时会按时间戳重新排序；时间足够早，不需要等待mergeDelay
+	base := time.Now().Add(-time.Hour)
+	source := func(first int) *sliceSource {
+		s := &sliceSource{}
+		for i := 0; i < 3; i++ {
+			s.packets = append(s.packets, packets[first+i])
+			s.times = append(s.times, base.Add(time.Duration(first+10-i)*time.Second))
+		}
+		return s
+	}
+	collect := func(handles []captureHandle) []sourcePacket {
+		done := make(chan struct{})
+		defer close(done)
+		var result []sourcePacket
+		timeout := time.After(5 * time.Second)
+		output := mergePacketSources(handles, done)
+		for {
+			select {
+			case p, ok := <-output:
+				if !ok {
+					return result
+				}
+				result = append(result, p)
+			case <-timeout:
+				t.Fatal("merge did not finish")
+			}
+		}
+	}
+
+	// 同一个网卡的多个来源（如fanout）不合并，每个来源内的顺序不变
+	result := collect([]captureHandle{{device: "eth0", handle: source(0)}, {device: "eth0", handle: source(100)}})
+	if len(result) != 6 {
+		t.Fatalf("single device: got %d packets, want 6", len(result))
+	}
+	last := map[time.Duration]time.Time{}
+	for _, p := range result {
+		ts := packetTimestamp(p.packet)
+		group := ts.Sub(base) / (50 * time.Second)
+		if previous, ok := last[group]; ok && ts.After(previous) {
+			t.Errorf("single device: packets were reordered")
+		}
+		last[group] = ts
+	}
+
+	// 多个网卡按时间戳合并
+	result = collect([]captureHandle{{device: "eth0", handle: source(0)}, {device: "eth1", handle: source(100)}})
+	if len(result) != 6 {
+		t.Fatalf("multiple devices: got %d packets, want 6", len(result))
+	}
+	for i := 1; i < len(result); i++ {
+		if packetTimestamp(result[i].packet).Before(packetTimestamp(result[i-1].packet)) {
+			t.Errorf("multiple devices: packet %d is out of order", i)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"abc/a/util"
+	"runtime"
+	"sync"
+
+	"github.com/google/gopacket"
+)
+
+// 每个解码协程的队列长度
+const pipelineQueueSize = 1024
+
+// 解码协程数量上限，可通过配置文件的limits调整，启动后只读
+var maxDecodeWorkers = 64
+
+// 等待解码的数据包，config为读取时的过滤条件
+type pipelineJob struct {
+	packet gopacket.Packet
+	device string
+	config CaptureConfig
+}
+
+// 解码后匹配的请求
+type pipelineResult struct {
+	info   PacketInfo
+	config CaptureConfig
+}
+
+// 数据包处理流水线：读取协程按流的哈希值把数据包分给解码协程，同一个连接的数据包总是由同一个协程按顺序解码；
+// 解码结果由唯一的输出协程保存和广播。不同连接的请求之间不保证按抓取顺序保存
+type packetPipeline struct {
+	task    *captureTask
+	queues  []chan pipelineJob
+	results chan pipelineResult
+	workers sync.WaitGroup
+	done    chan struct{} // 输出协程处理完所有结果后关闭
+}
+
+// decodeWorkerCount 返回任务的解码协程数量，未设置时与可用CPU数量相同
+func decodeWorkerCount(config CaptureConfig) int {
+	workers := config.DecodeWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > maxDecodeWorkers {
+		workers = maxDecodeWorkers
+	}
+	return workers
+}
+
+// newPacketPipeline 启动解码协程和输出协程
+func newPacketPipeline(task *captureTask, workers int) *packetPipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &packetPipeline{
+		task:    task,
+		queues:  make([]chan pipelineJob, workers),
+		results: make(chan pipelineResult, pipelineQueueSize),
+		done:    make(chan struct{}),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan pipelineJob, pipelineQueueSize)
+		p.workers.Add(1)
+		go p.decode(p.queues[i])
+	}
+	go p.sink()
+	return p
+}
+
+// submit 把数据包交给对应的解码协程，队列已满时阻塞
+func (p *packetPipeline) submit(packet gopacket.Packet, device string, config CaptureConfig) {
+	queue := p.queues[flowHash(packet)%uint64(len(p.queues))]
+	queue <- pipelineJob{packet: packet, device: device, config: config}
+}
+
+// close 等待所有已提交的数据包处理完成
+func (p *packetPipeline) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.workers.Wait()
+	close(p.results)
+	<-p.done
+}
+
+// decode 解码协程，只解析数据包，不修改任务的结果。
+// 每个协程使用自己的连接状态（TCP序号和等待响应的请求），协程之间没有共享的锁
+func (p *packetPipeline) decode(queue <-chan pipelineJob) {
+	defer p.workers.Done()
+	state := newDecodeState(len(p.queues))
+	for job := range queue {
+		if info, ok := decodePacket(job.packet, job.device, p.task, job.config, state); ok {
+			p.results <- pipelineResult{info: info, config: job.config}
+		}
+	}
+}
+
+// sink 输出协程，保存并广播匹配的请求，达到停止条件时停止任务
+func (p *packetPipeline) sink() {
+	defer close(p.done)
+	stopped := false
+	for result := range p.results {
+		// 停止后继续读取，避免解码协程阻塞
+		if stopped {
+			continue
+		}
+		storePacket(p.task, result.info)
+		if reason := p.task.stopConditionReached(result.config); reason != "" {
+			stopped = true
+			util.Log.Logger.Info("抓包任务达到停止条件: %s, 任务ID: %s", reason, p.task.id)
+			// finishTask关闭网卡，读取协程随之退出
+			finishTask(p.task, reason)
+		}
+	}
+}
+
+// flowHash 计算数据包所属连接的哈希值，两个方向的数据包哈希值相同
+func flowHash(packet gopacket.Packet) uint64 {
+	var hash uint64
+	if network := packet.NetworkLayer(); network != nil {
+		hash = network.NetworkFlow().FastHash()
+	}
+	if transport := packet.TransportLayer(); transport != nil {
+		hash = hash*31 + transport.TransportFlow().FastHash()
+	}
+	return hash
+}
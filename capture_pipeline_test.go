@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// 基准测试使用的连接数量，数据包轮流属于这些连接
+const benchmarkFlows = 256
+
+// newBenchmarkPackets 生成benchmarkFlows个连接上的HTTP请求数据包
+func newBenchmarkPackets(b testing.TB) [][]byte {
+	packets := make([][]byte, benchmarkFlows)
+	for i := range packets {
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip := &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: layers.IPProtocolTCP,
+			SrcIP:    net.IPv4(10, 0, byte(i>>8), byte(i)),
+			DstIP:    net.IPv4(10, 1, 0, 1),
+		}
+		tcp := &layers.TCP{SrcPort: layers.TCPPort(40000 + i), DstPort: 80, Seq: 1, ACK: true, PSH: true, Window: 65535}
+		tcp.SetNetworkLayerForChecksum(ip)
+		payload := fmt.Sprintf("POST /api/v1/items/%d HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\n"+
+			"User-Agent: benchmark\r\nContent-Length: 27\r\n\r\n{\"id\": %d, \"name\": \"item\"}", i, i)
+
+		buffer := gopacket.NewSerializeBuffer()
+		options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buffer, options, eth, ip, tcp, gopacket.Payload(payload)); err != nil {
+			b.Fatal(err)
+		}
+		packets[i] = buffer.Bytes()
+	}
+	return packets
+}
+
+// newBenchmarkPacket 按抓包时的解码方式构造数据包
+func newBenchmarkPacket(data []byte) gopacket.Packet {
+	packet := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	packet.Metadata().CaptureInfo = gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(data), Length: len(data)}
+	return packet
+}
+
+func newBenchmarkTask() *captureTask {
+	return &captureTask{id: "benchmark", running: true, packets: make([]PacketInfo, 0)}
+}
+
+// BenchmarkProcessPacketSequential 单协程逐个处理数据包
+func BenchmarkProcessPacketSequential(b *testing.B) {
+	packets := newBenchmarkPackets(b)
+	task := newBenchmarkTask()
+	config := CaptureConfig{Protocols: []string{"http"}, ContainsFilter: "item"}
+
+	state := newDecodeState(1)
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		processPacket(newBenchmarkPacket(packets[i%len(packets)]), "eth0", task, config, state)
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "packets/s")
+}
+
+// BenchmarkPacketPipeline 通过按流分配的解码流水线处理数据包
+func BenchmarkPacketPipeline(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			packets := newBenchmarkPackets(b)
+			task := newBenchmarkTask()
+			config := CaptureConfig{Protocols: []string{"http"}, ContainsFilter: "item"}
+
+			b.ResetTimer()
+			start := time.Now()
+			pipeline := newPacketPipeline(task, workers)
+			for i := 0; i < b.N; i++ {
+				pipeline.submit(newBenchmarkPacket(packets[i%len(packets)]), "eth0", config)
+			}
+			pipeline.close()
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "packets/s")
+
+			if got := task.matchedRequests.Load(); got != int64(b.N) {
+				b.Fatalf("匹配的请求数为 %d，期望 %d", got, b.N)
+			}
+		})
+	}
+}
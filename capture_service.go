@@ -2,13 +2,16 @@ package main
 
 import (
 	"abc/a/util"
+	"fmt"
+	"math/rand"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/gopacket/pcap"
 )
 
 // 单任务模式变量
@@ -17,192 +20,576 @@ var (
 	CurrentTask *captureTask
 	// TaskMutex 任务访问互斥锁
 	TaskMutex = &sync.Mutex{}
+	// finishedTasks 最近结束的任务，按结束顺序保存，用于断线重连后按任务ID补发数据
+	finishedTasks []*captureTask
+	// snapshotTasks 正在运行的快照任务，与当前任务互不影响
+	snapshotTasks = make(map[string]*captureTask)
+	// captureStarting 已有任务通过检查、正在打开网卡，尚未设置为CurrentTask
+	captureStarting bool
 )
 
-// ListDevices 列出所有网卡设备
-func ListDevices(c *gin.Context) {
-	devices, err := pcap.FindAllDevs()
-	if err != nil {
-		util.Log.Logger.Error("获取设备列表失败: %v, IP: %s", err, c.ClientIP())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	util.Log.Logger.Info("获取设备列表成功，设备数量: %d, IP: %s", len(devices), c.ClientIP())
+// 保留的已结束任务数量
+const maxFinishedTasks = 10
 
-	// 提取设备名称列表
-	var deviceNames []string
-	for _, device := range devices {
-		if !strings.Contains(device.Name, "utun") {
-			deviceNames = append(deviceNames, device.Name)
-		}
+// 抓包任务停止原因
+const (
+	stopReasonManual      = "manual"        // 用户手动停止
+	stopReasonMaxDuration = "max_duration"  // 达到最长抓包时间
+	stopReasonMaxRequests = "max_requests"  // 达到最多匹配请求数
+	stopReasonMaxBytes    = "max_bytes"     // 达到最多读取字节数
+	stopReasonFirstMatch  = "first_match"   // 已匹配到第一个请求
+	stopReasonSourceEnded = "source_ended"  // 网卡读取结束或出错
+	stopReasonSnapshot    = "snapshot_done" // 快照任务已抓完触发后的时间窗口
+)
 
-	}
+// 抓包任务操作失败时的错误，携带对应的HTTP状态码
+type captureError struct {
+	status  int
+	message string
+	hint    string
+	details interface{}  // 附加的诊断信息，如权限检查结果
+	fields  []fieldError // 抓包配置的字段错误
+}
 
-	c.JSON(http.StatusOK, gin.H{"devices": deviceNames})
+func (e *captureError) Error() string {
+	return e.message
+}
+
+// 抓包过滤条件更新，字段为nil时保持原值
+type captureFilterUpdate struct {
+	Protocols      *[]string `json:"protocols"`
+	PathFilter     *string   `json:"path_filter"`
+	ContainsFilter *string   `json:"contains_filter"`
+}
+
+// newTaskID 生成抓包任务ID
+func newTaskID() string {
+	return "task_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+// respondCaptureError 将抓包任务错误写入HTTP响应
+func respondCaptureError(c *gin.Context, err error) {
+	if ce, ok := err.(*captureError); ok {
+		response := gin.H{"error": ce.message}
+		if ce.hint != "" {
+			response["hint"] = ce.hint
+		}
+		if ce.details != nil {
+			response["details"] = ce.details
+		}
+		if len(ce.fields) > 0 {
+			response["errors"] = ce.fields
+		}
+		c.JSON(ce.status, response)
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
 
 // StartCapture 开始抓包任务
 func StartCapture(c *gin.Context) {
 	var config CaptureConfig
-	if err := c.ShouldBindJSON(&config); err != nil {
-		util.Log.Logger.Error("参数绑定失败: %v, IP: %s", err, c.ClientIP())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindCaptureConfig(c, &config) {
 		return
 	}
-	util.Log.Logger.Info("接收启动抓包请求，设备: %s, 过滤器: %s, IP: %s", config.DeviceName, c.ClientIP())
-	if !test(c.ClientIP()) {
-		util.Log.Logger.Error("未开启网络采集权限，IP: %s", c.ClientIP())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "未开启网络采集权限"})
+
+	task, err := startCaptureTask(config, c.RemoteIP(), manualOrigin(requestIdentity(c)))
+	if err != nil {
+		respondCaptureError(c, err)
 		return
 	}
 
-	// 检查是否已经有任务在运行
+	// 返回填入默认值后实际使用的配置
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": task.id,
+		"message": "抓包任务已启动",
+		"config":  task.config,
+	})
+}
+
+// startCaptureTask 填入默认值并校验配置后启动抓包任务，成功或失败都记录审计日志
+func startCaptureTask(config CaptureConfig, requestIP string, origin taskOrigin) (*captureTask, error) {
+	var task *captureTask
+	err := invalidConfigError(normalizeCaptureConfig(&config))
+	if err == nil {
+		task, err = openCaptureTask(config, requestIP, origin)
+	} else {
+		util.Log.Logger.Warn("%v, IP: %s", err, requestIP)
+	}
+	entry := AuditEntry{Action: auditActionStart, Config: &config, Error: auditError(err)}
+	if task != nil {
+		entry.TaskID = task.id
+	}
+	recordAudit(originActor(origin, requestIP), entry)
+	return task, err
+}
+
+// openCaptureTask 校验权限和设备后启动新的抓包任务，config应已经过normalizeCaptureConfig处理。
+// requestIP为发起请求的客户端IP，origin记录任务由谁创建
+func openCaptureTask(config CaptureConfig, requestIP string, origin taskOrigin) (*captureTask, error) {
+	deviceNames := config.devices()
+	util.Log.Logger.Info("接收启动抓包请求，设备: %s, IP: %s", strings.Join(deviceNames, ","), requestIP)
+	if err := checkCapturePermission(requestIP); err != nil {
+		return nil, err
+	}
+
+	// 检查是否已经有任务在运行或正在启动，并占用启动名额直到任务设置为CurrentTask或启动失败。
+	// 计划任务、触发器和WebSocket指令可能同时启动任务，打开网卡较慢，不占用名额时后启动的任务会覆盖CurrentTask
 	TaskMutex.Lock()
-	if CurrentTask != nil && CurrentTask.running {
+	if captureStarting || (CurrentTask != nil && CurrentTask.running) {
 		TaskMutex.Unlock()
-		util.Log.Logger.Warn("已有抓包任务在运行，拒绝新的抓包请求，IP: %s", c.ClientIP())
-		c.JSON(http.StatusConflict, gin.H{"error": "已有抓包任务在运行，请先停止当前任务"})
-		return
+		util.Log.Logger.Warn("已有抓包任务在运行，拒绝新的抓包请求，IP: %s", requestIP)
+		return nil, &captureError{status: http.StatusConflict, message: "已有抓包任务在运行，请先停止当前任务"}
 	}
+	captureStarting = true
 	TaskMutex.Unlock()
+	started := false
+	defer func() {
+		if !started {
+			TaskMutex.Lock()
+			captureStarting = false
+			TaskMutex.Unlock()
+		}
+	}()
 
 	// 检查设备是否存在
-	devices, err := pcap.FindAllDevs()
+	deviceErrs, err := captureDeviceErrors(config)
 	if err != nil {
-		util.Log.Logger.Error("无法获取设备列表: %v, IP: %s", err, c.ClientIP())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法获取设备列表: " + err.Error()})
-		return
+		util.Log.Logger.Error("无法获取设备列表: %v, IP: %s", err, requestIP)
+		return nil, &captureError{status: http.StatusInternalServerError, message: "无法获取设备列表: " + err.Error()}
 	}
-
-	deviceExists := false
-	for _, device := range devices {
-		if device.Name == config.DeviceName {
-			deviceExists = true
-			break
-		}
+	if len(deviceErrs) > 0 {
+		util.Log.Logger.Error("%s, IP: %s", deviceErrs[0].Message, requestIP)
+		return nil, &captureError{status: http.StatusBadRequest, message: deviceErrs[0].Message, fields: deviceErrs}
 	}
-
-	if !deviceExists {
-		util.Log.Logger.Error("指定的网卡设备不存在: %s, IP: %s", config.DeviceName, c.ClientIP())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "指定的网卡设备不存在"})
-		return
-	}
-
-	// 检查是否有网络监控权限
-	if !hasNetworkCapturePermission() {
-		// 检查是否是本机请求（127.0.0.1、localhost 或本机IP）
-		requestIP := c.ClientIP()
-		isLocalRequest := requestIP == "127.0.0.1" || requestIP == "localhost" || requestIP == util.GetLocalIP()
-
-		// 在后台线程提示用户，避免阻塞API响应
-		go func() {
-			promptUserForPermission(isLocalRequest)
-		}()
-
-		util.Log.Logger.Warn("需要网络监控权限才能抓包，请求IP: %s", c.ClientIP())
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "需要网络监控权限才能抓包，请在系统设置中授予权限",
-			"hint":  "在macOS上，请前往系统设置 > 隐私与安全性 > 网络监控，添加并启用本程序",
-		})
-		return
+	compiledRedaction, err := newRedactor(config.Redaction)
+	if err != nil {
+		return nil, &captureError{status: http.StatusBadRequest, message: err.Error()}
 	}
 
-	// 打开网络设备
+	// 打开网络设备，任一网卡打开失败时关闭已打开的网卡。
+	// afpacket后端的每个网卡可以打开多个socket组成fanout组，各自由单独的协程读取
 	timeout := time.Duration(config.Timeout) * time.Second
-	handle, err := pcap.OpenLive(config.DeviceName, config.SnapshotLen, config.Promiscuous, timeout)
-	if err != nil {
-		util.Log.Logger.Error("无法打开网卡设备: %v, 设备: %s, IP: %s", err, config.DeviceName, c.ClientIP())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法打开网卡设备: " + err.Error()})
-		return
+	workers := 1
+	if config.FanoutWorkers > 1 {
+		workers = config.FanoutWorkers
+	}
+	handles := make([]captureHandle, 0, len(deviceNames)*workers)
+	for _, deviceName := range deviceNames {
+		options := captureSourceOptions{
+			Device:      deviceName,
+			SnapLen:     config.SnapshotLen,
+			Promiscuous: config.Promiscuous,
+			Timeout:     timeout,
+			Backend:     config.Backend,
+			RingSizeMB:  config.RingSizeMB,
+		}
+		if workers > 1 {
+			options.FanoutGroup = uint16(rand.Intn(65535) + 1)
+		}
+		for i := 0; i < workers; i++ {
+			handle, err := openCaptureSource(options)
+			if err != nil {
+				for _, h := range handles {
+					h.handle.Close()
+				}
+				util.Log.Logger.Error("无法打开网卡设备: %v, 设备: %s, IP: %s", err, deviceName, requestIP)
+				return nil, &captureError{status: http.StatusInternalServerError, message: "无法打开网卡设备 " + deviceName + ": " + err.Error()}
+			}
+			handles = append(handles, captureHandle{device: deviceName, handle: handle})
+		}
+		util.Log.Logger.Info("成功打开网卡设备: %s, 后端: %s, socket数: %d, IP: %s", deviceName, config.Backend, workers, requestIP)
 	}
-	util.Log.Logger.Info("成功打开网卡设备: %s, IP: %s", config.DeviceName, c.ClientIP())
 
 	// 创建并保存抓包任务
 	task := &captureTask{
-		config:  config,
-		packets: make([]PacketInfo, 0),
-		handle:  handle,
-		running: true,
+		id:        newTaskID(),
+		origin:    origin,
+		config:    config,
+		packets:   make([]PacketInfo, 0),
+		handles:   handles,
+		running:   true,
+		redactor:  compiledRedaction,
+		startedAt: time.Now(),
 	}
 
 	TaskMutex.Lock()
+	if config.MaxDuration > 0 {
+		task.durationTimer = time.AfterFunc(time.Duration(config.MaxDuration)*time.Second, func() {
+			util.Log.Logger.Info("抓包任务达到最长抓包时间 %d 秒，任务ID: %s", config.MaxDuration, task.id)
+			finishTask(task, stopReasonMaxDuration)
+		})
+	}
 	CurrentTask = task
+	captureStarting = false
+	started = true
 	TaskMutex.Unlock()
 
 	// 启动异步抓包
 	go startCapturing(task)
+	go reportTaskStats(task)
 
 	// 广播任务启动状态
-	go BroadcastTaskStatus(gin.H{
+	BroadcastTaskStatus(gin.H{
+		"task_id": task.id,
 		"running": true,
 		"message": "抓包任务已启动",
 		"config":  config,
+		"origin":  origin,
 	})
 
-	util.Log.Logger.Info("抓包任务已成功启动，设备: %s, 过滤器: %s, IP: %s", config.DeviceName, c.ClientIP())
-	c.JSON(http.StatusOK, gin.H{
-		"message": "抓包任务已启动",
-		"config":  config,
-	})
+	util.Log.Logger.Info("抓包任务已成功启动，任务ID: %s, 来源: %s, 设备: %s, IP: %s", task.id, origin.Type, strings.Join(deviceNames, ","), requestIP)
+	return task, nil
 }
 
-// GetCaptureResults 获取抓包结果
+// GetCaptureResults 获取抓包结果，查询参数task_id可指定最近结束的任务，为空时返回当前任务
 func GetCaptureResults(c *gin.Context) {
-	TaskMutex.Lock()
-	if CurrentTask == nil {
-		TaskMutex.Unlock()
+	if task, packets, ok := captureResults(c); ok {
+		c.JSON(http.StatusOK, resultsResponse(task, packets))
+	}
+}
+
+// ExportCaptureResults 以附件形式导出全部抓包结果并记录审计日志，参数与GetCaptureResults相同
+func ExportCaptureResults(c *gin.Context) {
+	task, packets, ok := captureResults(c)
+	if !ok {
+		return
+	}
+	recordAudit(actorFromContext(c), AuditEntry{Action: auditActionExport, TaskID: task.id, Target: "results", Counts: map[string]int64{"packets": int64(len(packets))}})
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", task.id+".json"))
+	c.JSON(http.StatusOK, resultsResponse(task, packets))
+}
+
+// captureResults 返回查询的任务和数据包的副本，任务不存在时返回404
+func captureResults(c *gin.Context) (*captureTask, []PacketInfo, bool) {
+	task := findTask(c.Query("task_id"))
+	if task == nil {
 		util.Log.Logger.Error("没有正在运行的抓包任务，IP: %s", c.ClientIP())
 		c.JSON(http.StatusNotFound, gin.H{"error": "没有正在运行的抓包任务"})
-		return
+		return nil, nil, false
 	}
-	task := CurrentTask
-	TaskMutex.Unlock()
 
 	task.packetsMu.Lock()
 	packets := make([]PacketInfo, len(task.packets))
 	copy(packets, task.packets)
 	task.packetsMu.Unlock()
 
+	// parse_body=true时按Content-Type解析每个请求的内容
+	if c.Query("parse_body") == "true" {
+		options := bodyParseOptions{ProtobufMessage: c.Query("message")}
+		for i := range packets {
+			packets[i].ParsedBody = parseRequestBody(packets[i], options)
+		}
+	}
+	return task, packets, true
+}
+
+// resultsResponse 返回任务状态和数据包列表
+func resultsResponse(task *captureTask, packets []PacketInfo) gin.H {
+	response := task.status()
+	response["count"] = len(packets)
+	response["packets"] = packets
+	return response
+}
+
+// StopCapture 停止抓包任务，查询参数task_id可指定运行中的快照任务，为空时停止当前任务
+func StopCapture(c *gin.Context) {
+	task, capturedPackets, err := stopCaptureTask(actorFromContext(c), c.Query("task_id"))
+	if err != nil {
+		respondCaptureError(c, err)
+		return
+	}
+
+	util.Log.Logger.Info("抓包任务已停止，共捕获 %d 个数据包，IP: %s", capturedPackets, c.ClientIP())
 	c.JSON(http.StatusOK, gin.H{
-		"running": task.running,
-		"count":   len(packets),
-		"packets": packets,
+		"task_id":          task.id,
+		"message":          "抓包任务已停止",
+		"captured_packets": capturedPackets,
 	})
 }
 
-// StopCapture 停止抓包任务
-func StopCapture(c *gin.Context) {
-	TaskMutex.Lock()
-	if CurrentTask == nil {
-		TaskMutex.Unlock()
-		c.JSON(http.StatusNotFound, gin.H{"error": "没有正在运行的抓包任务"})
+// PauseCapture 暂停当前抓包任务
+func PauseCapture(c *gin.Context) {
+	setPausedHandler(c, true)
+}
+
+// ResumeCapture 恢复当前抓包任务
+func ResumeCapture(c *gin.Context) {
+	setPausedHandler(c, false)
+}
+
+// setPausedHandler 暂停或恢复抓包任务的处理函数
+func setPausedHandler(c *gin.Context, paused bool) {
+	task, err := setCapturePaused(paused)
+	if err != nil {
+		respondCaptureError(c, err)
 		return
 	}
+
+	message := "抓包任务已恢复"
+	if paused {
+		message = "抓包任务已暂停"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": task.id,
+		"paused":  paused,
+		"message": message,
+	})
+}
+
+// stopCaptureTask 手动停止当前任务或指定ID的快照任务，返回被停止的任务及其捕获的数据包数量
+func stopCaptureTask(actor auditActor, taskID string) (*captureTask, int, error) {
+	TaskMutex.Lock()
 	task := CurrentTask
+	if taskID != "" {
+		task = snapshotTasks[taskID]
+		if CurrentTask != nil && CurrentTask.id == taskID {
+			task = CurrentTask
+		}
+	}
+	TaskMutex.Unlock()
+
+	if task == nil {
+		return nil, 0, &captureError{status: http.StatusNotFound, message: "没有正在运行的抓包任务"}
+	}
+	capturedPackets, ok := finishTask(task, stopReasonManual)
+	if !ok {
+		return nil, 0, &captureError{status: http.StatusNotFound, message: "没有正在运行的抓包任务"}
+	}
+	recordAudit(actor, AuditEntry{Action: auditActionStop, TaskID: task.id, Detail: stopReasonManual, Counts: taskCounts(task)})
+	return task, capturedPackets, nil
+}
+
+// finishTask 停止指定任务并记录停止原因，关闭网卡并广播停止状态。
+// 返回任务捕获的数据包数量；任务已经停止过时返回false
+func finishTask(task *captureTask, reason string) (int, bool) {
+	TaskMutex.Lock()
+	if task.stopReason != "" {
+		TaskMutex.Unlock()
+		return 0, false
+	}
 
 	// 停止任务
 	task.running = false
-	if task.handle != nil {
-		task.handle.Close()
+	task.stopReason = reason
+	task.stoppedAt = time.Now()
+	if task.durationTimer != nil {
+		task.durationTimer.Stop()
 	}
+	// 取出网卡，之后其他协程不会再访问它们；读取统计和关闭网卡可能较慢（如通过特权抓包进程），在锁外进行
+	handles := task.handles
+	task.handles = nil
 
+	// 清除当前运行任务
+	if CurrentTask == task {
+		CurrentTask = nil
+	}
+	delete(snapshotTasks, task.id)
+	retainFinishedTask(task)
+	TaskMutex.Unlock()
+
+	// 关闭网卡前保存最终统计
+	finalStats := collectSourceStats(handles)
+	for _, h := range handles {
+		h.handle.Close()
+	}
+	TaskMutex.Lock()
+	task.finalSourceStats = finalStats
+	TaskMutex.Unlock()
+
+	task.packetsMu.Lock()
 	capturedPackets := len(task.packets)
+	task.packetsMu.Unlock()
 
-	// 清除当前运行任务
-	// 注意：已经在函数开始时获取了锁，这里不需要再次获取
-	CurrentTask = nil
-	TaskMutex.Unlock() // 只解锁一次
+	util.Log.Logger.Info("抓包任务已停止，任务ID: %s, 原因: %s, 共捕获 %d 个数据包", task.id, reason, capturedPackets)
+	// 手动停止由stopCaptureTask记录执行者
+	if reason != stopReasonManual {
+		recordAudit(auditActor{User: auditUserSystem}, AuditEntry{Action: auditActionStop, TaskID: task.id, Detail: reason, Counts: taskCounts(task)})
+	}
 
 	// 广播任务停止状态
-	go BroadcastTaskStatus(gin.H{
+	BroadcastTaskStatus(gin.H{
+		"task_id":          task.id,
 		"running":          false,
 		"message":          "抓包任务已停止",
+		"stop_reason":      reason,
 		"captured_packets": capturedPackets,
+		"stats":            task.stats(),
 	})
 
-	util.Log.Logger.Info("抓包任务已停止，共捕获 %d 个数据包，IP: %s", capturedPackets, c.ClientIP())
-	c.JSON(http.StatusOK, gin.H{
-		"message":          "抓包任务已停止",
-		"captured_packets": capturedPackets,
+	return capturedPackets, true
+}
+
+// stopConditionReached 检查任务是否达到自动停止条件，返回停止原因，未达到时返回空字符串
+func (task *captureTask) stopConditionReached(config CaptureConfig) string {
+	matched := task.matchedRequests.Load()
+	if config.StopOnFirstMatch && matched > 0 {
+		return stopReasonFirstMatch
+	}
+	if config.MaxRequests > 0 && matched >= int64(config.MaxRequests) {
+		return stopReasonMaxRequests
+	}
+	if config.MaxBytes > 0 && task.capturedBytes.Load() >= config.MaxBytes {
+		return stopReasonMaxBytes
+	}
+	return ""
+}
+
+// status 返回任务的状态信息
+func (task *captureTask) status() gin.H {
+	TaskMutex.Lock()
+	response := gin.H{
+		"task_id":    task.id,
+		"origin":     task.origin,
+		"running":    task.running,
+		"paused":     task.paused,
+		"config":     task.config,
+		"started_at": task.startedAt,
+	}
+	if task.stopReason != "" {
+		response["stopped_at"] = task.stoppedAt
+		response["stop_reason"] = task.stopReason
+	}
+	TaskMutex.Unlock()
+
+	response["matched_requests"] = task.matchedRequests.Load()
+	response["captured_bytes"] = task.capturedBytes.Load()
+	response["stats"] = task.stats()
+	return response
+}
+
+// retainFinishedTask 保留已结束的任务，超出数量时丢弃最早的任务，调用方需持有TaskMutex
+func retainFinishedTask(task *captureTask) {
+	finishedTasks = append(finishedTasks, task)
+	if len(finishedTasks) > maxFinishedTasks {
+		finishedTasks = finishedTasks[len(finishedTasks)-maxFinishedTasks:]
+	}
+}
+
+// findTask 按ID查找当前任务、快照任务或最近结束的任务，ID为空时返回当前任务
+func findTask(taskID string) *captureTask {
+	TaskMutex.Lock()
+	defer TaskMutex.Unlock()
+
+	if taskID == "" || (CurrentTask != nil && CurrentTask.id == taskID) {
+		return CurrentTask
+	}
+	if task, ok := snapshotTasks[taskID]; ok {
+		return task
+	}
+	for i := len(finishedTasks) - 1; i >= 0; i-- {
+		if finishedTasks[i].id == taskID {
+			return finishedTasks[i]
+		}
+	}
+	return nil
+}
+
+// findPacket 按序号查找任务中的数据包，数据包按序号递增保存
+func (task *captureTask) findPacket(seq uint64) (PacketInfo, bool) {
+	task.packetsMu.Lock()
+	defer task.packetsMu.Unlock()
+
+	i := sort.Search(len(task.packets), func(i int) bool { return task.packets[i].Seq >= seq })
+	if i < len(task.packets) && task.packets[i].Seq == seq {
+		return task.packets[i], true
+	}
+	return PacketInfo{}, false
+}
+
+// runningTask 返回当前运行中的任务，调用方需持有TaskMutex
+func runningTask() (*captureTask, error) {
+	if CurrentTask == nil || !CurrentTask.running {
+		return nil, &captureError{status: http.StatusNotFound, message: "没有正在运行的抓包任务"}
+	}
+	return CurrentTask, nil
+}
+
+// setCapturePaused 暂停或恢复当前抓包任务，暂停期间网卡保持打开但丢弃所有数据包
+func setCapturePaused(paused bool) (*captureTask, error) {
+	TaskMutex.Lock()
+	task, err := runningTask()
+	if err != nil {
+		TaskMutex.Unlock()
+		return nil, err
+	}
+	task.paused = paused
+	TaskMutex.Unlock()
+
+	message := "抓包任务已恢复"
+	if paused {
+		message = "抓包任务已暂停"
+	}
+	util.Log.Logger.Info("%s，任务ID: %s", message, task.id)
+
+	BroadcastTaskStatus(gin.H{
+		"task_id": task.id,
+		"running": true,
+		"paused":  paused,
+		"message": message,
+	})
+	return task, nil
+}
+
+// clearCapturePackets 清空当前任务已捕获的数据包，返回被清除的数量
+func clearCapturePackets(actor auditActor) (*captureTask, int, error) {
+	TaskMutex.Lock()
+	task, err := runningTask()
+	TaskMutex.Unlock()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	task.packetsMu.Lock()
+	cleared := len(task.packets)
+	task.packets = make([]PacketInfo, 0)
+	task.packetsMu.Unlock()
+
+	util.Log.Logger.Info("已清空抓包结果 %d 条，任务ID: %s", cleared, task.id)
+	recordAudit(actor, AuditEntry{Action: auditActionDelete, TaskID: task.id, Target: "results", Counts: map[string]int64{"packets": int64(cleared)}})
+	BroadcastTaskStatus(gin.H{
+		"task_id": task.id,
+		"running": true,
+		"message": "抓包结果已清空",
+		"cleared": cleared,
+	})
+	return task, cleared, nil
+}
+
+// updateCaptureFilter 校验并修改当前任务的协议、路径和内容过滤条件，对之后捕获的数据包生效
+func updateCaptureFilter(update captureFilterUpdate) (*captureTask, CaptureConfig, error) {
+	if update.Protocols != nil {
+		protocols := normalizeProtocols(*update.Protocols)
+		update.Protocols = &protocols
+	}
+	if err := invalidConfigError(update.validate()); err != nil {
+		return nil, CaptureConfig{}, err
+	}
+
+	TaskMutex.Lock()
+	task, err := runningTask()
+	if err != nil {
+		TaskMutex.Unlock()
+		return nil, CaptureConfig{}, err
+	}
+	if update.Protocols != nil {
+		task.config.Protocols = *update.Protocols
+	}
+	if update.PathFilter != nil {
+		task.config.PathFilter = *update.PathFilter
+	}
+	if update.ContainsFilter != nil {
+		task.config.ContainsFilter = *update.ContainsFilter
+	}
+	config := task.config
+	TaskMutex.Unlock()
+
+	util.Log.Logger.Info("抓包过滤条件已更新，任务ID: %s, 路径: %s, 内容: %s", task.id, config.PathFilter, config.ContainsFilter)
+	BroadcastTaskStatus(gin.H{
+		"task_id": task.id,
+		"running": true,
+		"message": "抓包过滤条件已更新",
+		"config":  config,
 	})
+	return task, config, nil
 }
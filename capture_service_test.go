@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// fakeCaptureHelper 模拟特权抓包进程：每次打开网卡前等待delay，打开后不发送数据包，直到连接关闭。
+// 返回socket路径和收到的打开请求数
+func fakeCaptureHelper(t *testing.T, delay time.Duration) (string, *atomic.Int32) {
+	socketPath := filepath.Join(t.TempDir(), "capture.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	opened := &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				// 检查权限时只建立连接
+				if _, err := reader.ReadBytes('\n'); err != nil {
+					return
+				}
+				opened.Add(1)
+				time.Sleep(delay)
+				conn.Write([]byte(`{"ok":true,"link_type":1}` + "\n"))
+				io.Copy(io.Discard, reader)
+			}()
+		}
+	}()
+	return socketPath, opened
+}
+
+func TestOpenCaptureTaskConcurrentStart(t *testing.T) {
+	socketPath, opened := fakeCaptureHelper(t, 200*time.Millisecond)
+	originalSocket, originalFind := captureHelperSocket, findCaptureDevices
+	captureHelperSocket = socketPath
+	findCaptureDevices = func() ([]pcap.Interface, error) { return []pcap.Interface{{Name: "eth0"}}, nil }
+	t.Cleanup(func() { captureHelperSocket, findCaptureDevices = originalSocket, originalFind })
+
+	config := CaptureConfig{DeviceName: "eth0"}
+	if errs := normalizeCaptureConfig(&config); len(errs) != 0 {
+		t.Fatalf("配置无效: %v", fieldCodes(errs))
+	}
+
+	// 两个请求同时启动，只有一个可以成功，另一个返回409
+	var wg sync.WaitGroup
+	tasks := make([]*captureTask, 2)
+	errs := make([]error, 2)
+	for i := range tasks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tasks[i], errs[i] = openCaptureTask(config, "", taskOrigin{Type: "manual"})
+		}(i)
+	}
+	wg.Wait()
+
+	var started *captureTask
+	conflicts := 0
+	for i := range tasks {
+		switch {
+		case errs[i] == nil:
+			if started != nil {
+				t.Fatal("两个任务都启动成功")
+			}
+			started = tasks[i]
+		case errs[i].(*captureError).status == http.StatusConflict:
+			conflicts++
+		default:
+			t.Fatalf("启动失败: %v", errs[i])
+		}
+	}
+	if started == nil || conflicts != 1 {
+		t.Fatalf("应有一个任务启动成功、一个返回409，实际成功 %v，冲突 %d 个", started != nil, conflicts)
+	}
+	if got := opened.Load(); got != 1 {
+		t.Errorf("抓包进程收到 %d 个打开请求，应为1", got)
+	}
+	if current := findTask(""); current != started {
+		t.Errorf("CurrentTask 不是启动成功的任务")
+	}
+
+	// 停止后可以再次启动
+	if _, ok := finishTask(started, stopReasonManual); !ok {
+		t.Fatal("停止任务失败")
+	}
+	task, err := openCaptureTask(config, "", taskOrigin{Type: "manual"})
+	if err != nil {
+		t.Fatalf("停止后再次启动失败: %v", err)
+	}
+	finishTask(task, stopReasonManual)
+}
+
+func TestOpenCaptureTaskReleasesSlotOnFailure(t *testing.T) {
+	socketPath, _ := fakeCaptureHelper(t, 0)
+	originalSocket, originalFind := captureHelperSocket, findCaptureDevices
+	captureHelperSocket = socketPath
+	findCaptureDevices = func() ([]pcap.Interface, error) { return []pcap.Interface{{Name: "eth0"}}, nil }
+	t.Cleanup(func() { captureHelperSocket, findCaptureDevices = originalSocket, originalFind })
+
+	// 网卡不存在时启动失败，之后的请求不应返回409
+	missing := CaptureConfig{DeviceName: "eth9"}
+	normalizeCaptureConfig(&missing)
+	if _, err := openCaptureTask(missing, "", taskOrigin{Type: "manual"}); err == nil || err.(*captureError).status != http.StatusBadRequest {
+		t.Fatalf("网卡不存在时应返回400，实际为 %v", err)
+	}
+	config := CaptureConfig{DeviceName: "eth0"}
+	normalizeCaptureConfig(&config)
+	task, err := openCaptureTask(config, "", taskOrigin{Type: "manual"})
+	if err != nil {
+		t.Fatalf("启动失败后名额未释放: %v", err)
+	}
+	finishTask(task, stopReasonManual)
+}
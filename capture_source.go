@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// 设置后通过特权抓包进程打开网卡，API服务本身不需要抓包权限。
+// 由配置的capture.helper_socket或环境变量CAPTURE_HELPER_SOCKET设置，启动后只读
+var captureHelperSocket string
+
+// 抓包后端
+const (
+	captureBackendPcap     = "pcap"
+	captureBackendAFPacket = "afpacket" // Linux AF_PACKET内存映射环形缓冲区，适合高流量网卡
+)
+
+// afpacket每个socket默认的环形缓冲区大小（MB）
+const defaultRingSizeMB = 64
+
+// 数据包来源，本地打开的*pcap.Handle和特权抓包进程的连接都实现了该接口。
+// ReadPacketData在超时时返回pcap.NextErrorTimeoutExpired，来源关闭后返回io.EOF
+type captureSource interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+	Close()
+}
+
+// 打开数据包来源的参数
+type captureSourceOptions struct {
+	Device      string        `json:"device"`
+	SnapLen     int32         `json:"snap_len"`
+	Promiscuous bool          `json:"promiscuous"`
+	Timeout     time.Duration `json:"timeout"`
+	BPFFilter   string        `json:"bpf_filter,omitempty"`
+	Backend     string        `json:"backend,omitempty"`      // 为空时使用pcap
+	RingSizeMB  int           `json:"ring_size_mb,omitempty"` // afpacket环形缓冲区大小
+	FanoutGroup uint16        `json:"fanout_group,omitempty"` // afpacket fanout组ID，为0时不加入fanout组
+}
+
+// openCaptureSource 打开网卡，配置了CAPTURE_HELPER_SOCKET时由特权抓包进程打开
+func openCaptureSource(options captureSourceOptions) (captureSource, error) {
+	if captureHelperSocket != "" {
+		source, err := dialCaptureHelper(captureHelperSocket, options)
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	}
+	return openLocalSource(options)
+}
+
+// openLocalSource 在当前进程中按指定的后端打开网卡
+func openLocalSource(options captureSourceOptions) (captureSource, error) {
+	switch options.Backend {
+	case "", captureBackendPcap:
+		handle, err := openPcapSource(options)
+		if err != nil {
+			return nil, err
+		}
+		return handle, nil
+	case captureBackendAFPacket:
+		return openAFPacketSource(options)
+	}
+	return nil, fmt.Errorf("不支持的抓包后端: %s", options.Backend)
+}
+
+// openPcapSource 使用libpcap打开网卡
+func openPcapSource(options captureSourceOptions) (*pcap.Handle, error) {
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = pcap.BlockForever
+	}
+	handle, err := pcap.OpenLive(options.Device, options.SnapLen, options.Promiscuous, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if options.BPFFilter != "" {
+		if err := handle.SetBPFFilter(options.BPFFilter); err != nil {
+			handle.Close()
+			return nil, err
+		}
+	}
+	return handle, nil
+}
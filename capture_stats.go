@@ -0,0 +1,230 @@
+package main
+
+import (
+	"abc/a/util"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// 运行中的任务定期广播统计信息的间隔
+const statsBroadcastInterval = 5 * time.Second
+
+// TCP序号跟踪最多记录的连接数，超出时清空重新记录，可通过配置文件的limits调整，启动后只读
+var maxTrackedTCPFlows = 100000
+
+// 内核和网卡层面的抓包统计，由数据包来源提供
+type captureSourceStats struct {
+	Received         int64 `json:"received"`          // 内核收到的数据包数
+	DroppedKernel    int64 `json:"dropped_kernel"`    // 缓冲区已满被内核丢弃的数据包数
+	DroppedInterface int64 `json:"dropped_interface"` // 被网卡或驱动丢弃的数据包数
+}
+
+// 单个网卡的抓包统计
+type interfaceStats struct {
+	Interface string `json:"interface"`
+	captureSourceStats
+}
+
+// 可以提供抓包统计的数据包来源，*pcap.Handle的统计在readSourceStats中单独处理
+type captureStatsReporter interface {
+	captureStats() (captureSourceStats, error)
+}
+
+// 任务的数据包处理计数
+type taskCounters struct {
+	seen           atomic.Int64 // 从网卡读取的数据包数
+	skippedPaused  atomic.Int64 // 暂停期间丢弃的数据包数
+	decoded        atomic.Int64 // 成功解码的数据包数
+	decodeErrors   atomic.Int64 // 解码失败或处理时发生恐慌的数据包数
+	filteredOut    atomic.Int64 // 被协议、路径或内容过滤条件排除的数据包数
+	reassemblyGaps atomic.Int64 // TCP序号不连续的次数，通常说明有数据包丢失
+}
+
+// readSourceStats 读取数据包来源的统计，不支持统计的来源返回false
+func readSourceStats(source captureSource) (captureSourceStats, bool) {
+	switch s := source.(type) {
+	case *pcap.Handle:
+		stats, err := s.Stats()
+		if err != nil {
+			return captureSourceStats{}, false
+		}
+		return captureSourceStats{
+			Received:         int64(stats.PacketsReceived),
+			DroppedKernel:    int64(stats.PacketsDropped),
+			DroppedInterface: int64(stats.PacketsIfDropped),
+		}, true
+	case captureStatsReporter:
+		stats, err := s.captureStats()
+		return stats, err == nil
+	}
+	return captureSourceStats{}, false
+}
+
+// collectSourceStats 按网卡汇总所有数据包来源的统计，网卡需尚未关闭。
+// 读取运行中任务的handles时调用方需持有TaskMutex
+func collectSourceStats(handles []captureHandle) []interfaceStats {
+	result := make([]interfaceStats, 0, len(handles))
+	index := make(map[string]int)
+	for _, h := range handles {
+		stats, ok := readSourceStats(h.handle)
+		if !ok {
+			continue
+		}
+		i, exists := index[h.device]
+		if !exists {
+			i = len(result)
+			index[h.device] = i
+			result = append(result, interfaceStats{Interface: h.device})
+		}
+		// fanout组中的多个socket属于同一个网卡
+		result[i].Received += stats.Received
+		result[i].DroppedKernel += stats.DroppedKernel
+		result[i].DroppedInterface += stats.DroppedInterface
+	}
+	return result
+}
+
+// stats 返回任务的统计信息。运行中的任务实时读取网卡统计，已停止的任务返回停止时的统计
+func (task *captureTask) stats() gin.H {
+	TaskMutex.Lock()
+	sourceStats := task.finalSourceStats
+	if task.stopReason == "" {
+		sourceStats = collectSourceStats(task.handles)
+	}
+	TaskMutex.Unlock()
+
+	var total captureSourceStats
+	for _, stats := range sourceStats {
+		total.Received += stats.Received
+		total.DroppedKernel += stats.DroppedKernel
+		total.DroppedInterface += stats.DroppedInterface
+	}
+	if sourceStats == nil {
+		sourceStats = []interfaceStats{}
+	}
+
+	return gin.H{
+		"received":               total.Received,
+		"dropped_kernel":         total.DroppedKernel,
+		"dropped_interface":      total.DroppedInterface,
+		"interfaces":             sourceStats,
+		"packets_seen":           task.counters.seen.Load(),
+		"packets_skipped_paused": task.counters.skippedPaused.Load(),
+		"packets_decoded":        task.counters.decoded.Load(),
+		"decode_errors":          task.counters.decodeErrors.Load(),
+		"filtered_out":           task.counters.filteredOut.Load(),
+		"matched_requests":       task.matchedRequests.Load(),
+		"captured_bytes":         task.capturedBytes.Load(),
+		"reassembly_gaps":        task.counters.reassemblyGaps.Load(),
+	}
+}
+
+// GetCaptureStats 获取任务的抓包统计，task_id为空时返回当前任务
+func GetCaptureStats(c *gin.Context) {
+	task := findTask(c.Query("task_id"))
+	if task == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有正在运行的抓包任务"})
+		return
+	}
+
+	TaskMutex.Lock()
+	running := task.running
+	TaskMutex.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": task.id,
+		"running": running,
+		"stats":   task.stats(),
+	})
+}
+
+// reportTaskStats 任务运行期间定期广播统计信息，任务停止后退出
+func reportTaskStats(task *captureTask) {
+	ticker := time.NewTicker(statsBroadcastInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		TaskMutex.Lock()
+		stopped := task.stopReason != ""
+		TaskMutex.Unlock()
+		if stopped {
+			return
+		}
+
+		stats := task.stats()
+		if dropped := stats["dropped_kernel"].(int64); dropped > 0 {
+			util.Log.Logger.Debug("抓包任务 %s 内核丢包: %d", task.id, dropped)
+		}
+		BroadcastTaskStatus(gin.H{
+			"task_id": task.id,
+			"running": true,
+			"stats":   stats,
+		})
+	}
+}
+
+// TCP连接的序号跟踪，用于发现丢失的数据包。不加锁，属于解码协程的decodeState
+type tcpGapTracker struct {
+	limit int                   // 最多记录的连接方向数，超出时清空重新记录
+	next  map[tcpFlowKey]uint32 // 每个方向下一个期望的序号
+}
+
+// newTCPGapTracker 创建序号跟踪器，shards个跟踪器平分maxTrackedTCPFlows，总内存占用与单个跟踪器相同
+func newTCPGapTracker(shards int) *tcpGapTracker {
+	limit := maxTrackedTCPFlows
+	if shards > 1 {
+		limit /= shards
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return &tcpGapTracker{limit: limit, next: make(map[tcpFlowKey]uint32)}
+}
+
+type tcpFlowKey struct {
+	network, transport gopacket.Flow
+}
+
+// observe 记录TCP数据包，序号比期望的大（中间有数据没有收到）时返回true
+func (t *tcpGapTracker) observe(packet gopacket.Packet, tcp *layers.TCP) bool {
+	network := packet.NetworkLayer()
+	if network == nil {
+		return false
+	}
+	key := tcpFlowKey{network: network.NetworkFlow(), transport: tcp.TransportFlow()}
+	end := tcp.Seq + uint32(len(tcp.Payload))
+	if tcp.SYN || tcp.FIN {
+		end++
+	}
+
+	if len(t.next) >= t.limit {
+		t.next = make(map[tcpFlowKey]uint32)
+	}
+	if tcp.RST || tcp.FIN {
+		delete(t.next, key)
+		return false
+	}
+	if tcp.SYN {
+		t.next[key] = end
+		return false
+	}
+	if len(tcp.Payload) == 0 {
+		return false
+	}
+
+	expected, ok := t.next[key]
+	if !ok {
+		t.next[key] = end
+		return false
+	}
+	// 序号按32位回绕比较
+	if int32(end-expected) > 0 {
+		t.next[key] = end
+	}
+	return int32(tcp.Seq-expected) > 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// gapPacket 构造srcPort发往80端口的TCP数据包
+func gapPacket(t *testing.T, srcPort int, seq uint32, payload string, syn bool) (gopacket.Packet, *layers.TCP) {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(10, 0, 0, 2)}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: 80, Seq: seq, SYN: syn, ACK: !syn, Window: 65535}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buffer := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true}, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	return packet, packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+}
+
+func TestTCPGapTracker(t *testing.T) {
+	steps := []struct {
+		name    string
+		seq     uint32
+		payload string
+		syn     bool
+		gap     bool
+	}{
+		{name: "syn", seq: 99, syn: true},
+		{name: "first segment", seq: 100, payload: "aaaa"},
+		{name: "next segment", seq: 104, payload: "bbbb"},
+		{name: "retransmission", seq: 100, payload: "aaaa"},
+		{name: "missing segment", seq: 112, payload: "dddd", gap: true},
+		{name: "late segment", seq: 108, payload: "cccc"},
+		{name: "continues after the gap", seq: 116, payload: "eeee"},
+	}
+	gaps := newTCPGapTracker(1)
+	for _, step := range steps {
+		packet, tcp := gapPacket(t, 40000, step.seq, step.payload, step.syn)
+		if got := gaps.observe(packet, tcp); got != step.gap {
+			t.Errorf("%s: 缺口为 %v，应为 %v", step.name, got, step.gap)
+		}
+	}
+
+	// 32位序号回绕后仍按顺序比较
+	gaps = newTCPGapTracker(1)
+	packet, tcp := gapPacket(t, 40001, 0xFFFFFFFE, "abcd", false)
+	gaps.observe(packet, tcp)
+	if packet, tcp := gapPacket(t, 40001, 2, "efgh", false); gaps.observe(packet, tcp) {
+		t.Error("回绕后的下一个数据包被计为缺口")
+	}
+}
+
+func TestTCPGapTrackerShardLimit(t *testing.T) {
+	original := maxTrackedTCPFlows
+	maxTrackedTCPFlows = 8
+	t.Cleanup(func() { maxTrackedTCPFlows = original })
+
+	// 4个跟踪器平分上限，每个最多记录2个连接方向
+	gaps := newTCPGapTracker(4)
+	if gaps.limit != 2 {
+		t.Fatalf("limit为 %d，应为2", gaps.limit)
+	}
+	for port := 40000; port < 40003; port++ {
+		packet, tcp := gapPacket(t, port, 100, "aaaa", false)
+		gaps.observe(packet, tcp)
+	}
+	if len(gaps.next) > gaps.limit {
+		t.Errorf("记录了 %d 个连接方向，超过上限 %d", len(gaps.next), gaps.limit)
+	}
+	if newTCPGapTracker(100).limit != 1 {
+		t.Error("跟踪器数量超过上限时每个跟踪器至少记录1个连接方向")
+	}
+}
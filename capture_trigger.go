@@ -0,0 +1,215 @@
+package main
+
+import (
+	"abc/a/util"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// 触发器默认冷却时间（秒），两次触发之间至少间隔该时间
+const defaultTriggerCooldown = 300
+
+// 触发器，在指定网卡上持续监听流量，满足条件时自动启动一次抓包
+type Trigger struct {
+	ID         string           `json:"id"`
+	Name       string           `json:"name"`
+	DeviceName string           `json:"device_name" binding:"required"` // 监听的网卡
+	Condition  TriggerCondition `json:"condition"`
+	Duration   int              `json:"duration"`    // 触发后抓包时长（秒），为0时使用config.max_duration
+	Cooldown   int              `json:"cooldown"`    // 冷却时间（秒），为0时使用默认值
+	PreTrigger int              `json:"pre_trigger"` // 大于0且监听网卡开启了预触发缓冲时，生成包含触发前N秒数据包的快照任务
+	Enabled    bool             `json:"enabled"`
+	Config     CaptureConfig    `json:"config"` // 触发后启动的抓包配置，device_name为空时使用监听网卡
+
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+	LastTaskID  string     `json:"last_task_id,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// 触发条件，设置的条件满足其一即触发
+type TriggerCondition struct {
+	StatusMin int           `json:"status_min"` // HTTP响应状态码下限，如500；为0时不检查响应
+	StatusMax int           `json:"status_max"` // HTTP响应状态码上限，为0时与status_min相同
+	Request   *PacketFilter `json:"request"`    // 满足该条件的HTTP请求，为nil时不检查请求
+}
+
+// 触发器监听协程
+type triggerWatcher struct {
+	handle captureSource
+}
+
+// isValid 判断是否至少设置了一个触发条件
+func (cond TriggerCondition) isValid() bool {
+	return cond.StatusMin > 0 || cond.Request != nil
+}
+
+// match 判断数据包是否满足触发条件
+func (cond TriggerCondition) match(packet gopacket.Packet) bool {
+	tcpLayer := packet.Layer(layers.LayerTypeTCP)
+	appLayer := packet.ApplicationLayer()
+	if tcpLayer == nil || appLayer == nil {
+		return false
+	}
+	dataStr := string(appLayer.Payload())
+
+	if cond.StatusMin > 0 {
+		if status, ok := parseHTTPStatus(dataStr); ok {
+			statusMax := cond.StatusMax
+			if statusMax == 0 {
+				statusMax = cond.StatusMin
+			}
+			if status >= cond.StatusMin && status <= statusMax {
+				return true
+			}
+		}
+	}
+
+	if cond.Request != nil && isHTTPRequestPayload(dataStr) {
+		tcp, _ := tcpLayer.(*layers.TCP)
+		if cond.Request.Match(parseHTTPRequest(packet, tcp, dataStr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHTTPStatus 从HTTP响应的状态行中解析状态码
+func parseHTTPStatus(dataStr string) (int, bool) {
+	if !strings.HasPrefix(dataStr, "HTTP/") {
+		return 0, false
+	}
+	parts := strings.SplitN(dataStr, " ", 3)
+	if len(parts) < 2 || len(parts[1]) != 3 {
+		return 0, false
+	}
+	status, err := strconv.Atoi(parts[1])
+	return status, err == nil
+}
+
+// startTriggerWatcher 为启用的触发器启动监听协程，调用方不能持有scheduler.mutex。
+// 打开网卡可能较慢（如通过特权抓包进程），在锁外进行；期间触发器被修改、删除或已有监听时关闭新打开的网卡
+func startTriggerWatcher(id string) {
+	scheduler.mutex.Lock()
+	trigger, ok := scheduler.triggers[id]
+	if !ok || !trigger.Enabled || scheduler.watchers[id] != nil {
+		scheduler.mutex.Unlock()
+		return
+	}
+	deviceName := trigger.DeviceName
+	scheduler.mutex.Unlock()
+
+	handle, err := openCaptureSource(captureSourceOptions{
+		Device:    deviceName,
+		SnapLen:   65535,
+		Timeout:   time.Second,
+		BPFFilter: "tcp",
+	})
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	current, ok := scheduler.triggers[id]
+	if !ok || current != trigger || !trigger.Enabled || trigger.DeviceName != deviceName || scheduler.watchers[id] != nil {
+		if err == nil {
+			handle.Close()
+		}
+		return
+	}
+	if err != nil {
+		util.Log.Logger.Error("触发器监听启动失败: %s, 设备: %s, 错误: %v", id, deviceName, err)
+		trigger.LastError = "无法监听网卡: " + err.Error()
+		return
+	}
+
+	watcher := &triggerWatcher{handle: handle}
+	scheduler.watchers[id] = watcher
+	go watcher.run(id, trigger.Condition)
+	util.Log.Logger.Info("触发器开始监听: %s, 设备: %s", id, deviceName)
+}
+
+// stopTriggerWatcherLocked 停止触发器的监听协程，调用方需持有scheduler.mutex
+func stopTriggerWatcherLocked(id string) {
+	if watcher, ok := scheduler.watchers[id]; ok {
+		watcher.handle.Close()
+		delete(scheduler.watchers, id)
+		util.Log.Logger.Info("触发器停止监听: %s", id)
+	}
+}
+
+// run 读取监听网卡的数据包，满足条件时触发抓包，网卡关闭后退出
+func (w *triggerWatcher) run(id string, cond TriggerCondition) {
+	packetSource := gopacket.NewPacketSource(w.handle, w.handle.LinkType())
+	for packet := range packetSource.Packets() {
+		if cond.match(packet) {
+			fireTrigger(id)
+		}
+	}
+}
+
+// fireTrigger 触发抓包，冷却期内的重复触发会被忽略
+func fireTrigger(id string) {
+	scheduler.mutex.Lock()
+	trigger, ok := scheduler.triggers[id]
+	if !ok || !trigger.Enabled {
+		scheduler.mutex.Unlock()
+		return
+	}
+	cooldown := trigger.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultTriggerCooldown
+	}
+	now := time.Now()
+	if trigger.LastFiredAt != nil && now.Sub(*trigger.LastFiredAt) < time.Duration(cooldown)*time.Second {
+		scheduler.mutex.Unlock()
+		return
+	}
+	trigger.LastFiredAt = &now
+
+	config := trigger.Config
+	if config.DeviceName == "" && len(config.DeviceNames) == 0 {
+		config.DeviceName = trigger.DeviceName
+	}
+	if trigger.Duration > 0 {
+		config.MaxDuration = trigger.Duration
+	}
+	origin := taskOrigin{Type: "trigger", ID: trigger.ID, Name: trigger.Name}
+	preTrigger := trigger.PreTrigger
+	scheduler.mutex.Unlock()
+
+	// 启动抓包可能较慢，放到单独的协程中，避免阻塞监听
+	go func() {
+		util.Log.Logger.Info("触发器已触发: %s (%s)", origin.Name, origin.ID)
+		var task *captureTask
+		var err error
+		if preTrigger > 0 && findRecorder(config.DeviceName) != nil {
+			task, err = startSnapshotTask(SnapshotRequest{
+				DeviceName:     config.DeviceName,
+				BeforeSeconds:  preTrigger,
+				AfterSeconds:   config.MaxDuration,
+				Protocols:      config.Protocols,
+				PathFilter:     config.PathFilter,
+				ContainsFilter: config.ContainsFilter,
+			}, origin)
+		} else {
+			if preTrigger > 0 {
+				util.Log.Logger.Warn("触发器 %s 需要预触发缓冲，但网卡 %s 未开启，改为普通抓包", origin.ID, config.DeviceName)
+			}
+			task, err = startCaptureTask(config, "", origin)
+		}
+
+		scheduler.mutex.Lock()
+		defer scheduler.mutex.Unlock()
+
+		trigger.LastError = ""
+		if err != nil {
+			util.Log.Logger.Error("触发器启动抓包失败: %s, 错误: %v", origin.ID, err)
+			trigger.LastError = err.Error()
+		} else {
+			trigger.LastTaskID = task.id
+		}
+		saveSchedulerStoreLocked()
+	}()
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"abc/a/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/gopacket/pcap"
+)
+
+// 字段错误类型
+const (
+	fieldErrorRequired    = "required"     // 缺少必需的字段
+	fieldErrorOutOfRange  = "out_of_range" // 数值超出允许范围
+	fieldErrorUnsupported = "unsupported"  // 不支持的取值
+	fieldErrorInvalid     = "invalid"      // 格式或类型错误
+	fieldErrorNotFound    = "not_found"    // 网卡设备不存在
+)
+
+// 抓包配置的取值范围
+const (
+	maxSnapshotLen   = 262144 // 与libpcap的上限相同
+	maxCaptureWait   = 3600   // timeout的上限（秒）
+	maxFanoutWorkers = 64
+	maxRingSizeMB    = 4096
+	maxFilterLength  = 1024 // path_filter和contains_filter的最大字节数
+)
+
+// 支持的协议，protocols中的名称不区分大小写
+var supportedProtocols = []string{"http"}
+
+// 字段级的校验错误
+type fieldError struct {
+	Field   string      `json:"field"` // 字段路径，如snapshot_len、device_names[1]、redaction.rules[0].pattern
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Value   interface{} `json:"value,omitempty"` // 导致错误的取值
+}
+
+func (e *fieldError) Error() string {
+	return e.Message
+}
+
+// normalizeCaptureConfig 为未设置的字段填入默认值、统一协议名称的大小写，并校验所有字段，返回全部字段错误
+func normalizeCaptureConfig(config *CaptureConfig) []fieldError {
+	applyCaptureDefaults(config)
+	config.Protocols = normalizeProtocols(config.Protocols)
+
+	errs := make([]fieldError, 0)
+	add := func(field, code, message string, value interface{}) {
+		errs = append(errs, fieldError{Field: field, Code: code, Message: message, Value: value})
+	}
+
+	if config.DeviceName == "" && len(config.DeviceNames) == 0 {
+		add("device_name", fieldErrorRequired, "需要设置device_name或device_names", nil)
+	}
+	for i, device := range config.DeviceNames {
+		if strings.TrimSpace(device) == "" {
+			add("device_names["+strconv.Itoa(i)+"]", fieldErrorInvalid, "网卡名称不能为空", device)
+		}
+	}
+	errs = append(errs, validateCaptureFilters(config.Protocols, config.PathFilter, config.ContainsFilter)...)
+
+	if config.SnapshotLen < 1 || config.SnapshotLen > maxSnapshotLen {
+		add("snapshot_len", fieldErrorOutOfRange, fmt.Sprintf("snapshot_len应在1到%d之间", maxSnapshotLen), config.SnapshotLen)
+	}
+	if config.Timeout < 1 || config.Timeout > maxCaptureWait {
+		add("timeout", fieldErrorOutOfRange, fmt.Sprintf("timeout应在1到%d秒之间", maxCaptureWait), config.Timeout)
+	}
+
+	switch config.Backend {
+	case captureBackendPcap:
+	case captureBackendAFPacket:
+		if runtime.GOOS != "linux" {
+			add("backend", fieldErrorUnsupported, "afpacket后端仅支持Linux", config.Backend)
+		}
+	default:
+		add("backend", fieldErrorUnsupported, "不支持的抓包后端: "+config.Backend, config.Backend)
+	}
+	if config.FanoutWorkers < 0 || config.FanoutWorkers > maxFanoutWorkers {
+		add("fanout_workers", fieldErrorOutOfRange, fmt.Sprintf("fanout_workers应在0到%d之间", maxFanoutWorkers), config.FanoutWorkers)
+	} else if config.FanoutWorkers > 1 && config.Backend != captureBackendAFPacket {
+		add("fanout_workers", fieldErrorUnsupported, "fanout_workers仅支持afpacket后端", config.FanoutWorkers)
+	}
+	if config.RingSizeMB < 0 || config.RingSizeMB > maxRingSizeMB {
+		add("ring_size_mb", fieldErrorOutOfRange, fmt.Sprintf("ring_size_mb应在0到%d之间", maxRingSizeMB), config.RingSizeMB)
+	}
+	if config.DecodeWorkers < 0 || config.DecodeWorkers > maxDecodeWorkers {
+		add("decode_workers", fieldErrorOutOfRange, fmt.Sprintf("decode_workers应在0到%d之间", maxDecodeWorkers), config.DecodeWorkers)
+	}
+
+	if config.MaxDuration < 0 {
+		add("max_duration", fieldErrorOutOfRange, "max_duration不能为负数", config.MaxDuration)
+	}
+	if config.MaxRequests < 0 {
+		add("max_requests", fieldErrorOutOfRange, "max_requests不能为负数", config.MaxRequests)
+	}
+	if config.MaxBytes < 0 {
+		add("max_bytes", fieldErrorOutOfRange, "max_bytes不能为负数", config.MaxBytes)
+	}
+
+	if _, err := newRedactor(config.Redaction); err != nil {
+		var fe *fieldError
+		if errors.As(err, &fe) {
+			errs = append(errs, *fe)
+		} else {
+			add("redaction", fieldErrorInvalid, err.Error(), nil)
+		}
+	}
+	return errs
+}
+
+// normalizeProtocols 将协议名称转为小写并去除重复
+func normalizeProtocols(protocols []string) []string {
+	if protocols == nil {
+		return nil
+	}
+	normalized := make([]string, 0, len(protocols))
+	seen := make(map[string]bool)
+	for _, protocol := range protocols {
+		protocol = strings.ToLower(strings.TrimSpace(protocol))
+		if !seen[protocol] {
+			seen[protocol] = true
+			normalized = append(normalized, protocol)
+		}
+	}
+	return normalized
+}
+
+// validateCaptureFilters 校验协议和过滤条件，启动任务和运行中修改过滤条件时共用
+func validateCaptureFilters(protocols []string, pathFilter, containsFilter string) []fieldError {
+	errs := make([]fieldError, 0)
+	for i, protocol := range protocols {
+		supported := false
+		for _, name := range supportedProtocols {
+			if strings.EqualFold(protocol, name) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			errs = append(errs, fieldError{
+				Field:   "protocols[" + strconv.Itoa(i) + "]",
+				Code:    fieldErrorUnsupported,
+				Message: "不支持的协议: " + protocol + "，支持: " + strings.Join(supportedProtocols, "、"),
+				Value:   protocol,
+			})
+		}
+	}
+
+	// 路径过滤与请求行中的路径比较，路径中不会出现空白和控制字符
+	if len(pathFilter) > maxFilterLength {
+		errs = append(errs, fieldError{Field: "path_filter", Code: fieldErrorOutOfRange, Message: fmt.Sprintf("path_filter不能超过%d字节", maxFilterLength)})
+	} else if strings.IndexFunc(pathFilter, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		errs = append(errs, fieldError{Field: "path_filter", Code: fieldErrorInvalid, Message: "path_filter不能包含空白或控制字符", Value: pathFilter})
+	}
+	if len(containsFilter) > maxFilterLength {
+		errs = append(errs, fieldError{Field: "contains_filter", Code: fieldErrorOutOfRange, Message: fmt.Sprintf("contains_filter不能超过%d字节", maxFilterLength)})
+	}
+	return errs
+}
+
+// validate 校验过滤条件更新中设置了的字段
+func (update captureFilterUpdate) validate() []fieldError {
+	var protocols []string
+	var pathFilter, containsFilter string
+	if update.Protocols != nil {
+		protocols = *update.Protocols
+	}
+	if update.PathFilter != nil {
+		pathFilter = *update.PathFilter
+	}
+	if update.ContainsFilter != nil {
+		containsFilter = *update.ContainsFilter
+	}
+	return validateCaptureFilters(protocols, pathFilter, containsFilter)
+}
+
+// 获取网卡列表，测试中替换为固定的列表
+var findCaptureDevices = pcap.FindAllDevs
+
+// captureDeviceErrors 检查网卡设备是否存在，无法获取设备列表时返回error
+func captureDeviceErrors(config CaptureConfig) ([]fieldError, error) {
+	devices, err := findCaptureDevices()
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		exists[device.Name] = true
+	}
+
+	errs := make([]fieldError, 0)
+	if len(config.DeviceNames) == 0 {
+		if config.DeviceName != "" && !exists[config.DeviceName] {
+			errs = append(errs, fieldError{Field: "device_name", Code: fieldErrorNotFound, Message: "指定的网卡设备不存在: " + config.DeviceName, Value: config.DeviceName})
+		}
+		return errs, nil
+	}
+	for i, device := range config.DeviceNames {
+		if device != "" && !exists[device] {
+			errs = append(errs, fieldError{Field: "device_names[" + strconv.Itoa(i) + "]", Code: fieldErrorNotFound, Message: "指定的网卡设备不存在: " + device, Value: device})
+		}
+	}
+	return errs, nil
+}
+
+// invalidConfigError 将字段错误转为400错误，没有错误时返回nil
+func invalidConfigError(errs []fieldError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &captureError{status: http.StatusBadRequest, message: "抓包配置无效: " + errs[0].Message, fields: errs}
+}
+
+// prefixFieldErrors 为嵌套在其他对象中的抓包配置的字段路径加上前缀，如config.
+func prefixFieldErrors(prefix string, errs []fieldError) []fieldError {
+	for i := range errs {
+		errs[i].Field = prefix + errs[i].Field
+	}
+	return errs
+}
+
+// bindCaptureConfig 解析请求体中的抓包配置，JSON类型错误转为字段错误，失败时已写入400响应
+func bindCaptureConfig(c *gin.Context, config *CaptureConfig) bool {
+	err := c.ShouldBindJSON(config)
+	if err == nil {
+		return true
+	}
+	util.Log.Logger.Error("参数绑定失败: %v, IP: %s", err, c.ClientIP())
+	response := gin.H{"error": err.Error()}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		response["errors"] = []fieldError{{
+			Field:   typeErr.Field,
+			Code:    fieldErrorInvalid,
+			Message: fmt.Sprintf("%s的类型应为%s，实际为%s", typeErr.Field, typeErr.Type, typeErr.Value),
+		}}
+	}
+	c.JSON(http.StatusBadRequest, response)
+	return false
+}
+
+// ValidateCaptureConfig 校验抓包配置但不启动任务，返回填入默认值后的配置和全部字段错误，包括网卡是否存在
+func ValidateCaptureConfig(c *gin.Context) {
+	var config CaptureConfig
+	if !bindCaptureConfig(c, &config) {
+		return
+	}
+
+	errs := normalizeCaptureConfig(&config)
+	deviceErrs, err := captureDeviceErrors(config)
+	if err != nil {
+		util.Log.Logger.Error("无法获取设备列表: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法获取设备列表: " + err.Error()})
+		return
+	}
+	errs = append(errs, deviceErrs...)
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":  len(errs) == 0,
+		"config": config,
+		"errors": errs,
+	})
+}
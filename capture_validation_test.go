@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fieldCodes 把字段错误转为"字段:code"列表，便于比较
+func fieldCodes(errs []fieldError) []string {
+	codes := make([]string, len(errs))
+	for i, e := range errs {
+		codes[i] = e.Field + ":" + e.Code
+	}
+	return codes
+}
+
+func TestNormalizeCaptureConfigDefaults(t *testing.T) {
+	config := CaptureConfig{DeviceName: "eth0", Protocols: []string{" HTTP", "http"}}
+	if errs := normalizeCaptureConfig(&config); len(errs) != 0 {
+		t.Fatalf("errors = %v", fieldCodes(errs))
+	}
+	if config.SnapshotLen != 1024 || config.Timeout != 30 || config.Backend != captureBackendPcap {
+		t.Errorf("defaults = snapshot_len %d, timeout %d, backend %q", config.SnapshotLen, config.Timeout, config.Backend)
+	}
+	// ring_size_mb只对afpacket填入默认值
+	if config.RingSizeMB != 0 {
+		t.Errorf("ring_size_mb = %d, want 0 for pcap", config.RingSizeMB)
+	}
+	if strings.Join(config.Protocols, ",") != "http" {
+		t.Errorf("protocols = %v, want [http]", config.Protocols)
+	}
+
+	// 设置了的字段保持不变
+	config = CaptureConfig{DeviceNames: []string{"eth0"}, SnapshotLen: 65535, Timeout: 5}
+	normalizeCaptureConfig(&config)
+	if config.SnapshotLen != 65535 || config.Timeout != 5 {
+		t.Errorf("explicit values changed: snapshot_len %d, timeout %d", config.SnapshotLen, config.Timeout)
+	}
+
+	if runtime.GOOS == "linux" {
+		config = CaptureConfig{DeviceName: "eth0", Backend: captureBackendAFPacket}
+		if errs := normalizeCaptureConfig(&config); len(errs) != 0 || config.RingSizeMB != 64 {
+			t.Errorf("afpacket: ring_size_mb = %d, errors = %v", config.RingSizeMB, fieldCodes(errs))
+		}
+	}
+}
+
+func TestNormalizeCaptureConfigFieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CaptureConfig
+		want   []string
+	}{
+		{name: "no device", config: CaptureConfig{}, want: []string{"device_name:required"}},
+		{name: "blank device in list", config: CaptureConfig{DeviceNames: []string{"eth0", " "}}, want: []string{"device_names[1]:invalid"}},
+		{
+			name:   "protocols and filters",
+			config: CaptureConfig{DeviceName: "eth0", Protocols: []string{"http", "FTP"}, PathFilter: "/a b", ContainsFilter: strings.Repeat("x", maxFilterLength+1)},
+			want:   []string{"protocols[1]:unsupported", "path_filter:invalid", "contains_filter:out_of_range"},
+		},
+		{
+			name:   "ranges",
+			config: CaptureConfig{DeviceName: "eth0", SnapshotLen: maxSnapshotLen + 1, Timeout: -1, RingSizeMB: -1, DecodeWorkers: maxDecodeWorkers + 1},
+			want:   []string{"snapshot_len:out_of_range", "timeout:out_of_range", "ring_size_mb:out_of_range", "decode_workers:out_of_range"},
+		},
+		{name: "unknown backend", config: CaptureConfig{DeviceName: "eth0", Backend: "dpdk"}, want: []string{"backend:unsupported"}},
+		{name: "fanout needs afpacket", config: CaptureConfig{DeviceName: "eth0", FanoutWorkers: 4}, want: []string{"fanout_workers:unsupported"}},
+		{name: "fanout out of range", config: CaptureConfig{DeviceName: "eth0", FanoutWorkers: maxFanoutWorkers + 1}, want: []string{"fanout_workers:out_of_range"}},
+		{
+			name:   "negative stop conditions",
+			config: CaptureConfig{DeviceName: "eth0", MaxDuration: -1, MaxRequests: -1, MaxBytes: -1},
+			want:   []string{"max_duration:out_of_range", "max_requests:out_of_range", "max_bytes:out_of_range"},
+		},
+		{
+			name:   "redaction rule",
+			config: CaptureConfig{DeviceName: "eth0", Redaction: RedactionConfig{Rules: []RedactionRule{{Type: "regex", Pattern: "("}}}},
+			want:   []string{"redaction.rules[0].pattern:invalid"},
+		},
+		{
+			name:   "redaction mode",
+			config: CaptureConfig{DeviceName: "eth0", Redaction: RedactionConfig{Mode: "drop"}},
+			want:   []string{"redaction.mode:unsupported"},
+		},
+		{
+			name:   "all errors are reported",
+			config: CaptureConfig{Protocols: []string{"smtp"}, SnapshotLen: -1},
+			want:   []string{"device_name:required", "protocols[0]:unsupported", "snapshot_len:out_of_range"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			got := fieldCodes(normalizeCaptureConfig(&config))
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCaptureConfigResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/capture/validate", ValidateCaptureConfig)
+
+	validate := func(body string) (int, map[string]json.RawMessage) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/capture/validate", strings.NewReader(body)))
+		var response map[string]json.RawMessage
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("response %q: %v", recorder.Body.String(), err)
+		}
+		return recorder.Code, response
+	}
+
+	// JSON类型错误转为字段错误
+	status, response := validate(`{"device_name": "eth0", "snapshot_len": "big"}`)
+	var errs []fieldError
+	json.Unmarshal(response["errors"], &errs)
+	if status != http.StatusBadRequest || len(errs) != 1 || errs[0].Field != "snapshot_len" || errs[0].Code != fieldErrorInvalid {
+		t.Errorf("type error: status %d, errors %+v", status, errs)
+	}
+
+	// 校验失败时仍然返回200，并带有填入默认值后的配置和全部字段错误
+	status, response = validate(`{"device_name": "nope-device0", "protocols": ["ftp"]}`)
+	if status != http.StatusOK || string(response["valid"]) != "false" {
+		t.Fatalf("status %d, valid %s", status, response["valid"])
+	}
+	var config CaptureConfig
+	json.Unmarshal(response["config"], &config)
+	if config.SnapshotLen != 1024 || config.Timeout != 30 || config.Backend != captureBackendPcap {
+		t.Errorf("config = %+v", config)
+	}
+	errs = nil
+	json.Unmarshal(response["errors"], &errs)
+	if got := strings.Join(fieldCodes(errs), " "); got != "protocols[0]:unsupported device_name:not_found" {
+		t.Errorf("errors = %s", got)
+	}
+	if errs[1].Value != "nope-device0" || errs[1].Message == "" {
+		t.Errorf("device error = %+v", errs[1])
+	}
+}
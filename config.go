@@ -0,0 +1,363 @@
+package main
+
+import (
+	"abc/a/util"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 未指定配置文件时在工作目录下依次查找的文件，都不存在时使用默认配置
+var defaultConfigFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
+// /config接口中替换敏感值的字符串
+const maskedSecret = "******"
+
+// AppConfig 服务配置，优先级从高到低依次为命令行参数、环境变量、配置文件和默认值
+type AppConfig struct {
+	Listen    string            `json:"listen" yaml:"listen" toml:"listen"`             // 监听地址，默认":8081"
+	StaticDir string            `json:"static_dir" yaml:"static_dir" toml:"static_dir"` // index.html所在目录，默认为可执行文件所在目录或工作目录下的static
+	Log       logSettings       `json:"log" yaml:"log" toml:"log"`
+	Capture   captureDefaults   `json:"capture" yaml:"capture" toml:"capture"`
+	Limits    limitSettings     `json:"limits" yaml:"limits" toml:"limits"`
+	Auth      authConfig        `json:"auth" yaml:"auth" toml:"auth"`
+	TLS       tlsSettings       `json:"tls" yaml:"tls" toml:"tls"`
+	Redaction redactionSettings `json:"redaction" yaml:"redaction" toml:"redaction"`
+	Audit     auditSettings     `json:"audit" yaml:"audit" toml:"audit"`
+}
+
+// 日志配置
+type logSettings struct {
+	Level   string `json:"level" yaml:"level" toml:"level"`       // debug、info、warn、error，默认info
+	Dir     string `json:"dir" yaml:"dir" toml:"dir"`             // 日志文件目录，默认为工作目录下的log
+	Console bool   `json:"console" yaml:"console" toml:"console"` // 输出到控制台，默认开启
+	File    bool   `json:"file" yaml:"file" toml:"file"`          // 输出到日志文件，默认开启
+}
+
+// 抓包请求未设置对应字段时使用的默认值，以及网卡和抓包进程的设置
+type captureDefaults struct {
+	SnapshotLen   int32  `json:"snapshot_len" yaml:"snapshot_len" toml:"snapshot_len"`       // 默认1024
+	Timeout       int    `json:"timeout" yaml:"timeout" toml:"timeout"`                      // 秒，默认30
+	Backend       string `json:"backend" yaml:"backend" toml:"backend"`                      // 默认pcap
+	RingSizeMB    int    `json:"ring_size_mb" yaml:"ring_size_mb" toml:"ring_size_mb"`       // afpacket后端默认64
+	DecodeWorkers int    `json:"decode_workers" yaml:"decode_workers" toml:"decode_workers"` // 默认0，与CPU数量相同
+
+	DeviceExclude []string `json:"device_exclude" yaml:"device_exclude" toml:"device_exclude"` // 隐藏的网卡名称关键字，默认["utun"]
+	HelperSocket  string   `json:"helper_socket" yaml:"helper_socket" toml:"helper_socket"`    // 特权抓包进程的socket路径
+}
+
+// 内存和大小限制
+type limitSettings struct {
+	MaxRawBodySize       int `json:"max_raw_body_size" yaml:"max_raw_body_size" toml:"max_raw_body_size"`                   // 保存的原始内容最大字节数
+	MaxDecodedBodySize   int `json:"max_decoded_body_size" yaml:"max_decoded_body_size" toml:"max_decoded_body_size"`       // 解码后内容的最大字节数
+	MaxDescriptorSetSize int `json:"max_descriptor_set_size" yaml:"max_descriptor_set_size" toml:"max_descriptor_set_size"` // protobuf描述符集合的最大字节数
+	MaxDecodeWorkers     int `json:"max_decode_workers" yaml:"max_decode_workers" toml:"max_decode_workers"`                // 解码协程数量上限
+	MaxTrackedTCPFlows   int `json:"max_tracked_tcp_flows" yaml:"max_tracked_tcp_flows" toml:"max_tracked_tcp_flows"`       // TCP序号跟踪最多记录的连接数
+}
+
+// 脱敏配置
+type redactionSettings struct {
+	HashKey string `json:"hash_key" yaml:"hash_key" toml:"hash_key"` // hash方式的HMAC密钥，为空时每次启动随机生成
+}
+
+// 审计日志配置
+type auditSettings struct {
+	LogFile string `json:"log_file" yaml:"log_file" toml:"log_file"` // 审计日志文件，默认data/audit.log
+}
+
+// 当前生效的配置和读取的配置文件，在main中启动服务之前加载，之后只读
+var (
+	appConfig     = defaultAppConfig()
+	appConfigFile string
+)
+
+// defaultAppConfig 返回默认配置
+func defaultAppConfig() AppConfig {
+	return AppConfig{
+		Listen: ":8081",
+		Log:    logSettings{Level: "info", Dir: util.DefaultLogDir, Console: true, File: true},
+		Capture: captureDefaults{
+			SnapshotLen:   1024,
+			Timeout:       30,
+			Backend:       captureBackendPcap,
+			RingSizeMB:    defaultRingSizeMB,
+			DeviceExclude: []string{"utun"},
+		},
+		Limits: limitSettings{
+			MaxRawBodySize:       maxRawBodySize,
+			MaxDecodedBodySize:   maxDecodedBodySize,
+			MaxDescriptorSetSize: maxDescriptorSetSize,
+			MaxDecodeWorkers:     maxDecodeWorkers,
+			MaxTrackedTCPFlows:   maxTrackedTCPFlows,
+		},
+		Auth:  authConfig{UsersFile: authUsersPath},
+		Audit: auditSettings{LogFile: auditLogPath},
+	}
+}
+
+// LoadAppConfig 加载配置并应用到日志、限制等全局设置，配置无效时退出。
+// args为命令行参数，子命令传入nil，只读取配置文件和环境变量
+func LoadAppConfig(args []string) {
+	config, path, err := buildAppConfig(args, os.LookupEnv)
+	if err != nil {
+		util.Log.Logger.Fatal("加载配置失败: %v", err)
+	}
+	appConfig, appConfigFile = config, path
+	applyAppConfig()
+	if path != "" {
+		util.Log.Logger.Info("已加载配置文件: %s", path)
+	}
+}
+
+// buildAppConfig 按优先级合并默认值、配置文件、环境变量和命令行参数，返回配置和读取的配置文件路径
+func buildAppConfig(args []string, lookupEnv func(string) (string, bool)) (AppConfig, string, error) {
+	config := defaultAppConfig()
+
+	flags := flag.NewFlagSet("packet-capture-tool", flag.ExitOnError)
+	configFile := flags.String("config", "", "配置文件路径，支持.yaml、.yml和.toml，也可通过环境变量CONFIG_FILE设置")
+	listen := flags.String("listen", "", "监听地址，如:8081或127.0.0.1:8081")
+	staticDir := flags.String("static-dir", "", "index.html所在目录")
+	logLevel := flags.String("log-level", "", "日志级别：debug、info、warn、error")
+	logDir := flags.String("log-dir", "", "日志文件目录")
+	if args != nil {
+		flags.Parse(args)
+	}
+
+	// 配置文件：命令行参数、环境变量、工作目录下的默认文件
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path == "" {
+		for _, candidate := range defaultConfigFiles {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path != "" {
+		if err := readConfigFile(path, &config); err != nil {
+			return AppConfig{}, "", fmt.Errorf("读取配置文件 %s 失败: %v", path, err)
+		}
+	}
+
+	// 环境变量
+	envStrings := map[string]*string{
+		"LISTEN_ADDR":           &config.Listen,
+		"STATIC_DIR":            &config.StaticDir,
+		"LOG_LEVEL":             &config.Log.Level,
+		"LOG_DIR":               &config.Log.Dir,
+		"CAPTURE_HELPER_SOCKET": &config.Capture.HelperSocket,
+		"REDACTION_HASH_KEY":    &config.Redaction.HashKey,
+	}
+	for name, target := range envStrings {
+		if value, ok := lookupEnv(name); ok && value != "" {
+			*target = value
+		}
+	}
+	// 设为空字符串时不隐藏任何网卡
+	if value, ok := lookupEnv("DEVICE_EXCLUDE"); ok {
+		config.Capture.DeviceExclude = splitList(value)
+	}
+
+	// 命令行参数
+	flagStrings := []struct {
+		value  string
+		target *string
+	}{
+		{*listen, &config.Listen},
+		{*staticDir, &config.StaticDir},
+		{*logLevel, &config.Log.Level},
+		{*logDir, &config.Log.Dir},
+	}
+	for _, item := range flagStrings {
+		if item.value != "" {
+			*item.target = item.value
+		}
+	}
+
+	if config.StaticDir == "" {
+		config.StaticDir = defaultStaticDir()
+	}
+	if err := config.validate(); err != nil {
+		return AppConfig{}, "", err
+	}
+	return config, path, nil
+}
+
+// readConfigFile 按扩展名解析YAML或TOML配置文件，文件中的字段覆盖config中的默认值，不认识的字段视为错误
+func readConfigFile(path string, config *AppConfig) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		// 空文件视为没有设置任何字段
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	case ".toml":
+		return toml.NewDecoder(file).DisallowUnknownFields().Decode(config)
+	}
+	return fmt.Errorf("不支持的配置文件格式: %s", filepath.Ext(path))
+}
+
+// splitList 解析逗号分隔的列表，去除空白和空项
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// defaultStaticDir 优先使用可执行文件所在目录下的static，不存在时使用工作目录下的static
+func defaultStaticDir() string {
+	if executable, err := os.Executable(); err == nil {
+		dir := filepath.Join(filepath.Dir(executable), "static")
+		if _, err := os.Stat(filepath.Join(dir, "index.html")); err == nil {
+			return dir
+		}
+	}
+	return "static"
+}
+
+// validate 校验配置的取值范围
+func (config AppConfig) validate() error {
+	if _, _, err := net.SplitHostPort(config.Listen); err != nil {
+		return fmt.Errorf("无效的监听地址 %s: %v", config.Listen, err)
+	}
+	if _, err := util.ParseLogLevel(config.Log.Level); err != nil {
+		return err
+	}
+	if config.Log.File && config.Log.Dir == "" {
+		return errors.New("输出到日志文件时log.dir不能为空")
+	}
+
+	capture := config.Capture
+	switch capture.Backend {
+	case captureBackendPcap, captureBackendAFPacket:
+	default:
+		return fmt.Errorf("不支持的默认抓包后端: %s", capture.Backend)
+	}
+	// 与抓包请求的取值范围相同，见capture_validation.go
+	if capture.SnapshotLen < 1 || capture.SnapshotLen > maxSnapshotLen {
+		return fmt.Errorf("capture.snapshot_len应在1到%d之间: %d", maxSnapshotLen, capture.SnapshotLen)
+	}
+	if capture.Timeout < 1 || capture.Timeout > maxCaptureWait {
+		return fmt.Errorf("capture.timeout应在1到%d秒之间: %d", maxCaptureWait, capture.Timeout)
+	}
+	if capture.RingSizeMB < 1 || capture.RingSizeMB > maxRingSizeMB {
+		return fmt.Errorf("capture.ring_size_mb应在1到%d之间: %d", maxRingSizeMB, capture.RingSizeMB)
+	}
+	if capture.DecodeWorkers < 0 || capture.DecodeWorkers > config.Limits.MaxDecodeWorkers {
+		return fmt.Errorf("capture.decode_workers应在0到%d之间: %d", config.Limits.MaxDecodeWorkers, capture.DecodeWorkers)
+	}
+
+	limits := map[string]int{
+		"limits.max_raw_body_size":       config.Limits.MaxRawBodySize,
+		"limits.max_decoded_body_size":   config.Limits.MaxDecodedBodySize,
+		"limits.max_descriptor_set_size": config.Limits.MaxDescriptorSetSize,
+		"limits.max_decode_workers":      config.Limits.MaxDecodeWorkers,
+		"limits.max_tracked_tcp_flows":   config.Limits.MaxTrackedTCPFlows,
+	}
+	for name, value := range limits {
+		if value <= 0 {
+			return fmt.Errorf("%s应大于0: %d", name, value)
+		}
+	}
+
+	if config.Audit.LogFile == "" {
+		return errors.New("audit.log_file不能为空")
+	}
+	if config.Auth.UsersFile == "" {
+		return errors.New("auth.users_file不能为空")
+	}
+	for i, token := range config.Auth.Tokens {
+		if token.Token == "" {
+			return fmt.Errorf("auth.tokens中第%d个令牌为空", i+1)
+		}
+		if _, ok := roleLevels[token.Role]; !ok {
+			return fmt.Errorf("令牌 %s 的角色无效: %s", token.Name, token.Role)
+		}
+	}
+	return nil
+}
+
+// applyAppConfig 将配置应用到日志和各模块的全局设置
+func applyAppConfig() {
+	level, _ := util.ParseLogLevel(appConfig.Log.Level)
+	util.ConfigureLogger(level, appConfig.Log.Console, appConfig.Log.File, appConfig.Log.Dir)
+
+	maxRawBodySize = appConfig.Limits.MaxRawBodySize
+	maxDecodedBodySize = appConfig.Limits.MaxDecodedBodySize
+	maxDescriptorSetSize = appConfig.Limits.MaxDescriptorSetSize
+	maxDecodeWorkers = appConfig.Limits.MaxDecodeWorkers
+	maxTrackedTCPFlows = appConfig.Limits.MaxTrackedTCPFlows
+
+	deviceExcludes = appConfig.Capture.DeviceExclude
+	captureHelperSocket = appConfig.Capture.HelperSocket
+	authUsersPath = appConfig.Auth.UsersFile
+	auditLogPath = appConfig.Audit.LogFile
+}
+
+// applyCaptureDefaults 为抓包请求中未设置的字段填入配置的默认值
+func applyCaptureDefaults(config *CaptureConfig) {
+	defaults := appConfig.Capture
+	if config.SnapshotLen == 0 {
+		config.SnapshotLen = defaults.SnapshotLen
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.Backend == "" {
+		config.Backend = defaults.Backend
+	}
+	if config.RingSizeMB == 0 && config.Backend == captureBackendAFPacket {
+		config.RingSizeMB = defaults.RingSizeMB
+	}
+	if config.DecodeWorkers == 0 {
+		config.DecodeWorkers = defaults.DecodeWorkers
+	}
+}
+
+// masked 返回隐藏了令牌和密钥的配置副本
+func (config AppConfig) masked() AppConfig {
+	tokens := make([]staticToken, len(config.Auth.Tokens))
+	for i, token := range config.Auth.Tokens {
+		token.Token = maskedSecret
+		tokens[i] = token
+	}
+	config.Auth.Tokens = tokens
+	if config.Redaction.HashKey != "" {
+		config.Redaction.HashKey = maskedSecret
+	}
+	return config
+}
+
+// GetAppConfig 返回当前生效的配置，令牌和密钥已隐藏
+func GetAppConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"config": appConfig.masked(),
+		"file":   appConfigFile,
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mapEnv 返回从map读取环境变量的lookupEnv
+func mapEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestBuildAppConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, yamlFile, "listen: \"127.0.0.1:9001\"\nlog:\n  level: warn\ncapture:\n  snapshot_len: 2048\n  device_exclude: [\"docker\"]\n")
+	tomlFile := filepath.Join(dir, "config.toml")
+	writeTestFile(t, tomlFile, "listen = \"127.0.0.1:9002\"\n[log]\nlevel = \"error\"\n")
+
+	tests := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		wantListen  string
+		wantLevel   string
+		wantSnapLen int32
+		wantExclude []string
+		wantFile    string
+	}{
+		{
+			name:        "默认值",
+			wantListen:  ":8081",
+			wantLevel:   "info",
+			wantSnapLen: 1024,
+			wantExclude: []string{"utun"},
+		},
+		{
+			name:        "配置文件覆盖默认值",
+			args:        []string{"-config", yamlFile},
+			wantListen:  "127.0.0.1:9001",
+			wantLevel:   "warn",
+			wantSnapLen: 2048,
+			wantExclude: []string{"docker"},
+			wantFile:    yamlFile,
+		},
+		{
+			name:        "CONFIG_FILE指定TOML配置文件",
+			env:         map[string]string{"CONFIG_FILE": tomlFile},
+			wantListen:  "127.0.0.1:9002",
+			wantLevel:   "error",
+			wantSnapLen: 1024,
+			wantExclude: []string{"utun"},
+			wantFile:    tomlFile,
+		},
+		{
+			name:        "-config优先于CONFIG_FILE",
+			args:        []string{"-config", yamlFile},
+			env:         map[string]string{"CONFIG_FILE": tomlFile},
+			wantListen:  "127.0.0.1:9001",
+			wantLevel:   "warn",
+			wantSnapLen: 2048,
+			wantExclude: []string{"docker"},
+			wantFile:    yamlFile,
+		},
+		{
+			name:        "环境变量覆盖配置文件",
+			args:        []string{"-config", yamlFile},
+			env:         map[string]string{"LISTEN_ADDR": ":9100", "LOG_LEVEL": "debug", "DEVICE_EXCLUDE": "veth, br-"},
+			wantListen:  ":9100",
+			wantLevel:   "debug",
+			wantSnapLen: 2048,
+			wantExclude: []string{"veth", "br-"},
+			wantFile:    yamlFile,
+		},
+		{
+			name:        "空的DEVICE_EXCLUDE不隐藏网卡，空的LISTEN_ADDR忽略",
+			env:         map[string]string{"LISTEN_ADDR": "", "DEVICE_EXCLUDE": ""},
+			wantListen:  ":8081",
+			wantLevel:   "info",
+			wantSnapLen: 1024,
+			wantExclude: []string{},
+		},
+		{
+			name:        "命令行参数覆盖环境变量",
+			args:        []string{"-config", yamlFile, "-listen", ":9200", "-log-level", "error"},
+			env:         map[string]string{"LISTEN_ADDR": ":9100", "LOG_LEVEL": "debug"},
+			wantListen:  ":9200",
+			wantLevel:   "error",
+			wantSnapLen: 2048,
+			wantExclude: []string{"docker"},
+			wantFile:    yamlFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, path, err := buildAppConfig(tt.args, mapEnv(tt.env))
+			if err != nil {
+				t.Fatalf("buildAppConfig() error = %v", err)
+			}
+			if path != tt.wantFile {
+				t.Errorf("path = %q, want %q", path, tt.wantFile)
+			}
+			if config.Listen != tt.wantListen {
+				t.Errorf("Listen = %q, want %q", config.Listen, tt.wantListen)
+			}
+			if config.Log.Level != tt.wantLevel {
+				t.Errorf("Log.Level = %q, want %q", config.Log.Level, tt.wantLevel)
+			}
+			if config.Capture.SnapshotLen != tt.wantSnapLen {
+				t.Errorf("Capture.SnapshotLen = %d, want %d", config.Capture.SnapshotLen, tt.wantSnapLen)
+			}
+			if strings.Join(config.Capture.DeviceExclude, ",") != strings.Join(tt.wantExclude, ",") || config.Capture.DeviceExclude == nil {
+				t.Errorf("Capture.DeviceExclude = %v, want %v", config.Capture.DeviceExclude, tt.wantExclude)
+			}
+		})
+	}
+}
+
+func TestBuildAppConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	unknown := filepath.Join(dir, "unknown.yaml")
+	writeTestFile(t, unknown, "listen: \":8081\"\nlisten_port: 8081\n")
+	unknownToml := filepath.Join(dir, "unknown.toml")
+	writeTestFile(t, unknownToml, "[capture]\nsnaplen = 10\n")
+	outOfRange := filepath.Join(dir, "range.yaml")
+	writeTestFile(t, outOfRange, "capture:\n  snapshot_len: 0\n")
+	unsupported := filepath.Join(dir, "config.json")
+	writeTestFile(t, unsupported, "{}")
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{"YAML中不认识的字段", []string{"-config", unknown}, nil},
+		{"TOML中不认识的字段", []string{"-config", unknownToml}, nil},
+		{"取值超出范围", []string{"-config", outOfRange}, nil},
+		{"不支持的扩展名", []string{"-config", unsupported}, nil},
+		{"配置文件不存在", []string{"-config", filepath.Join(dir, "missing.yaml")}, nil},
+		{"无效的监听地址", []string{"-listen", "8081"}, nil},
+		{"无效的日志级别", nil, map[string]string{"LOG_LEVEL": "verbose"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := buildAppConfig(tt.args, mapEnv(tt.env)); err == nil {
+				t.Errorf("buildAppConfig() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestAppConfigMasked(t *testing.T) {
+	config := defaultAppConfig()
+	config.Auth.Tokens = []staticToken{{Name: "ci", Token: "secret", Role: roleOperator}}
+	config.Redaction.HashKey = "key"
+
+	masked := config.masked()
+	if masked.Auth.Tokens[0].Token != maskedSecret || masked.Redaction.HashKey != maskedSecret {
+		t.Errorf("masked() = %+v, want secrets replaced", masked)
+	}
+	if config.Auth.Tokens[0].Token != "secret" {
+		t.Errorf("masked() modified the original tokens")
+	}
+}
+
+// writeTestFile 写入测试使用的临时文件
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"abc/a/util"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/gopacket/pcap"
+)
+
+const (
+	// 流量采样默认时长和最长时长（毫秒）
+	defaultRateSampleMillis = 1000
+	maxRateSampleMillis     = 5000
+	// 链路类型的缓存时间，期间不再打开网卡查询；没有权限时的空结果同样缓存
+	linkTypeCacheTTL = 5 * time.Minute
+)
+
+// pcap_if_t中的标志位
+const (
+	pcapIfLoopback = 0x00000001
+	pcapIfUp       = 0x00000002
+	pcapIfRunning  = 0x00000004
+)
+
+// 隐藏的网卡名称关键字，由配置的capture.device_exclude或环境变量DEVICE_EXCLUDE设置，启动后只读
+var deviceExcludes = []string{"utun"}
+
+// 按网卡名称缓存的链路类型
+var linkTypeCache = struct {
+	mutex   sync.Mutex
+	entries map[string]linkTypeEntry
+}{entries: make(map[string]linkTypeEntry)}
+
+// 缓存的链路类型，打开网卡失败时为空
+type linkTypeEntry struct {
+	linkType  string
+	expiresAt time.Time
+}
+
+// 网卡设备信息
+type DeviceInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Addresses   []DeviceAddress `json:"addresses"`
+	Loopback    bool            `json:"loopback"`
+	Up          bool            `json:"up"`
+	Running     bool            `json:"running"`
+	LinkType    string          `json:"link_type,omitempty"`
+	MTU         int             `json:"mtu,omitempty"`
+	Rate        *DeviceRate     `json:"rate,omitempty"` // 请求rate=true时返回
+}
+
+// 网卡地址
+type DeviceAddress struct {
+	IP        string `json:"ip"`
+	Netmask   string `json:"netmask,omitempty"`
+	Broadcast string `json:"broadcast,omitempty"`
+	Family    string `json:"family"` // ipv4 / ipv6
+}
+
+// 网卡实时流量，通过短时间采样得到
+type DeviceRate struct {
+	PacketsPerSecond float64 `json:"packets_per_second"`
+	BytesPerSecond   float64 `json:"bytes_per_second"`
+	Error            string  `json:"error,omitempty"` // 采样失败的原因，如没有权限
+}
+
+// ListDevices 列出网卡设备及其地址、状态和链路类型。
+// 查询参数all=true时不隐藏排除的网卡；rate=true时对每个网卡采样sample_ms毫秒的流量
+func ListDevices(c *gin.Context) {
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		util.Log.Logger.Error("获取设备列表失败: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	util.Log.Logger.Info("获取设备列表成功，设备数量: %d, IP: %s", len(devices), c.ClientIP())
+
+	includeAll := c.Query("all") == "true"
+	infos := make([]DeviceInfo, 0, len(devices))
+	for _, device := range devices {
+		if !includeAll && isExcludedDevice(device.Name) {
+			continue
+		}
+		infos = append(infos, newDeviceInfo(device))
+	}
+
+	if c.Query("rate") == "true" {
+		sample := defaultRateSampleMillis
+		if value := c.Query("sample_ms"); value != "" {
+			sample, err = strconv.Atoi(value)
+			if err != nil || sample <= 0 || sample > maxRateSampleMillis {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sample_ms需要在1到" + strconv.Itoa(maxRateSampleMillis) + "之间"})
+				return
+			}
+		}
+		sampleDeviceRates(infos, time.Duration(sample)*time.Millisecond)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": infos, "excluded": deviceExcludes})
+}
+
+// isExcludedDevice 判断网卡名称是否包含需要隐藏的关键字
+func isExcludedDevice(name string) bool {
+	for _, pattern := range deviceExcludes {
+		if strings.Contains(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// newDeviceInfo 合并pcap和系统网络接口的信息
+func newDeviceInfo(device pcap.Interface) DeviceInfo {
+	info := DeviceInfo{
+		Name:        device.Name,
+		Description: device.Description,
+		Addresses:   make([]DeviceAddress, 0, len(device.Addresses)),
+		Loopback:    device.Flags&pcapIfLoopback != 0,
+		Up:          device.Flags&pcapIfUp != 0,
+		Running:     device.Flags&pcapIfRunning != 0,
+	}
+	for _, address := range device.Addresses {
+		if address.IP == nil {
+			continue
+		}
+		item := DeviceAddress{IP: address.IP.String(), Family: "ipv6"}
+		if address.IP.To4() != nil {
+			item.Family = "ipv4"
+		}
+		if address.Netmask != nil {
+			item.Netmask = net.IP(address.Netmask).String()
+		}
+		if address.Broadaddr != nil {
+			item.Broadcast = address.Broadaddr.String()
+		}
+		info.Addresses = append(info.Addresses, item)
+	}
+
+	// pcap没有提供MTU，从系统网络接口获取；any等伪设备不存在对应的系统接口
+	if iface, err := net.InterfaceByName(device.Name); err == nil {
+		info.MTU = iface.MTU
+		info.Up = info.Up || iface.Flags&net.FlagUp != 0
+		info.Loopback = info.Loopback || iface.Flags&net.FlagLoopback != 0
+	}
+
+	info.LinkType = deviceLinkType(device.Name)
+	return info
+}
+
+// deviceLinkType 返回网卡的链路类型，没有权限时为空。
+// 链路类型需要打开网卡才能获取，结果缓存linkTypeCacheTTL，避免每次列出设备都打开所有网卡
+func deviceLinkType(name string) string {
+	linkTypeCache.mutex.Lock()
+	entry, ok := linkTypeCache.entries[name]
+	linkTypeCache.mutex.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.linkType
+	}
+
+	entry = linkTypeEntry{expiresAt: time.Now().Add(linkTypeCacheTTL)}
+	if handle, err := openCaptureSource(captureSourceOptions{Device: name, SnapLen: 64, Timeout: time.Millisecond}); err == nil {
+		entry.linkType = handle.LinkType().String()
+		handle.Close()
+	}
+	linkTypeCache.mutex.Lock()
+	linkTypeCache.entries[name] = entry
+	linkTypeCache.mutex.Unlock()
+	return entry.linkType
+}
+
+// sampleDeviceRates 同时对所有网卡采样一段时间，计算每秒的数据包数和字节数
+func sampleDeviceRates(infos []DeviceInfo, duration time.Duration) {
+	var wg sync.WaitGroup
+	for i := range infos {
+		wg.Add(1)
+		go func(info *DeviceInfo) {
+			defer wg.Done()
+			info.Rate = sampleDeviceRate(info.Name, duration)
+		}(&infos[i])
+	}
+	wg.Wait()
+}
+
+// sampleDeviceRate 对单个网卡采样，只抓取数据包头部，字节数按数据包原始长度计算
+func sampleDeviceRate(deviceName string, duration time.Duration) *DeviceRate {
+	handle, err := openCaptureSource(captureSourceOptions{Device: deviceName, SnapLen: 96, Timeout: 100 * time.Millisecond})
+	if err != nil {
+		return &DeviceRate{Error: err.Error()}
+	}
+	defer handle.Close()
+
+	var packets, bytes int64
+	start := time.Now()
+	deadline := start.Add(duration)
+	for time.Now().Before(deadline) {
+		_, info, err := handle.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		}
+		if err != nil {
+			return &DeviceRate{Error: err.Error()}
+		}
+		packets++
+		bytes += int64(info.Length)
+	}
+
+	seconds := time.Since(start).Seconds()
+	return &DeviceRate{
+		PacketsPerSecond: float64(packets) / seconds,
+		BytesPerSecond:   float64(bytes) / seconds,
+	}
+}
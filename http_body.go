@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/klauspost/compress/zstd"
+)
+
+// 内容大小限制，可通过配置文件的limits调整，启动后只读
+var (
+	// 保存的原始内容最大字节数
+	maxRawBodySize = 1 << 20
+	// 解码后内容的最大字节数，超出部分丢弃，避免压缩炸弹占用过多内存
+	maxDecodedBodySize = 4 << 20
+)
+
+// HTTP消息内容，同时保存原始内容和按Transfer-Encoding、Content-Encoding解码后的内容。
+// 请求和响应使用相同的解码方式，只包含请求行或状态行所在数据包中的部分，跨数据包的内容标记为Incomplete
+type HTTPBody struct {
+	Raw         []byte   `json:"-"`                      // 数据包中的原始内容，可能是压缩或分块的数据
+	RawSize     int      `json:"raw_size"`               // 原始内容的字节数，不受maxRawBodySize限制
+	Decoded     []byte   `json:"-"`                      // 解码后的内容，没有编码时为空，与Raw相同
+	DecodedSize int      `json:"decoded_size,omitempty"` // 解码后内容的字节数
+	Encodings   []string `json:"encodings,omitempty"`    // 按解码顺序依次应用的编码，如["chunked", "gzip"]
+	DecodeError string   `json:"decode_error,omitempty"` // 解码失败的原因，解码出的部分内容仍然保留在Decoded中
+
+	Truncated            bool `json:"truncated"`              // 数据包被snapshot_len截断
+	Incomplete           bool `json:"incomplete"`             // 内容比Content-Length短或分块没有结束，其余部分在后续数据包中，不会被合并
+	RawLimitExceeded     bool `json:"raw_limit_exceeded"`     // 原始内容超过maxRawBodySize，raw只保留前面部分
+	DecodedLimitExceeded bool `json:"decoded_limit_exceeded"` // 解码后内容超过maxDecodedBodySize，decoded只保留前面部分
+
+	// 根据内容识别的MIME类型，识别的开销较大，第一次输出时才计算
+	detected *detectedMIME
+}
+
+// 延迟计算的MIME类型，HTTPBody复制后共享同一个结果
+type detectedMIME struct {
+	once  sync.Once
+	value string
+}
+
+// MarshalJSON 内容是UTF-8文本时直接输出字符串，否则输出base64，编码方式见raw_encoding、decoded_encoding。
+// detected_type为根据内容识别的MIME类型，与Content-Type无关
+func (body HTTPBody) MarshalJSON() ([]byte, error) {
+	type plainBody HTTPBody
+	raw, rawEncoding := encodeBodyBytes(body.Raw)
+	output := struct {
+		plainBody
+		Raw             string `json:"raw"`
+		RawEncoding     string `json:"raw_encoding"`
+		Decoded         string `json:"decoded,omitempty"`
+		DecodedEncoding string `json:"decoded_encoding,omitempty"`
+		DetectedType    string `json:"detected_type"`
+	}{plainBody: plainBody(body), Raw: raw, RawEncoding: rawEncoding, DetectedType: body.detectedType()}
+	if len(body.Encodings) > 0 {
+		output.Decoded, output.DecodedEncoding = encodeBodyBytes(body.Decoded)
+	}
+	return json.Marshal(output)
+}
+
+// encodeBodyBytes 把内容转换为JSON字符串，不是有效的UTF-8时使用base64
+func encodeBodyBytes(data []byte) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), "utf8"
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+// 分块数据在数据包中没有结束
+var errIncompleteChunked = errors.New("分块数据不完整")
+
+// decodeHTTPBody 按消息头中的Transfer-Encoding和Content-Encoding解码消息内容。
+// truncated表示数据包被snapshot_len截断；消息没有内容时返回nil
+func decodeHTTPBody(headers []HTTPHeader, raw []byte, contentLength int64, truncated bool) *HTTPBody {
+	transferEncodings := headerTokens(headers, "Transfer-Encoding")
+	contentEncodings := headerTokens(headers, "Content-Encoding")
+	if len(raw) == 0 && contentLength <= 0 && len(transferEncodings) == 0 {
+		return nil
+	}
+
+	body := &HTTPBody{
+		RawSize:   len(raw),
+		Truncated: truncated,
+	}
+	if len(raw) > maxRawBodySize {
+		body.Raw = append([]byte(nil), raw[:maxRawBodySize]...)
+		body.RawLimitExceeded = true
+	} else {
+		body.Raw = raw
+	}
+	if contentLength > int64(len(raw)) {
+		body.Incomplete = true
+	}
+
+	// 编码按应用的顺序列出，解码时从最后一个开始
+	encodings := append(contentEncodings, transferEncodings...)
+	data := raw
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := encodings[i]
+		if encoding == "identity" {
+			continue
+		}
+		decoded, limited, err := decodeContent(encoding, data)
+		body.Encodings = append(body.Encodings, encoding)
+		data = decoded
+		body.DecodedLimitExceeded = body.DecodedLimitExceeded || limited
+		if err != nil {
+			if errors.Is(err, errIncompleteChunked) || errors.Is(err, io.ErrUnexpectedEOF) {
+				body.Incomplete = true
+			}
+			body.DecodeError = fmt.Sprintf("%s: %v", encoding, err)
+			break
+		}
+	}
+
+	if len(body.Encodings) > 0 {
+		body.Decoded = data
+		body.DecodedSize = len(data)
+	}
+	body.detected = &detectedMIME{}
+	return body
+}
+
+// detectedType 返回根据内容识别的MIME类型，只在第一次调用时识别。
+// 保存之后内容不再修改，可以在多个协程中同时调用
+func (body *HTTPBody) detectedType() string {
+	if body.detected == nil {
+		return mimetype.Detect(body.content()).String()
+	}
+	body.detected.once.Do(func() {
+		body.detected.value = mimetype.Detect(body.content()).String()
+	})
+	return body.detected.value
+}
+
+// content 返回消息内容，有编码时为解码后的内容
+func (body *HTTPBody) content() []byte {
+	if body == nil {
+		return nil
+	}
+	if len(body.Encodings) > 0 {
+		return body.Decoded
+	}
+	return body.Raw
+}
+
+// rawContent 返回数据包中的原始内容
+func (body *HTTPBody) rawContent() []byte {
+	if body == nil {
+		return nil
+	}
+	return body.Raw
+}
+
+// text 返回消息内容的文本形式，不是UTF-8文本时返回空字符串
+func (body *HTTPBody) text() string {
+	content := body.content()
+	if !utf8.Valid(content) {
+		return ""
+	}
+	return string(content)
+}
+
+// headerTokens 返回消息头中以逗号分隔的全部取值，转为小写
+func headerTokens(headers []HTTPHeader, name string) []string {
+	var tokens []string
+	for _, header := range headers {
+		if !strings.EqualFold(header.Name, name) {
+			continue
+		}
+		for _, token := range strings.Split(header.Value, ",") {
+			if token = strings.ToLower(strings.TrimSpace(token)); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// decodeContent 按一种编码解码数据，出错时返回已经解码出的部分内容。
+// 解码后的内容超过maxDecodedBodySize时截断并返回limited为true
+func decodeContent(encoding string, data []byte) (decoded []byte, limited bool, err error) {
+	if encoding == "chunked" {
+		return decodeChunked(data)
+	}
+
+	var reader io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, false, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case "deflate":
+		// HTTP的deflate应为zlib格式，部分服务端直接发送不带zlib头部的deflate数据
+		zlibReader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			flateReader := flate.NewReader(bytes.NewReader(data))
+			defer flateReader.Close()
+			reader = flateReader
+		} else {
+			defer zlibReader.Close()
+			reader = zlibReader
+		}
+	case "br":
+		reader = brotli.NewReader(bytes.NewReader(data))
+	case "zstd":
+		zstdReader, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderMaxMemory(uint64(maxDecodedBodySize)*2))
+		if err != nil {
+			return nil, false, err
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		return data, false, fmt.Errorf("不支持的编码")
+	}
+
+	decoded, err = io.ReadAll(io.LimitReader(reader, int64(maxDecodedBodySize)+1))
+	if len(decoded) > maxDecodedBodySize {
+		return decoded[:maxDecodedBodySize], true, nil
+	}
+	return decoded, false, err
+}
+
+// decodeChunked 解码分块传输的数据，忽略分块扩展和结尾的trailer
+func decodeChunked(data []byte) (decoded []byte, limited bool, err error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	var buffer bytes.Buffer
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return buffer.Bytes(), false, errIncompleteChunked
+		}
+		sizeText, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeText), 16, 64)
+		if err != nil || size < 0 {
+			return buffer.Bytes(), false, fmt.Errorf("无效的分块长度: %q", sizeText)
+		}
+		if size == 0 {
+			return buffer.Bytes(), false, nil
+		}
+		if remaining := int64(maxDecodedBodySize - buffer.Len()); size > remaining {
+			io.CopyN(&buffer, reader, remaining)
+			return buffer.Bytes(), true, nil
+		}
+		if _, err := io.CopyN(&buffer, reader, size); err != nil {
+			return buffer.Bytes(), false, errIncompleteChunked
+		}
+		// 每个分块之后的CRLF
+		if _, err := reader.ReadString('\n'); err != nil {
+			return buffer.Bytes(), false, errIncompleteChunked
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// 消息方向
+const (
+	directionRequest  = "request"
+	directionResponse = "response"
+)
+
+// 每个连接最多记录的等待响应的请求数，HTTP管线化时一个连接上可能有多个请求在等待响应
+const maxPendingRequests = 16
+
+// 解码协程的连接状态，不加锁，只能在一个协程中使用。
+// 流水线按flowHash分配数据包，同一个连接两个方向的数据包总是由同一个协程解码
+type decodeState struct {
+	gaps     *tcpGapTracker      // TCP序号跟踪，统计重组缺口
+	requests *httpRequestTracker // 等待响应的请求，用于保存对应的响应
+}
+
+// newDecodeState 创建解码协程的连接状态，shards个协程平分maxTrackedTCPFlows
+func newDecodeState(shards int) *decodeState {
+	gaps := newTCPGapTracker(shards)
+	return &decodeState{
+		gaps:     gaps,
+		requests: &httpRequestTracker{limit: gaps.limit, pending: make(map[tcpFlowKey][]pendingRequest)},
+	}
+}
+
+// 已保存、尚未收到响应的请求，按连接记录。
+// 只有保存过请求的连接才保存响应，响应与请求使用相同的过滤条件
+type httpRequestTracker struct {
+	limit   int // 最多记录的连接数，超出时清空重新记录
+	pending map[tcpFlowKey][]pendingRequest
+}
+
+// 等待响应的请求，只保留响应需要的字段
+type pendingRequest struct {
+	method string
+	path   string
+	host   string
+}
+
+// requestFlowKey 返回请求方向的连接标识
+func requestFlowKey(packet gopacket.Packet, tcp *layers.TCP) (tcpFlowKey, bool) {
+	network := packet.NetworkLayer()
+	if network == nil {
+		return tcpFlowKey{}, false
+	}
+	return tcpFlowKey{network: network.NetworkFlow(), transport: tcp.TransportFlow()}, true
+}
+
+// responseFlowKey 返回响应数据包对应的请求方向的连接标识
+func responseFlowKey(packet gopacket.Packet, tcp *layers.TCP) (tcpFlowKey, bool) {
+	network := packet.NetworkLayer()
+	if network == nil {
+		return tcpFlowKey{}, false
+	}
+	return tcpFlowKey{network: network.NetworkFlow().Reverse(), transport: tcp.TransportFlow().Reverse()}, true
+}
+
+// add 记录连接上已保存的请求
+func (t *httpRequestTracker) add(key tcpFlowKey, request pendingRequest) {
+	if len(t.pending) >= t.limit {
+		t.pending = make(map[tcpFlowKey][]pendingRequest)
+	}
+	queue := t.pending[key]
+	if len(queue) >= maxPendingRequests {
+		queue = queue[1:]
+	}
+	t.pending[key] = append(queue, request)
+}
+
+// match 返回响应对应的请求，即连接上最早一个尚未收到最终响应的请求。
+// final为false（1xx响应）时请求继续等待最终响应
+func (t *httpRequestTracker) match(key tcpFlowKey, final bool) (pendingRequest, bool) {
+	queue := t.pending[key]
+	if len(queue) == 0 {
+		return pendingRequest{}, false
+	}
+	request := queue[0]
+	if final {
+		if len(queue) == 1 {
+			delete(t.pending, key)
+		} else {
+			t.pending[key] = queue[1:]
+		}
+	}
+	return request, true
+}
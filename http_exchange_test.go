@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// exchangePacket 构造客户端10.0.0.1:40000与服务端10.0.0.2:80之间的数据包，
+// fromClient为false时是服务端发往客户端的响应
+func exchangePacket(t *testing.T, fromClient bool, payload string) gopacket.Packet {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: client, DstIP: server}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: 80, Seq: 100, ACK: true, Window: 65535}
+	if !fromClient {
+		ip.SrcIP, ip.DstIP = server, client
+		tcp.SrcPort, tcp.DstPort = 80, 40000
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buffer := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true}, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+}
+
+// gzipText 返回gzip压缩后的文本
+func gzipText(t *testing.T, text string) string {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.String()
+}
+
+func TestParseHTTPResponsePayload(t *testing.T) {
+	compressed := gzipText(t, `{"ok":true}`)
+	tests := []struct {
+		name       string
+		payload    string
+		hasBody    bool
+		truncated  bool
+		status     int
+		content    string
+		noBody     bool
+		incomplete bool
+	}{
+		{
+			name:    "gzip",
+			payload: fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\n\r\n%s", len(compressed), compressed),
+			hasBody: true,
+			status:  200,
+			content: `{"ok":true}`,
+		},
+		{
+			name:    "chunked",
+			payload: "HTTP/1.1 404 Not Found\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+			hasBody: true,
+			status:  404,
+			content: "hello",
+		},
+		{
+			name:       "truncated",
+			payload:    "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\nabc",
+			hasBody:    true,
+			truncated:  true,
+			status:     200,
+			content:    "abc",
+			incomplete: true,
+		},
+		{
+			name:    "not modified",
+			payload: "HTTP/1.1 304 Not Modified\r\nContent-Length: 100\r\n\r\n",
+			status:  304,
+			noBody:  true,
+		},
+	}
+	for _, tt := range tests {
+		var packetInfo PacketInfo
+		parseHTTPResponsePayload(&packetInfo, tt.payload, tt.hasBody, tt.truncated)
+		if packetInfo.Direction != directionResponse || packetInfo.StatusCode != tt.status || packetInfo.HTTPVersion != "HTTP/1.1" {
+			t.Errorf("%s: 方向 %q、状态码 %d、协议版本 %q 不正确", tt.name, packetInfo.Direction, packetInfo.StatusCode, packetInfo.HTTPVersion)
+		}
+		if tt.noBody {
+			if packetInfo.Body != nil {
+				t.Errorf("%s: 没有内容的响应不应填充body", tt.name)
+			}
+			continue
+		}
+		if packetInfo.Body == nil {
+			t.Fatalf("%s: 没有解析出body", tt.name)
+		}
+		if packetInfo.Content != tt.content {
+			t.Errorf("%s: 内容为 %q，应为 %q", tt.name, packetInfo.Content, tt.content)
+		}
+		if packetInfo.Body.Truncated != tt.truncated || packetInfo.Body.Incomplete != tt.incomplete {
+			t.Errorf("%s: truncated为 %v、incomplete为 %v，应为 %v、%v", tt.name, packetInfo.Body.Truncated, packetInfo.Body.Incomplete, tt.truncated, tt.incomplete)
+		}
+	}
+}
+
+func TestHTTPRequestTrackerMatch(t *testing.T) {
+	tracker := newDecodeState(1).requests
+	request := exchangePacket(t, true, "GET / HTTP/1.1\r\n\r\n")
+	response := exchangePacket(t, false, "HTTP/1.1 200 OK\r\n\r\n")
+	requestKey, _ := requestFlowKey(request, request.Layer(layers.LayerTypeTCP).(*layers.TCP))
+	responseKey, _ := responseFlowKey(response, response.Layer(layers.LayerTypeTCP).(*layers.TCP))
+	if requestKey != responseKey {
+		t.Fatal("响应的连接标识与请求不一致")
+	}
+
+	// 管线化的请求按顺序对应响应，1xx响应不结束等待
+	tracker.add(requestKey, pendingRequest{method: "POST", path: "/a"})
+	tracker.add(requestKey, pendingRequest{method: "GET", path: "/b"})
+	for _, step := range []struct {
+		final bool
+		path  string
+	}{{false, "/a"}, {true, "/a"}, {true, "/b"}} {
+		got, ok := tracker.match(responseKey, step.final)
+		if !ok || got.path != step.path {
+			t.Errorf("对应的请求为 %q，应为 %q", got.path, step.path)
+		}
+	}
+	if _, ok := tracker.match(responseKey, true); ok {
+		t.Error("所有请求都已收到响应后不应再对应请求")
+	}
+}
+
+func TestDecodeHTTPExchange(t *testing.T) {
+	task := newBenchmarkTask()
+	config := CaptureConfig{Protocols: []string{"http"}, PathFilter: "/api"}
+	state := newDecodeState(1)
+
+	// 没有对应请求的响应被跳过，不计为过滤
+	if _, ok := decodePacket(exchangePacket(t, false, "HTTP/1.1 200 OK\r\n\r\n"), "eth0", task, config, state); ok {
+		t.Error("没有对应请求的响应不应保存")
+	}
+	// 不符合过滤条件的请求不保存，它的响应也不保存
+	decodePacket(exchangePacket(t, true, "GET /static HTTP/1.1\r\nHost: example.com\r\n\r\n"), "eth0", task, config, state)
+	if _, ok := decodePacket(exchangePacket(t, false, "HTTP/1.1 200 OK\r\n\r\n"), "eth0", task, config, state); ok {
+		t.Error("未保存请求的响应不应保存")
+	}
+	if got := task.counters.filteredOut.Load(); got != 1 {
+		t.Errorf("过滤的数据包为 %d，应为1", got)
+	}
+
+	if _, ok := decodePacket(exchangePacket(t, true, "HEAD /api/users HTTP/1.1\r\nHost: example.com\r\n\r\n"), "eth0", task, config, state); !ok {
+		t.Fatal("符合过滤条件的请求没有保存")
+	}
+	info, ok := decodePacket(exchangePacket(t, false, "HTTP/1.1 200 OK\r\nContent-Length: 512\r\n\r\n"), "eth0", task, config, state)
+	if !ok {
+		t.Fatal("已保存请求的响应没有保存")
+	}
+	if info.Direction != directionResponse || info.StatusLine != "HTTP/1.1 200 OK" || info.Method != "HEAD" || info.Path != "/api/users" || info.Host != "example.com" || info.Interface != "eth0" {
+		t.Errorf("响应的字段不正确: %+v", info)
+	}
+	if info.Body != nil {
+		t.Error("HEAD请求的响应不应填充body")
+	}
+
+	// 响应不计入匹配的请求数
+	storePacket(task, info)
+	if got := task.matchedRequests.Load(); got != 0 {
+		t.Errorf("匹配的请求数为 %d，响应不应计入", got)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HTTP消息头，保留原始的大小写和顺序
+type HTTPHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Cookie头中的一项
+type HTTPCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// parseHTTPPayload 解析数据包中的HTTP请求行、请求头和请求内容，填充到packetInfo。
+// 数据包可能只包含请求的一部分，缺少的字段保持为空；truncated表示数据包被snapshot_len截断
+func parseHTTPPayload(packetInfo *PacketInfo, dataStr string, truncated bool) {
+	head, body, _ := strings.Cut(dataStr, "\r\n\r\n")
+	lines := strings.Split(head, "\r\n")
+
+	// 请求行：方法 请求目标 协议版本
+	packetInfo.Direction = directionRequest
+	packetInfo.RequestLine = lines[0]
+	parts := strings.Fields(lines[0])
+	if len(parts) > 0 {
+		packetInfo.Method = strings.ToUpper(parts[0])
+	}
+	if len(parts) > 1 {
+		packetInfo.Path = parts[1]
+		if _, rawQuery, ok := strings.Cut(parts[1], "?"); ok {
+			// 无法解析的参数会被跳过，已解析的参数仍然保留
+			packetInfo.Query, _ = url.ParseQuery(rawQuery)
+		}
+	}
+	if len(parts) > 2 {
+		packetInfo.HTTPVersion = parts[2]
+	}
+
+	parseHTTPMessage(packetInfo, lines[1:], body, true, truncated)
+}
+
+// parseHTTPResponsePayload 解析数据包中的HTTP状态行、响应头和响应内容，填充到packetInfo。
+// hasBody为false时响应没有内容（HEAD请求的响应、1xx、204和304），Content-Length只描述对应的资源
+func parseHTTPResponsePayload(packetInfo *PacketInfo, dataStr string, hasBody bool, truncated bool) {
+	head, body, _ := strings.Cut(dataStr, "\r\n\r\n")
+	lines := strings.Split(head, "\r\n")
+
+	// 状态行：协议版本 状态码 原因短语
+	packetInfo.Direction = directionResponse
+	packetInfo.StatusLine = lines[0]
+	packetInfo.HTTPVersion, _, _ = strings.Cut(lines[0], " ")
+	if status, ok := parseHTTPStatus(lines[0]); ok {
+		packetInfo.StatusCode = status
+	}
+
+	parseHTTPMessage(packetInfo, lines[1:], body, hasBody, truncated)
+}
+
+// parseHTTPMessage 解析请求和响应共同的消息头和消息内容
+func parseHTTPMessage(packetInfo *PacketInfo, headerLines []string, body string, hasBody bool, truncated bool) {
+	packetInfo.ContentLength = -1
+	packetInfo.Headers = parseHTTPHeaders(headerLines)
+	for _, header := range packetInfo.Headers {
+		switch strings.ToLower(header.Name) {
+		case "host":
+			if packetInfo.Host == "" {
+				packetInfo.Host = header.Value
+			}
+		case "content-type":
+			packetInfo.ContentType = header.Value
+		case "content-length":
+			if length, err := strconv.ParseInt(header.Value, 10, 64); err == nil && length >= 0 {
+				packetInfo.ContentLength = length
+			}
+		case "cookie":
+			packetInfo.Cookies = append(packetInfo.Cookies, parseCookieHeader(header.Value)...)
+		}
+	}
+	if !hasBody {
+		return
+	}
+
+	// 解码分块和压缩的内容，content只保存文本形式，二进制内容见body
+	packetInfo.Body = decodeHTTPBody(packetInfo.Headers, []byte(body), packetInfo.ContentLength, truncated)
+	packetInfo.Content = packetInfo.Body.text()
+}
+
+// parseHTTPHeaders 按顺序解析消息头，以空格或制表符开头的行是上一个消息头的续行
+func parseHTTPHeaders(lines []string) []HTTPHeader {
+	headers := make([]HTTPHeader, 0, len(lines))
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			last := &headers[len(headers)-1]
+			last.Value = strings.TrimSpace(last.Value + " " + strings.TrimSpace(line))
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			continue
+		}
+		headers = append(headers, HTTPHeader{Name: name, Value: strings.TrimSpace(value)})
+	}
+	return headers
+}
+
+// parseCookieHeader 解析Cookie头中以分号分隔的name=value
+func parseCookieHeader(value string) []HTTPCookie {
+	var cookies []HTTPCookie
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, cookieValue, _ := strings.Cut(part, "=")
+		cookies = append(cookies, HTTPCookie{
+			Name:  strings.TrimSpace(name),
+			Value: strings.Trim(strings.TrimSpace(cookieValue), `"`),
+		})
+	}
+	return cookies
+}
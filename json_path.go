@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPath的一个步骤，如.name、[0]、[*]、..name
+type jsonPathStep struct {
+	recursive bool // ..，在所有后代中查找
+	wildcard  bool // *或[*]
+	name      string
+	index     *int
+	slice     *[2]*int // [start:end]，省略的一端为nil
+}
+
+// queryJSONPath 在JSON树中按JSONPath查询，返回所有匹配的值。
+// 支持 $、.name、['name']、[n]（n可以为负数）、[start:end]、*、[*] 和 ..name、..*
+func queryJSONPath(root interface{}, path string) ([]interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := []interface{}{root}
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range current {
+			if step.recursive {
+				for _, descendant := range jsonDescendants(value) {
+					next = append(next, step.apply(descendant)...)
+				}
+			} else {
+				next = append(next, step.apply(value)...)
+			}
+		}
+		current = next
+	}
+	if current == nil {
+		current = []interface{}{}
+	}
+	return current, nil
+}
+
+// parseJSONPath 把JSONPath表达式解析为步骤列表
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath必须以$开头")
+	}
+
+	var steps []jsonPathStep
+	rest := path[1:]
+	for rest != "" {
+		var step jsonPathStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			name, remaining := cutJSONPathName(rest)
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath的..之后缺少名称: %s", path)
+			}
+			step.setName(name)
+			steps = append(steps, step)
+			rest = remaining
+			continue
+		case strings.HasPrefix(rest, "."):
+			name, remaining := cutJSONPathName(rest[1:])
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath的.之后缺少名称: %s", path)
+			}
+			step.setName(name)
+			steps = append(steps, step)
+			rest = remaining
+			continue
+		case !strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("无效的JSONPath: %s", path)
+		}
+
+		// 方括号
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("JSONPath缺少]: %s", path)
+		}
+		if err := step.parseBracket(strings.TrimSpace(rest[1:end])); err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+		rest = rest[end+1:]
+	}
+	return steps, nil
+}
+
+// cutJSONPathName 读取.之后的名称，到下一个.或[为止
+func cutJSONPathName(s string) (string, string) {
+	end := strings.IndexAny(s, ".[")
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], s[end:]
+}
+
+func (step *jsonPathStep) setName(name string) {
+	if name == "*" {
+		step.wildcard = true
+	} else {
+		step.name = name
+	}
+}
+
+// parseBracket 解析方括号内的内容：'name'、"name"、*、n、start:end
+func (step *jsonPathStep) parseBracket(content string) error {
+	switch {
+	case content == "*":
+		step.wildcard = true
+	case len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0]:
+		step.name = content[1 : len(content)-1]
+	case strings.Contains(content, ":"):
+		startText, endText, _ := strings.Cut(content, ":")
+		var bounds [2]*int
+		for i, text := range []string{startText, endText} {
+			if text = strings.TrimSpace(text); text == "" {
+				continue
+			}
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				return fmt.Errorf("无效的JSONPath切片: [%s]", content)
+			}
+			bounds[i] = &n
+		}
+		step.slice = &bounds
+	default:
+		n, err := strconv.Atoi(content)
+		if err != nil {
+			return fmt.Errorf("无效的JSONPath下标: [%s]", content)
+		}
+		step.index = &n
+	}
+	return nil
+}
+
+// apply 对一个值应用该步骤（不含递归）
+func (step jsonPathStep) apply(value interface{}) []interface{} {
+	var result []interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range step.keys(v) {
+			result = append(result, v[key])
+		}
+	case []interface{}:
+		for _, i := range step.indices(len(v)) {
+			result = append(result, v[i])
+		}
+	}
+	return result
+}
+
+// clampSliceIndex 把切片下标转换到[0, length]范围内，负数从末尾计算
+func clampSliceIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
+
+// jsonDescendants 返回值本身及其所有后代，用于..
+func jsonDescendants(value interface{}) []interface{} {
+	result := []interface{}{value}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			result = append(result, jsonDescendants(v[key])...)
+		}
+	case []interface{}:
+		for _, child := range v {
+			result = append(result, jsonDescendants(child)...)
+		}
+	}
+	return result
+}
+
+// replaceJSONPath 把JSON树中所有匹配JSONPath的值替换为replace的返回值，返回替换后的树和替换的数量。
+// 对象和数组在原位修改
+func replaceJSONPath(root interface{}, path string, replace func(interface{}) interface{}) (interface{}, int, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	count := 0
+	root = replaceJSONPathSteps(root, steps, func(value interface{}) interface{} {
+		count++
+		return replace(value)
+	})
+	return root, count, nil
+}
+
+// replaceJSONPathSteps 按剩余的步骤查找并替换，返回替换后的值
+func replaceJSONPathSteps(value interface{}, steps []jsonPathStep, replace func(interface{}) interface{}) interface{} {
+	if len(steps) == 0 {
+		return replace(value)
+	}
+	step := steps[0]
+	if step.recursive {
+		// 先在当前层级匹配，再对每个子节点保留..继续查找
+		current := step
+		current.recursive = false
+		value = replaceJSONPathSteps(value, append([]jsonPathStep{current}, steps[1:]...), replace)
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key := range v {
+				v[key] = replaceJSONPathSteps(v[key], steps, replace)
+			}
+		case []interface{}:
+			for i := range v {
+				v[i] = replaceJSONPathSteps(v[i], steps, replace)
+			}
+		}
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range step.keys(v) {
+			v[key] = replaceJSONPathSteps(v[key], steps[1:], replace)
+		}
+	case []interface{}:
+		for _, i := range step.indices(len(v)) {
+			v[i] = replaceJSONPathSteps(v[i], steps[1:], replace)
+		}
+	}
+	return value
+}
+
+// keys 返回对象中该步骤匹配的键
+func (step jsonPathStep) keys(object map[string]interface{}) []string {
+	if step.wildcard {
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	if step.index == nil && step.slice == nil {
+		if _, ok := object[step.name]; ok {
+			return []string{step.name}
+		}
+	}
+	return nil
+}
+
+// indices 返回长度为length的数组中该步骤匹配的下标
+func (step jsonPathStep) indices(length int) []int {
+	start, end := 0, 0
+	switch {
+	case step.wildcard:
+		end = length
+	case step.index != nil:
+		i := *step.index
+		if i < 0 {
+			i += length
+		}
+		if i < 0 || i >= length {
+			return nil
+		}
+		start, end = i, i+1
+	case step.slice != nil:
+		end = length
+		if step.slice[0] != nil {
+			start = clampSliceIndex(*step.slice[0], length)
+		}
+		if step.slice[1] != nil {
+			end = clampSliceIndex(*step.slice[1], length)
+		}
+	}
+	indices := make([]int, 0, max(end-start, 0))
+	for i := start; i < end; i++ {
+		indices = append(indices, i)
+	}
+	return indices
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// 测试用的JSON树，数字保持json.Number
+const jsonPathDocument = `{
+  "store": {
+    "book": [
+      {"title": "A", "price": 8, "tags": ["x"]},
+      {"title": "B", "price": 12},
+      {"title": "C", "price": 22, "isbn": "0-1"}
+    ],
+    "bicycle": {"color": "red", "price": 19}
+  },
+  "odd key": true
+}`
+
+func jsonPathTree(t *testing.T) interface{} {
+	t.Helper()
+	decoder := json.NewDecoder(strings.NewReader(jsonPathDocument))
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestQueryJSONPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string // 结果序列化后的JSON
+	}{
+		{"$", ""}, // 根节点，只检查数量
+		{"$.store.bicycle.color", `["red"]`},
+		{"$['store']['bicycle']['color']", `["red"]`},
+		{`$["odd key"]`, `[true]`},
+		{"$.store.book[0].title", `["A"]`},
+		{"$.store.book[-1].title", `["C"]`},
+		{"$.store.book[5].title", `[]`},
+		{"$.store.book[*].price", `[8,12,22]`},
+		{"$.store.book.*.title", `["A","B","C"]`},
+		{"$.store.book[1:].title", `["B","C"]`},
+		{"$.store.book[:2].title", `["A","B"]`},
+		{"$.store.book[-2:].title", `["B","C"]`},
+		{"$.store.book[0:100].title", `["A","B","C"]`},
+		{"$..isbn", `["0-1"]`},
+		{"$.store..price", `[19,8,12,22]`}, // 对象的键按字母顺序遍历
+		{"$..book[0].tags[0]", `["x"]`},
+		{"$.store.*.color", `["red"]`},
+		{"$.missing.path", `[]`},
+		{"$.store.bicycle[0]", `[]`}, // 下标不匹配对象
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result, err := queryJSONPath(jsonPathTree(t), tt.path)
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if tt.want == "" {
+				if len(result) != 1 {
+					t.Fatalf("got %d results, want 1", len(result))
+				}
+				return
+			}
+			got, _ := json.Marshal(result)
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, path := range []string{
+		"",
+		"store.book",
+		"$.",
+		"$..",
+		"$[0",
+		"$[abc]",
+		"$[1:x]",
+		"$store",
+	} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("parseJSONPath(%q) succeeded, want error", path)
+		}
+	}
+}
+
+func TestReplaceJSONPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		count int
+		check string // 替换后查询该路径应全部为"***"
+	}{
+		{"$.store.bicycle.color", 1, "$.store.bicycle.color"},
+		{"$.store.book[*].title", 3, "$.store.book[*].title"},
+		{"$..price", 4, "$..price"},
+		{"$.store.book[-1]", 1, "$.store.book[2]"},
+		{"$.nothing", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			tree, count, err := replaceJSONPath(jsonPathTree(t), tt.path, func(interface{}) interface{} { return "***" })
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if count != tt.count {
+				t.Errorf("count = %d, want %d", count, tt.count)
+			}
+			if tt.check == "" {
+				return
+			}
+			values, _ := queryJSONPath(tree, tt.check)
+			if len(values) == 0 {
+				t.Fatalf("%s matched nothing after replacement", tt.check)
+			}
+			for _, value := range values {
+				if value != "***" {
+					t.Errorf("%s = %v, want ***", tt.check, value)
+				}
+			}
+		})
+	}
+
+	// 替换根节点
+	tree, count, _ := replaceJSONPath(jsonPathTree(t), "$", func(interface{}) interface{} { return nil })
+	if tree != nil || count != 1 {
+		t.Errorf("replace root: tree = %v, count = %d", tree, count)
+	}
+}
@@ -3,22 +3,72 @@ package main
 
 import (
 	"abc/a/util"
+	"net"
+	"net/http"
+	"os"
 )
 
 func main() {
 	// 初始化日志系统
 	util.InitLogger()
 
+	// 以特权抓包进程运行：packet-capture-tool capture-helper -socket <路径> -group <用户组>
+	// 子命令只读取配置文件和环境变量，命令行参数由子命令解析
+	if len(os.Args) > 1 && os.Args[1] == "capture-helper" {
+		LoadAppConfig(nil)
+		runCaptureHelper(os.Args[2:])
+		return
+	}
+
+	// 管理本地用户：packet-capture-tool user -add <用户名> -role <角色>
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		LoadAppConfig(nil)
+		runUserCommand(os.Args[2:])
+		return
+	}
+
+	// 加载配置：packet-capture-tool -config config.yaml -listen :8081
+	LoadAppConfig(os.Args[1:])
+
+	// 加载API令牌和本地用户
+	LoadAuthConfig()
+
+	// 加载已上传的protobuf描述符集合
+	LoadProtobufDescriptors()
+
+	// 启动计划任务调度器
+	StartScheduler()
+
 	// 设置路由
 	r := SetupRouter()
 
-	// 获取本机IP
-	localIP := util.GetLocalIP()
-	util.Log.Logger.Info("服务器启动在 http://%s:8081", localIP)
+	// 读取HTTPS配置，未启用时使用HTTP
+	tlsConfig, err := loadServerTLSConfig()
+	if err != nil {
+		util.Log.Logger.Fatal("HTTPS配置无效: %v", err)
+	}
+	server := &http.Server{Addr: appConfig.Listen, Handler: r, TLSConfig: tlsConfig}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
+	// 获取本机IP，监听地址已在加载配置时校验
+	host, port, _ := net.SplitHostPort(appConfig.Listen)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = util.GetLocalIP()
+	}
+	util.Log.Logger.Info("服务器启动在 %s://%s", scheme, net.JoinHostPort(host, port))
 
 	// 启动服务器并记录可能的错误
 	util.Log.Logger.Info("服务器开始监听请求...")
-	if err := r.Run(":8081"); err != nil {
+	if tlsConfig != nil {
+		// 证书已在TLSConfig中加载
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		util.Log.Logger.Fatal("服务器启动失败: %v", err)
 	}
 }
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"abc/a/util"
+	"os"
+	"testing"
+)
+
+// TestMain 在所有测试之前初始化日志，只输出错误。
+// 测试启动的抓包协程可能在测试结束后仍在写日志，不能在各个测试中替换util.Log
+func TestMain(m *testing.M) {
+	util.Log = &util.Logging{Logger: util.NewLogger(util.ERROR, false, false, "")}
+	os.Exit(m.Run())
+}
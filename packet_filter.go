@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+)
+
+// IsEmpty 判断过滤条件是否为空（为空时匹配所有数据包）
+func (f *PacketFilter) IsEmpty() bool {
+	return f == nil || *f == PacketFilter{}
+}
+
+// Match 判断数据包是否满足过滤条件
+func (f *PacketFilter) Match(packet PacketInfo) bool {
+	if f.IsEmpty() {
+		return true
+	}
+
+	if f.Method != "" && !strings.EqualFold(packet.Method, f.Method) {
+		return false
+	}
+	if f.Host != "" && !strings.Contains(strings.ToLower(packet.Host), strings.ToLower(f.Host)) {
+		return false
+	}
+	if f.Path != "" && !strings.Contains(packet.Path, f.Path) {
+		return false
+	}
+	if f.SourceIP != "" && packet.SourceIP != f.SourceIP {
+		return false
+	}
+	if f.DestIP != "" && packet.DestIP != f.DestIP {
+		return false
+	}
+	if f.Port != 0 && packet.SourcePort != f.Port && packet.DestPort != f.Port {
+		return false
+	}
+	if f.Interface != "" && packet.Interface != f.Interface {
+		return false
+	}
+	if f.Contains != "" && !strings.Contains(packet.RequestLine, f.Contains) && !strings.Contains(packet.StatusLine, f.Contains) &&
+		!strings.Contains(packet.Content, f.Contains) {
+		return false
+	}
+	return true
+}
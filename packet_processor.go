@@ -17,35 +17,54 @@ import (
 
 // 开始抓包过程
 func startCapturing(task *captureTask) {
-	util.Log.Logger.Info("开始抓包任务，设备: %s, 过滤器: %s", task.config.DeviceName)
+	deviceNames := strings.Join(task.config.devices(), ",")
+	util.Log.Logger.Info("开始抓包任务，任务ID: %s, 设备: %s", task.id, deviceNames)
 
+	done := make(chan struct{})
 	defer func() {
-		TaskMutex.Lock()
-		task.running = false
-		if task.handle != nil {
-			task.handle.Close()
-		}
-		TaskMutex.Unlock()
-		util.Log.Logger.Info("抓包任务已停止，设备: %s", task.config.DeviceName)
+		close(done)
+		// 网卡读取结束或出错时任务尚未停止，记录为source_ended；已停止的任务不会重复处理
+		finishTask(task, stopReasonSourceEnded)
+		util.Log.Logger.Info("抓包协程已退出，设备: %s", deviceNames)
 	}()
 
-	// 使用handle作为数据包源
-	packetSource := gopacket.NewPacketSource(task.handle, task.handle.LinkType())
-
-	// 处理每个捕获的数据包
-	for packet := range packetSource.Packets() {
-		// 检查任务是否已停止
+	// 合并所有网卡的数据包作为数据包源，交给解码流水线处理；任务停止时handles被取出，需持有锁读取
+	TaskMutex.Lock()
+	handles := task.handles
+	TaskMutex.Unlock()
+	packets := mergePacketSources(handles, done)
+	pipeline := newPacketPipeline(task, decodeWorkerCount(task.config))
+	// 等待已读取的数据包处理完再停止任务
+	defer pipeline.close()
+
+	for source := range packets {
+		packet := source.packet
+		// 检查任务是否已停止或暂停，并取得当前的过滤条件
 		TaskMutex.Lock()
 		running := task.running
+		paused := task.paused
+		config := task.config
 		TaskMutex.Unlock()
 
 		if !running {
-			util.Log.Logger.Info("抓包任务停止 %v", task.config.DeviceName)
+			util.Log.Logger.Info("抓包任务停止 %v", deviceNames)
 			break
 		}
+		task.counters.seen.Add(1)
+		if paused {
+			task.counters.skippedPaused.Add(1)
+			continue
+		}
+		task.capturedBytes.Add(int64(len(packet.Data())))
+
+		pipeline.submit(packet, source.device, config)
 
-		// 处理数据包
-		processPacket(packet, task)
+		// 检查读取字节数等自动停止条件，匹配请求数由输出协程检查
+		if reason := task.stopConditionReached(config); reason != "" {
+			util.Log.Logger.Info("抓包任务达到停止条件: %s, 任务ID: %s", reason, task.id)
+			finishTask(task, reason)
+			break
+		}
 	}
 }
 
@@ -78,81 +97,187 @@ func (h *httpStream) run() {
 		} else if err != nil {
 			//log.Println("Error reading stream", h.net, h.transport, ":", err)
 		} else {
-			bodyBytes := tcpreader.DiscardBytesToEOF(req.Body)
+			tcpreader.DiscardBytesToEOF(req.Body)
 			req.Body.Close()
 			//log.Println("Received request from stream", h.net, h.transport, ":", req, "with", bodyBytes, "bytes in request body")
 		}
 	}
 }
 
-// 处理单个数据包
-func processPacket(packet gopacket.Packet, task *captureTask) {
+// processPacket 解码并保存单个数据包，用于不经过流水线的快照任务
+func processPacket(packet gopacket.Packet, device string, task *captureTask, config CaptureConfig, state *decodeState) {
+	if packetInfo, ok := decodePacket(packet, device, task, config, state); ok {
+		storePacket(task, packetInfo)
+	}
+}
+
+// decodePacket 解码单个数据包，是符合过滤条件的HTTP请求或已保存请求的响应时返回true。
+// 只更新任务的计数，可以在多个解码协程中并发调用，state为调用协程自己的连接状态
+func decodePacket(packet gopacket.Packet, device string, task *captureTask, config CaptureConfig, state *decodeState) (packetInfo PacketInfo, ok bool) {
 	defer func() {
 		if r := recover(); r != nil {
+			task.counters.decodeErrors.Add(1)
 			util.Log.Logger.Error("处理数据包时发生恐慌: %v", r)
+			ok = false
 		}
 	}()
 
+	if packet.ErrorLayer() != nil {
+		task.counters.decodeErrors.Add(1)
+	} else {
+		task.counters.decoded.Add(1)
+	}
+
 	// 检查TCP层信息
 	tcpLayer := packet.Layer(layers.LayerTypeTCP)
 	if tcpLayer == nil {
 		// 非TCP包，跳过
-		return
+		return PacketInfo{}, false
 	}
 
 	tcp, _ := tcpLayer.(*layers.TCP)
+	if state.gaps.observe(packet, tcp) {
+		task.counters.reassemblyGaps.Add(1)
+	}
 
 	// 检查应用层数据
 	appLayer := packet.ApplicationLayer()
 	if appLayer == nil {
 		// 没有应用层数据，跳过
-		return
+		return PacketInfo{}, false
 	}
 
 	data := appLayer.Payload()
 	dataStr := string(data)
-	util.Log.Logger.Info("抓包数据：%v", dataStr)
 
-	// 判断是否为HTTP请求
-	isHTTPRequest := strings.HasPrefix(strings.ToUpper(dataStr), "GET ") ||
-		strings.HasPrefix(strings.ToUpper(dataStr), "POST ") ||
-		strings.HasPrefix(strings.ToUpper(dataStr), "PUT ") ||
-		strings.HasPrefix(strings.ToUpper(dataStr), "DELETE ") ||
-		strings.HasPrefix(strings.ToUpper(dataStr), "HEAD ")
+	// 判断是HTTP请求还是响应
+	isHTTPRequest := isHTTPRequestPayload(dataStr)
+	isHTTPResponse := !isHTTPRequest && strings.HasPrefix(dataStr, "HTTP/")
 
 	// 检查协议过滤
-	if len(task.config.Protocols) > 0 {
+	if len(config.Protocols) > 0 {
 		protocolMatch := false
-		for _, proto := range task.config.Protocols {
-			if strings.EqualFold(proto, "http") && isHTTPRequest {
+		for _, proto := range config.Protocols {
+			if strings.EqualFold(proto, "http") && (isHTTPRequest || isHTTPResponse) {
 				protocolMatch = true
 				break
 			}
 		}
 		if !protocolMatch {
+			task.counters.filteredOut.Add(1)
 			util.Log.Logger.Debug("数据包不符合协议过滤条件，跳过")
-			return
+			return PacketInfo{}, false
 		}
 	}
-	FlushOlderThan(time.Now().Add(time.Minute * -2))
+	switch {
+	case isHTTPRequest:
+		return decodeHTTPRequest(packet, device, tcp, dataStr, task, config, state)
+	case isHTTPResponse:
+		return decodeHTTPResponse(packet, device, tcp, dataStr, task, state)
+	}
+	return PacketInfo{}, false
+}
+
+// decodeHTTPRequest 解析HTTP请求数据包并应用路径和内容过滤，保存的请求记录在state中等待响应
+func decodeHTTPRequest(packet gopacket.Packet, device string, tcp *layers.TCP, dataStr string, task *captureTask, config CaptureConfig, state *decodeState) (PacketInfo, bool) {
+	packetInfo := parseHTTPRequest(packet, tcp, dataStr)
+	packetInfo.Interface = device
 
-	// 只处理HTTP请求
-	if isHTTPRequest {
-		processHTTPRequest(packet, tcp, dataStr, task)
+	// 应用路径过滤
+	if config.PathFilter != "" && !strings.Contains(packetInfo.Path, config.PathFilter) {
+		task.counters.filteredOut.Add(1)
+		util.Log.Logger.Debug("数据包不符合路径过滤条件，跳过")
+		return PacketInfo{}, false
 	}
+
+	// 应用内容包含过滤
+	if config.ContainsFilter != "" && !strings.Contains(dataStr, config.ContainsFilter) {
+		task.counters.filteredOut.Add(1)
+		util.Log.Logger.Debug("数据包不符合内容过滤条件，跳过")
+		return PacketInfo{}, false
+	}
+
+	// 记录脱敏前的请求，响应保存时使用相同的脱敏规则
+	if key, ok := requestFlowKey(packet, tcp); ok {
+		state.requests.add(key, pendingRequest{method: packetInfo.Method, path: packetInfo.Path, host: packetInfo.Host})
+	}
+
+	// 过滤之后再脱敏，保存和广播的都是脱敏后的内容
+	task.redactor.redact(&packetInfo)
+	return packetInfo, true
 }
 
-// 处理HTTP请求数据包
-func processHTTPRequest(packet gopacket.Packet, tcp *layers.TCP, dataStr string, task *captureTask) {
-	defer func() {
-		if r := recover(); r != nil {
-			util.Log.Logger.Error("处理HTTP请求时发生恐慌: %v", r)
-		}
-	}()
+// decodeHTTPResponse 解析HTTP响应数据包，只保存同一连接上已保存请求的响应，不再应用过滤条件
+func decodeHTTPResponse(packet gopacket.Packet, device string, tcp *layers.TCP, dataStr string, task *captureTask, state *decodeState) (PacketInfo, bool) {
+	key, ok := responseFlowKey(packet, tcp)
+	if !ok {
+		return PacketInfo{}, false
+	}
+	status, _ := parseHTTPStatus(dataStr)
+	request, ok := state.requests.match(key, status >= 200)
+	if !ok {
+		util.Log.Logger.Debug("响应没有对应的已保存请求，跳过")
+		return PacketInfo{}, false
+	}
+
+	// HEAD请求的响应、1xx、204和304响应没有内容
+	hasBody := request.method != "HEAD" && status >= 200 && status != 204 && status != 304
+	packetInfo := newPacketInfo(packet, tcp)
+	packetInfo.Interface = device
+	packetInfo.Method = request.method
+	packetInfo.Path = request.path
+	packetInfo.Host = request.host
+	parseHTTPResponsePayload(&packetInfo, dataStr, hasBody, isTruncated(packet))
+
+	task.redactor.redact(&packetInfo)
+	return packetInfo, true
+}
 
+// storePacket 保存匹配的HTTP请求或响应并广播，同一个任务同时只能由一个协程调用以保证序号与广播顺序一致
+func storePacket(task *captureTask, packetInfo PacketInfo) {
+	task.packetsMu.Lock()
+	task.lastSeq++
+	packetInfo.Seq = task.lastSeq
+	task.packets = append(task.packets, packetInfo)
+	task.packetsMu.Unlock()
+
+	// 响应不计入匹配的请求数
+	if packetInfo.Direction == directionResponse {
+		util.Log.Logger.Debug("捕获HTTP响应: %s %s", packetInfo.StatusLine, packetInfo.Host)
+	} else {
+		task.matchedRequests.Add(1)
+		util.Log.Logger.Debug("捕获HTTP请求: %s %s", packetInfo.RequestLine, packetInfo.Host)
+	}
+
+	// 通过WebSocket广播新数据包
+	BroadcastNewPacket(task.id, packetInfo)
+}
+
+// isHTTPRequestPayload 判断应用层数据是否以HTTP请求行开头
+func isHTTPRequestPayload(dataStr string) bool {
+	upper := strings.ToUpper(dataStr)
+	return strings.HasPrefix(upper, "GET ") ||
+		strings.HasPrefix(upper, "POST ") ||
+		strings.HasPrefix(upper, "PUT ") ||
+		strings.HasPrefix(upper, "DELETE ") ||
+		strings.HasPrefix(upper, "HEAD ")
+}
+
+// parseHTTPRequest 从数据包中解析地址信息和HTTP请求
+func parseHTTPRequest(packet gopacket.Packet, tcp *layers.TCP, dataStr string) PacketInfo {
+	packetInfo := newPacketInfo(packet, tcp)
+
+	// 解析HTTP请求行、请求头和请求内容
+	parseHTTPPayload(&packetInfo, dataStr, isTruncated(packet))
+
+	return packetInfo
+}
+
+// newPacketInfo 从数据包中解析时间和地址信息
+func newPacketInfo(packet gopacket.Packet, tcp *layers.TCP) PacketInfo {
 	// 解析数据包信息
 	packetInfo := PacketInfo{
-		Timestamp:  time.Now(),
+		Timestamp:  packetTimestamp(packet),
 		SourcePort: int(tcp.SrcPort),
 		DestPort:   int(tcp.DstPort),
 		Protocol:   "HTTP",
@@ -173,63 +298,19 @@ func processHTTPRequest(packet gopacket.Packet, tcp *layers.TCP, dataStr string,
 			packetInfo.DestIP = ip6.DstIP.String()
 		}
 	}
+	return packetInfo
+}
 
-	// 解析HTTP信息
-	lines := strings.Split(dataStr, "\r\n")
-
-	// 提取请求行和路径
-	if len(lines) > 0 {
-		packetInfo.RequestLine = lines[0]
-		// 从请求行提取路径
-		parts := strings.Split(lines[0], " ")
-		if len(parts) >= 2 {
-			packetInfo.Path = parts[1]
-		}
-	}
-
-	// 提取域名
-	for _, line := range lines {
-		if strings.HasPrefix(strings.ToLower(line), "host: ") {
-			packetInfo.Host = strings.TrimSpace(strings.TrimPrefix(strings.ToLower(line), "host: "))
-			break
-		}
-	}
-
-	// 提取请求内容
-	bodyStartIndex := -1
-	for i, line := range lines {
-		if line == "" && i < len(lines)-1 {
-			bodyStartIndex = i + 1
-			break
-		}
-	}
-
-	if bodyStartIndex > 0 && bodyStartIndex < len(lines) {
-		body := strings.Join(lines[bodyStartIndex:], "\n")
-		packetInfo.Content = body
-	} else {
-		packetInfo.Content = "(无内容)"
-	}
-
-	// 应用路径过滤
-	if task.config.PathFilter != "" && !strings.Contains(packetInfo.Path, task.config.PathFilter) {
-		util.Log.Logger.Debug("数据包不符合路径过滤条件，跳过")
-		return
-	}
+// isTruncated 判断数据包是否被snapshot_len截断
+func isTruncated(packet gopacket.Packet) bool {
+	metadata := packet.Metadata()
+	return metadata != nil && (metadata.Truncated || metadata.CaptureLength < metadata.Length)
+}
 
-	// 应用内容包含过滤
-	if task.config.ContainsFilter != "" && !strings.Contains(dataStr, task.config.ContainsFilter) {
-		util.Log.Logger.Debug("数据包不符合内容过滤条件，跳过")
-		return
+// packetTimestamp 返回数据包的抓取时间，缺少元数据时使用当前时间
+func packetTimestamp(packet gopacket.Packet) time.Time {
+	if metadata := packet.Metadata(); metadata != nil && !metadata.Timestamp.IsZero() {
+		return metadata.Timestamp
 	}
-
-	// 保存数据包信息
-	task.packetsMu.Lock()
-	task.packets = append(task.packets, packetInfo)
-	task.packetsMu.Unlock()
-
-	util.Log.Logger.Debug("捕获HTTP请求: %s %s", packetInfo.RequestLine, packetInfo.Host)
-
-	// 通过WebSocket广播新数据包
-	go BroadcastNewPacket(packetInfo)
+	return time.Now()
 }
@@ -4,53 +4,109 @@ package main
 
 import (
 	"abc/a/util"
-	"os/exec"
-	"strings"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
 
-	"github.com/google/gopacket/pcap"
+	"github.com/gin-gonic/gin"
 )
 
-// promptUserForPermission 根据是否是本机请求决定是否打开系统设置
-func promptUserForPermission(isLocalRequest bool) {
-	util.Log.Logger.Info("提示用户授予网络监控权限，是否本机请求: %v", isLocalRequest)
-	cmd := exec.Command("osascript", "-e", `display dialog "本程序需要\"网络监控\"权限才能抓包。\n\n请按以下步骤操作：\n\n1. 点击下方\"前往设置\"按钮，系统将自动打开隐私设置\n2. 在左侧菜单中选择\"网络监控\"选项\n3. 点击右侧的\"+\"按钮，添加本程序\n4. 勾选本程序旁边的复选框以授予权限\n5. 授予权限后，请重新运行本程序" buttons {"前往设置", "取消"} default button 1 with icon caution`)
-	result, _ := cmd.CombinedOutput()
-	buttonPressed := string(result)
+// 抓包权限检查结果
+type PermissionStatus struct {
+	Granted      bool            `json:"granted"`
+	OS           string          `json:"os"`
+	UID          int             `json:"uid"`
+	EffectiveUID int             `json:"euid"`
+	Executable   string          `json:"executable,omitempty"`
+	Helper       string          `json:"helper,omitempty"`       // 使用特权抓包进程时为其socket路径
+	Capabilities map[string]bool `json:"capabilities,omitempty"` // Linux下各capability是否生效
+	Missing      []string        `json:"missing,omitempty"`      // 缺少的权限
+	Hint         string          `json:"hint,omitempty"`         // 授权方法说明
+	Command      string          `json:"command,omitempty"`      // 授权命令，可以直接复制执行
+}
+
+// 各操作系统的抓包权限检查，实现见permission_linux.go、permission_darwin.go、permission_other.go
+type permissionChecker interface {
+	// check 检查当前进程是否可以抓包，不能打开网卡或弹出对话框
+	check() PermissionStatus
+	// prompt 在本机图形界面提示用户授权，只会在本机请求时调用
+	prompt(status PermissionStatus)
+}
 
-	// 如果是本机请求且用户点击了"前往设置"按钮，则打开系统设置面板
-	if isLocalRequest && strings.Contains(buttonPressed, "button returned:前往设置") {
-		util.Log.Logger.Info("用户点击了前往设置按钮，正在打开系统设置面板")
-		exec.Command("open", "x-apple.systempreferences:com.apple.preference.security?Privacy_NetworkCapture").Run()
-	} else {
-		util.Log.Logger.Info("用户取消了权限设置")
+// 当前操作系统的权限检查
+var permissions permissionChecker = newPermissionChecker()
+
+// newPermissionStatus 返回填充了通用字段的检查结果
+func newPermissionStatus() PermissionStatus {
+	status := PermissionStatus{
+		OS:           runtime.GOOS,
+		UID:          os.Getuid(),
+		EffectiveUID: os.Geteuid(),
+	}
+	if executable, err := os.Executable(); err == nil {
+		status.Executable = executable
 	}
+	return status
 }
-func hasNetworkCapturePermission() bool {
-	devices, err := pcap.FindAllDevs()
+
+// checkCapturePermission 检查抓包权限，没有权限时返回包含诊断信息的错误。
+// 只有本机发起的请求才会在图形界面提示授权，远程请求、计划任务和触发器不会弹出对话框
+func checkCapturePermission(requestIP string) error {
+	status := currentPermissionStatus()
+	if status.Granted {
+		return nil
+	}
+
+	isLocalRequest := isLocalRequestIP(requestIP)
+	util.Log.Logger.Warn("没有抓包权限，缺少: %v, 请求IP: %s, 是否本机请求: %v", status.Missing, requestIP, isLocalRequest)
+	if isLocalRequest && status.Helper == "" {
+		// 在后台线程提示用户，避免阻塞API响应
+		go permissions.prompt(status)
+	}
+	return &captureError{
+		status:  http.StatusForbidden,
+		message: "没有抓包权限",
+		hint:    status.Hint,
+		details: status,
+	}
+}
+
+// currentPermissionStatus 返回抓包权限的检查结果，使用特权抓包进程时只检查能否连接该进程
+func currentPermissionStatus() PermissionStatus {
+	if captureHelperSocket == "" {
+		return permissions.check()
+	}
+
+	status := newPermissionStatus()
+	status.Helper = captureHelperSocket
+	conn, err := net.DialTimeout("unix", captureHelperSocket, 2*time.Second)
 	if err != nil {
-		util.Log.Logger.Error("获取设备列表失败: %v", err)
-		return false
+		status.Missing = []string{"capture-helper"}
+		status.Hint = "无法连接特权抓包进程: " + err.Error() + "，请以root用户启动抓包进程，并确认当前用户属于socket的属组"
+		status.Command = fmt.Sprintf("sudo %s capture-helper -socket %s -group %d", status.Executable, captureHelperSocket, os.Getgid())
+		return status
 	}
-	for _, dev := range devices {
-		if len(dev.Addresses) > 0 {
-			handle, err := pcap.OpenLive(dev.Name, 1600, true, pcap.BlockForever)
-			if err == nil {
-				handle.Close()
-				util.Log.Logger.Info("已获得网络监控权限")
-				return true
-			}
-		}
-	}
-	util.Log.Logger.Warn("未获得网络监控权限")
-	return false
+	conn.Close()
+	status.Granted = true
+	return status
 }
-func test(requestIP string) bool {
-	if !hasNetworkCapturePermission() {
-		isLocalRequest := requestIP == "127.0.0.1" || requestIP == "localhost" || requestIP == util.GetLocalIP()
-		util.Log.Logger.Warn("网络监控权限检查失败，请求IP: %s，是否本机请求: %v", requestIP, isLocalRequest)
-		promptUserForPermission(isLocalRequest)
+
+// isLocalRequestIP 判断请求是否来自本机，requestIP为空表示由程序内部发起
+func isLocalRequestIP(requestIP string) bool {
+	if requestIP == "" {
 		return false
 	}
-	util.Log.Logger.Info("已获得网络监控权限，开始抓包...")
-	return true
+	if requestIP == "localhost" || requestIP == util.GetLocalIP() {
+		return true
+	}
+	ip := net.ParseIP(requestIP)
+	return ip != nil && ip.IsLoopback()
+}
+
+// GetPermissionStatus 返回抓包权限的诊断信息
+func GetPermissionStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, currentPermissionStatus())
 }
@@ -0,0 +1,71 @@
+//go:build darwin
+
+package main
+
+import (
+	"abc/a/util"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// macOS下通过能否打开/dev/bpf*判断抓包权限
+type darwinPermissionChecker struct{}
+
+func newPermissionChecker() permissionChecker {
+	return darwinPermissionChecker{}
+}
+
+// check 依次尝试以读写方式打开/dev/bpf*，被其他程序占用的设备视为有权限
+func (darwinPermissionChecker) check() PermissionStatus {
+	status := newPermissionStatus()
+
+	devices, _ := filepath.Glob("/dev/bpf*")
+	for _, device := range devices {
+		file, err := os.OpenFile(device, os.O_RDWR, 0)
+		if err == nil {
+			file.Close()
+			status.Granted = true
+			return status
+		}
+		if errors.Is(err, syscall.EBUSY) {
+			continue
+		}
+		if errors.Is(err, os.ErrPermission) {
+			break
+		}
+	}
+
+	status.Missing = []string{"/dev/bpf"}
+	status.Hint = "没有读写/dev/bpf*的权限，请执行command中的命令（重启后失效），或在系统设置 > 隐私与安全性 > 网络监控中添加并启用本程序"
+	status.Command = fmt.Sprintf("sudo chown root:%s /dev/bpf* && sudo chmod 660 /dev/bpf*", currentGroupName())
+	return status
+}
+
+// prompt 弹出对话框提示用户授权，用户点击"前往设置"时打开系统设置面板
+func (darwinPermissionChecker) prompt(status PermissionStatus) {
+	util.Log.Logger.Info("提示用户授予网络监控权限")
+	cmd := exec.Command("osascript", "-e", `display dialog "本程序需要\"网络监控\"权限才能抓包。\n\n请按以下步骤操作：\n\n1. 点击下方\"前往设置\"按钮，系统将自动打开隐私设置\n2. 在左侧菜单中选择\"网络监控\"选项\n3. 点击右侧的\"+\"按钮，添加本程序\n4. 勾选本程序旁边的复选框以授予权限\n5. 授予权限后，请重新运行本程序" buttons {"前往设置", "取消"} default button 1 with icon caution`)
+	result, _ := cmd.CombinedOutput()
+	buttonPressed := string(result)
+
+	if strings.Contains(buttonPressed, "button returned:前往设置") {
+		util.Log.Logger.Info("用户点击了前往设置按钮，正在打开系统设置面板")
+		exec.Command("open", "x-apple.systempreferences:com.apple.preference.security?Privacy_NetworkCapture").Run()
+	} else {
+		util.Log.Logger.Info("用户取消了权限设置")
+	}
+}
+
+// currentGroupName 返回当前用户主组的名称，获取失败时返回staff
+func currentGroupName() string {
+	output, err := exec.Command("id", "-g", "-n").Output()
+	if err != nil {
+		return "staff"
+	}
+	return strings.TrimSpace(string(output))
+}
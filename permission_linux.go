@@ -0,0 +1,94 @@
+//go:build linux
+
+package main
+
+import (
+	"abc/a/util"
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Linux capability编号，见linux/capability.h
+const (
+	capNetAdmin = 12
+	capNetRaw   = 13
+)
+
+// Linux下通过进程的有效capability判断抓包权限
+type linuxPermissionChecker struct{}
+
+func newPermissionChecker() permissionChecker {
+	return linuxPermissionChecker{}
+}
+
+// check 读取/proc/self/status中的CapEff。抓包需要CAP_NET_RAW，
+// CAP_NET_ADMIN用于混杂模式和调整内核缓冲区，缺少时仍可抓包，只在诊断信息中列出
+func (linuxPermissionChecker) check() PermissionStatus {
+	status := newPermissionStatus()
+
+	effective, err := readEffectiveCapabilities()
+	if err != nil {
+		util.Log.Logger.Warn("读取进程capability失败: %v", err)
+		// 无法读取时按root用户判断
+		status.Granted = status.EffectiveUID == 0
+		if !status.Granted {
+			status.Missing = []string{"root"}
+			status.Hint = "无法读取进程capability，请以root用户运行"
+		}
+		return status
+	}
+
+	status.Capabilities = map[string]bool{
+		"CAP_NET_RAW":   effective&(1<<capNetRaw) != 0,
+		"CAP_NET_ADMIN": effective&(1<<capNetAdmin) != 0,
+	}
+	for _, name := range []string{"CAP_NET_RAW", "CAP_NET_ADMIN"} {
+		if !status.Capabilities[name] {
+			status.Missing = append(status.Missing, name)
+		}
+	}
+	status.Granted = status.Capabilities["CAP_NET_RAW"]
+
+	if len(status.Missing) > 0 {
+		executable := status.Executable
+		if executable == "" {
+			executable = "packet-capture-tool"
+		}
+		status.Command = fmt.Sprintf("sudo setcap cap_net_raw,cap_net_admin=eip %s", executable)
+		if status.Granted {
+			status.Hint = "缺少CAP_NET_ADMIN，混杂模式等功能可能不可用，执行command中的命令后重新启动程序"
+		} else {
+			status.Hint = "需要CAP_NET_RAW才能抓包，执行command中的命令后重新启动程序，或以root用户运行"
+		}
+	}
+	return status
+}
+
+// prompt Linux服务器没有图形界面，只记录日志
+func (linuxPermissionChecker) prompt(status PermissionStatus) {
+	util.Log.Logger.Warn("缺少抓包权限: %v, 授权命令: %s", status.Missing, status.Command)
+}
+
+// readEffectiveCapabilities 读取当前进程的有效capability位图
+func readEffectiveCapabilities() (uint64, error) {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "CapEff:"); ok {
+			return strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("/proc/self/status中没有CapEff")
+}
@@ -0,0 +1,52 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"abc/a/util"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// 其他系统（如Windows）没有统一的权限模型，尝试以非混杂模式打开一个网卡
+type genericPermissionChecker struct{}
+
+func newPermissionChecker() permissionChecker {
+	return genericPermissionChecker{}
+}
+
+// check 尝试打开第一个有地址的网卡，只检查一次，不开启混杂模式
+func (genericPermissionChecker) check() PermissionStatus {
+	status := newPermissionStatus()
+
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		status.Missing = []string{"pcap"}
+		status.Hint = "无法获取设备列表，请确认已安装Npcap/libpcap: " + err.Error()
+		return status
+	}
+	for _, device := range devices {
+		if len(device.Addresses) == 0 {
+			continue
+		}
+		handle, err := pcap.OpenLive(device.Name, 64, false, time.Millisecond)
+		if err == nil {
+			handle.Close()
+			status.Granted = true
+			return status
+		}
+		status.Missing = []string{"pcap"}
+		status.Hint = "无法打开网卡，请以管理员身份运行: " + err.Error()
+		return status
+	}
+
+	// 没有可检查的网卡，交给打开网卡时报错
+	status.Granted = true
+	return status
+}
+
+// prompt 只记录日志
+func (genericPermissionChecker) prompt(status PermissionStatus) {
+	util.Log.Logger.Warn("缺少抓包权限: %s", status.Hint)
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"abc/a/util"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+const (
+	// 预触发缓冲默认保留的时长（秒）
+	defaultBufferWindow = 30
+	// 单个网卡缓冲默认占用的最大内存
+	defaultBufferMaxBytes = 64 * 1024 * 1024
+	// 预触发缓冲保留时长的上限（秒）
+	maxBufferWindow = 3600
+	// 单个网卡缓冲占用内存的上限，缓冲一直在后台运行，不允许占用过多内存
+	maxBufferMaxBytes = 1024 * 1024 * 1024
+	// 预触发缓冲默认的数据包抓取长度
+	defaultBufferSnapshotLen = 65535
+	// 快照任务接收实时数据包的队列长度，处理不过来时丢弃
+	snapshotListenerQueueSize = 4096
+)
+
+// 预触发缓冲配置
+type BufferConfig struct {
+	DeviceName    string `json:"device_name" binding:"required"`
+	WindowSeconds int    `json:"window_seconds"` // 保留最近多少秒的数据包，为0时默认30，最长3600
+	MaxBytes      int    `json:"max_bytes"`      // 最多占用的内存字节数，为0时默认64MB，最大1GB
+	SnapshotLen   int32  `json:"snapshot_len"`   // 单个数据包的抓取长度，为0时默认65535
+	Promiscuous   bool   `json:"promiscuous"`
+}
+
+// 快照请求，把预触发缓冲中最近before秒的数据包和之后after秒的数据包生成一个新任务
+type SnapshotRequest struct {
+	DeviceName     string   `json:"device_name" binding:"required"`
+	BeforeSeconds  int      `json:"before_seconds"` // 为0时取整个缓冲窗口
+	AfterSeconds   int      `json:"after_seconds"`  // 快照后继续抓包的时长（秒）
+	Protocols      []string `json:"protocols"`
+	PathFilter     string   `json:"path_filter"`
+	ContainsFilter string   `json:"contains_filter"`
+
+	Redaction RedactionConfig `json:"redaction"` // 与抓包任务的脱敏配置相同
+}
+
+// 缓冲中的原始数据包
+type bufferedPacket struct {
+	info gopacket.CaptureInfo
+	data []byte
+}
+
+// 预触发缓冲，持续抓取一个网卡的原始数据包并只保留最近一段时间
+type packetRecorder struct {
+	config   BufferConfig
+	handle   captureSource
+	linkType layers.LinkType
+
+	mutex     sync.Mutex
+	packets   []bufferedPacket
+	bytes     int
+	dropped   int64 // 快照任务处理过慢而丢弃的数据包数
+	listeners map[chan bufferedPacket]struct{}
+}
+
+// 各网卡的预触发缓冲
+var recorders = struct {
+	mutex   sync.Mutex
+	devices map[string]*packetRecorder
+}{devices: make(map[string]*packetRecorder)}
+
+// normalizeBufferConfig 为未设置的字段填入默认值并校验取值范围，返回全部字段错误
+func normalizeBufferConfig(config *BufferConfig) []fieldError {
+	if config.WindowSeconds == 0 {
+		config.WindowSeconds = defaultBufferWindow
+	}
+	if config.MaxBytes == 0 {
+		config.MaxBytes = defaultBufferMaxBytes
+	}
+	if config.SnapshotLen == 0 {
+		config.SnapshotLen = defaultBufferSnapshotLen
+	}
+
+	errs := make([]fieldError, 0)
+	add := func(field, message string, value interface{}) {
+		errs = append(errs, fieldError{Field: field, Code: fieldErrorOutOfRange, Message: message, Value: value})
+	}
+	if config.WindowSeconds < 1 || config.WindowSeconds > maxBufferWindow {
+		add("window_seconds", fmt.Sprintf("window_seconds应在1到%d秒之间", maxBufferWindow), config.WindowSeconds)
+	}
+	if config.MaxBytes < 1 || config.MaxBytes > maxBufferMaxBytes {
+		add("max_bytes", fmt.Sprintf("max_bytes应在1到%d之间", maxBufferMaxBytes), config.MaxBytes)
+	}
+	if config.SnapshotLen < 1 || config.SnapshotLen > maxSnapshotLen {
+		add("snapshot_len", fmt.Sprintf("snapshot_len应在1到%d之间", maxSnapshotLen), config.SnapshotLen)
+	}
+	return errs
+}
+
+// startRecorder 校验配置后在网卡上启动预触发缓冲，已存在时返回错误
+func startRecorder(config BufferConfig) (*packetRecorder, error) {
+	if err := invalidConfigError(normalizeBufferConfig(&config)); err != nil {
+		return nil, err
+	}
+
+	recorders.mutex.Lock()
+	defer recorders.mutex.Unlock()
+
+	if _, ok := recorders.devices[config.DeviceName]; ok {
+		return nil, &captureError{status: http.StatusConflict, message: "该网卡已开启预触发缓冲"}
+	}
+
+	handle, err := openCaptureSource(captureSourceOptions{
+		Device:      config.DeviceName,
+		SnapLen:     config.SnapshotLen,
+		Promiscuous: config.Promiscuous,
+		Timeout:     time.Second,
+	})
+	if err != nil {
+		return nil, &captureError{status: http.StatusInternalServerError, message: "无法打开网卡设备: " + err.Error()}
+	}
+
+	recorder := &packetRecorder{
+		config:    config,
+		handle:    handle,
+		linkType:  handle.LinkType(),
+		listeners: make(map[chan bufferedPacket]struct{}),
+	}
+	recorders.devices[config.DeviceName] = recorder
+	go recorder.run()
+
+	util.Log.Logger.Info("预触发缓冲已启动，设备: %s, 窗口: %d 秒", config.DeviceName, config.WindowSeconds)
+	return recorder, nil
+}
+
+// stopRecorder 停止网卡的预触发缓冲
+func stopRecorder(deviceName string) bool {
+	recorders.mutex.Lock()
+	recorder, ok := recorders.devices[deviceName]
+	delete(recorders.devices, deviceName)
+	recorders.mutex.Unlock()
+
+	if ok {
+		recorder.handle.Close()
+		util.Log.Logger.Info("预触发缓冲已停止，设备: %s", deviceName)
+	}
+	return ok
+}
+
+// findRecorder 返回网卡的预触发缓冲
+func findRecorder(deviceName string) *packetRecorder {
+	recorders.mutex.Lock()
+	defer recorders.mutex.Unlock()
+	return recorders.devices[deviceName]
+}
+
+// run 持续读取数据包放入缓冲，并转发给正在进行的快照任务
+func (r *packetRecorder) run() {
+	for {
+		data, info, err := r.handle.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			r.evict(time.Now())
+			continue
+		}
+		if err != nil {
+			util.Log.Logger.Info("预触发缓冲读取结束，设备: %s, 原因: %v", r.config.DeviceName, err)
+			break
+		}
+
+		packet := bufferedPacket{info: info, data: data}
+		r.mutex.Lock()
+		r.packets = append(r.packets, packet)
+		r.bytes += len(data)
+		for listener := range r.listeners {
+			select {
+			case listener <- packet:
+			default:
+				r.dropped++
+			}
+		}
+		r.mutex.Unlock()
+		r.evict(info.Timestamp)
+	}
+
+	// 网卡关闭后通知所有快照任务结束
+	r.mutex.Lock()
+	for listener := range r.listeners {
+		close(listener)
+		delete(r.listeners, listener)
+	}
+	r.packets = nil
+	r.bytes = 0
+	r.mutex.Unlock()
+
+	recorders.mutex.Lock()
+	if recorders.devices[r.config.DeviceName] == r {
+		delete(recorders.devices, r.config.DeviceName)
+	}
+	recorders.mutex.Unlock()
+}
+
+// evict 丢弃超出时间窗口或内存上限的旧数据包
+func (r *packetRecorder) evict(now time.Time) {
+	cutoff := now.Add(-time.Duration(r.config.WindowSeconds) * time.Second)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	drop := 0
+	for drop < len(r.packets) && (r.packets[drop].info.Timestamp.Before(cutoff) || r.bytes > r.config.MaxBytes) {
+		r.bytes -= len(r.packets[drop].data)
+		// 释放数据引用，底层数组在append扩容时才会整体回收
+		r.packets[drop] = bufferedPacket{}
+		drop++
+	}
+	r.packets = r.packets[drop:]
+}
+
+// snapshot 取出最近before时长内的数据包，并注册一个接收之后实时数据包的队列，两者之间不重复也不遗漏
+func (r *packetRecorder) snapshot(before time.Duration) ([]bufferedPacket, chan bufferedPacket) {
+	listener := make(chan bufferedPacket, snapshotListenerQueueSize)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	start := 0
+	if before > 0 {
+		cutoff := time.Now().Add(-before)
+		for start < len(r.packets) && r.packets[start].info.Timestamp.Before(cutoff) {
+			start++
+		}
+	}
+	packets := append([]bufferedPacket(nil), r.packets[start:]...)
+	r.listeners[listener] = struct{}{}
+	return packets, listener
+}
+
+// removeListener 注销快照任务的实时数据包队列
+func (r *packetRecorder) removeListener(listener chan bufferedPacket) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.listeners[listener]; ok {
+		delete(r.listeners, listener)
+		close(listener)
+	}
+}
+
+// status 返回缓冲的状态信息
+func (r *packetRecorder) status() gin.H {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	response := gin.H{
+		"config":          r.config,
+		"packets":         len(r.packets),
+		"bytes":           r.bytes,
+		"dropped":         r.dropped,
+		"active_snapshot": len(r.listeners),
+	}
+	if len(r.packets) > 0 {
+		response["oldest"] = r.packets[0].info.Timestamp
+	}
+	return response
+}
+
+// startSnapshotTask 把预触发缓冲中的数据包和之后一段时间的数据包解码成一个新任务。
+// 快照任务独立于当前任务运行，不会与手动启动的抓包冲突
+func startSnapshotTask(req SnapshotRequest, origin taskOrigin) (*captureTask, error) {
+	recorder := findRecorder(req.DeviceName)
+	if recorder == nil {
+		return nil, &captureError{status: http.StatusNotFound, message: "该网卡未开启预触发缓冲"}
+	}
+
+	config := CaptureConfig{
+		DeviceName:     req.DeviceName,
+		Protocols:      req.Protocols,
+		PathFilter:     req.PathFilter,
+		ContainsFilter: req.ContainsFilter,
+		SnapshotLen:    recorder.config.SnapshotLen,
+		Redaction:      req.Redaction,
+	}
+	// 与抓包任务使用相同的默认值和校验，快照时长另外校验
+	errs := normalizeCaptureConfig(&config)
+	config.MaxDuration = req.AfterSeconds
+	if req.BeforeSeconds < 0 {
+		errs = append(errs, fieldError{Field: "before_seconds", Code: fieldErrorOutOfRange, Message: "before_seconds不能为负数", Value: req.BeforeSeconds})
+	}
+	if req.AfterSeconds < 0 || req.AfterSeconds > maxCaptureWait {
+		errs = append(errs, fieldError{Field: "after_seconds", Code: fieldErrorOutOfRange, Message: fmt.Sprintf("after_seconds应在0到%d秒之间", maxCaptureWait), Value: req.AfterSeconds})
+	}
+	if err := invalidConfigError(errs); err != nil {
+		return nil, err
+	}
+	compiledRedaction, err := newRedactor(config.Redaction)
+	if err != nil {
+		return nil, &captureError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	task := &captureTask{
+		id:        newTaskID(),
+		origin:    origin,
+		config:    config,
+		packets:   make([]PacketInfo, 0),
+		running:   true,
+		redactor:  compiledRedaction,
+		startedAt: time.Now(),
+	}
+
+	TaskMutex.Lock()
+	snapshotTasks[task.id] = task
+	TaskMutex.Unlock()
+
+	buffered, listener := recorder.snapshot(time.Duration(req.BeforeSeconds) * time.Second)
+	go runSnapshotTask(task, recorder, buffered, listener, time.Duration(req.AfterSeconds)*time.Second)
+	go reportTaskStats(task)
+
+	BroadcastTaskStatus(gin.H{
+		"task_id":  task.id,
+		"running":  true,
+		"message":  "快照任务已启动",
+		"config":   config,
+		"origin":   origin,
+		"buffered": len(buffered),
+	})
+	util.Log.Logger.Info("快照任务已启动，任务ID: %s, 设备: %s, 缓冲数据包: %d", task.id, req.DeviceName, len(buffered))
+	return task, nil
+}
+
+// runSnapshotTask 先解码缓冲中的数据包，再在after时长内解码实时数据包，结束后停止任务
+func runSnapshotTask(task *captureTask, recorder *packetRecorder, buffered []bufferedPacket, listener chan bufferedPacket, after time.Duration) {
+	reason := stopReasonSnapshot
+	defer recorder.removeListener(listener)
+	defer func() {
+		finishTask(task, reason)
+	}()
+
+	// 解码一个数据包，任务已停止或达到停止条件时返回false
+	state := newDecodeState(1)
+	decode := func(buffered bufferedPacket) bool {
+		TaskMutex.Lock()
+		running := task.running
+		config := task.config
+		TaskMutex.Unlock()
+		if !running {
+			return false
+		}
+
+		packet := gopacket.NewPacket(buffered.data, recorder.linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		packet.Metadata().CaptureInfo = buffered.info
+		task.counters.seen.Add(1)
+		task.capturedBytes.Add(int64(len(buffered.data)))
+		processPacket(packet, recorder.config.DeviceName, task, config, state)
+		if stopReason := task.stopConditionReached(config); stopReason != "" {
+			reason = stopReason
+			return false
+		}
+		return true
+	}
+
+	for _, packet := range buffered {
+		if !decode(packet) {
+			return
+		}
+	}
+
+	timer := time.NewTimer(after)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return
+		case packet, ok := <-listener:
+			if !ok || !decode(packet) {
+				return
+			}
+		}
+	}
+}
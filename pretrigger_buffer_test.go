@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNormalizeBufferConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config BufferConfig
+		want   []string
+	}{
+		{name: "defaults", config: BufferConfig{DeviceName: "eth0"}},
+		{name: "upper bounds", config: BufferConfig{DeviceName: "eth0", WindowSeconds: maxBufferWindow, MaxBytes: maxBufferMaxBytes, SnapshotLen: maxSnapshotLen}},
+		{name: "negative window", config: BufferConfig{DeviceName: "eth0", WindowSeconds: -1}, want: []string{"window_seconds:out_of_range"}},
+		{name: "window too long", config: BufferConfig{DeviceName: "eth0", WindowSeconds: maxBufferWindow + 1}, want: []string{"window_seconds:out_of_range"}},
+		{name: "negative max bytes", config: BufferConfig{DeviceName: "eth0", MaxBytes: -1}, want: []string{"max_bytes:out_of_range"}},
+		{name: "max bytes too large", config: BufferConfig{DeviceName: "eth0", MaxBytes: maxBufferMaxBytes + 1}, want: []string{"max_bytes:out_of_range"}},
+		{name: "negative snapshot len", config: BufferConfig{DeviceName: "eth0", SnapshotLen: -1}, want: []string{"snapshot_len:out_of_range"}},
+		{name: "snapshot len too large", config: BufferConfig{DeviceName: "eth0", SnapshotLen: maxSnapshotLen + 1}, want: []string{"snapshot_len:out_of_range"}},
+		{name: "all fields", config: BufferConfig{DeviceName: "eth0", WindowSeconds: -5, MaxBytes: -5, SnapshotLen: -5},
+			want: []string{"window_seconds:out_of_range", "max_bytes:out_of_range", "snapshot_len:out_of_range"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			got := fieldCodes(normalizeBufferConfig(&config))
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("字段错误为 %v，应为 %v", got, tt.want)
+			}
+		})
+	}
+
+	// 未设置的字段填入默认值，负数不会被替换为默认值
+	config := BufferConfig{DeviceName: "eth0"}
+	normalizeBufferConfig(&config)
+	if config.WindowSeconds != defaultBufferWindow || config.MaxBytes != defaultBufferMaxBytes || config.SnapshotLen != defaultBufferSnapshotLen {
+		t.Errorf("默认值为 %+v", config)
+	}
+	config = BufferConfig{DeviceName: "eth0", SnapshotLen: -1}
+	normalizeBufferConfig(&config)
+	if config.SnapshotLen != -1 {
+		t.Errorf("负数的snapshot_len被替换为 %d", config.SnapshotLen)
+	}
+}
+
+func TestStartBufferRejectsOutOfRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/buffers", StartBuffer)
+
+	recorder := httptest.NewRecorder()
+	body := `{"device_name": "eth0", "window_seconds": 86400, "max_bytes": 8589934592}`
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/buffers", strings.NewReader(body)))
+	var response struct {
+		Error  string       `json:"error"`
+		Errors []fieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("响应 %q: %v", recorder.Body.String(), err)
+	}
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("状态码为 %d，应为400", recorder.Code)
+	}
+	if got := strings.Join(fieldCodes(response.Errors), " "); got != "window_seconds:out_of_range max_bytes:out_of_range" {
+		t.Errorf("字段错误为 %s", got)
+	}
+	if findRecorder("eth0") != nil {
+		t.Error("配置无效时不应开启缓冲")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"abc/a/util"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListBuffers 列出所有网卡的预触发缓冲
+func ListBuffers(c *gin.Context) {
+	recorders.mutex.Lock()
+	list := make([]*packetRecorder, 0, len(recorders.devices))
+	for _, recorder := range recorders.devices {
+		list = append(list, recorder)
+	}
+	recorders.mutex.Unlock()
+
+	buffers := make([]gin.H, 0, len(list))
+	for _, recorder := range list {
+		buffers = append(buffers, recorder.status())
+	}
+	c.JSON(http.StatusOK, gin.H{"buffers": buffers})
+}
+
+// StartBuffer 在网卡上开启预触发缓冲
+func StartBuffer(c *gin.Context) {
+	var config BufferConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		util.Log.Logger.Error("参数绑定失败: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recorder, err := startRecorder(config)
+	if err != nil {
+		util.Log.Logger.Error("开启预触发缓冲失败: %v, 设备: %s, IP: %s", err, config.DeviceName, c.ClientIP())
+		respondCaptureError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, recorder.status())
+}
+
+// StopBuffer 关闭网卡的预触发缓冲
+func StopBuffer(c *gin.Context) {
+	deviceName := c.Param("device")
+	if !stopRecorder(deviceName) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该网卡未开启预触发缓冲"})
+		return
+	}
+	util.Log.Logger.Info("关闭预触发缓冲，设备: %s, IP: %s", deviceName, c.ClientIP())
+	recordAudit(actorFromContext(c), AuditEntry{Action: auditActionDelete, Target: "buffer:" + deviceName})
+	c.JSON(http.StatusOK, gin.H{"message": "预触发缓冲已关闭", "device_name": deviceName})
+}
+
+// CreateSnapshot 把预触发缓冲中的数据包和之后一段时间的数据包生成新任务
+func CreateSnapshot(c *gin.Context) {
+	var req SnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.Log.Logger.Error("参数绑定失败: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	identity := requestIdentity(c)
+	origin := taskOrigin{Type: "snapshot", User: identity.Name, Role: identity.Role}
+	task, err := startSnapshotTask(req, origin)
+	entry := AuditEntry{Action: auditActionStart, Target: "snapshot:" + req.DeviceName, Error: auditError(err)}
+	if task != nil {
+		TaskMutex.Lock()
+		config := task.config
+		TaskMutex.Unlock()
+		entry.TaskID = task.id
+		entry.Config = &config
+	}
+	recordAudit(actorFromContext(c), entry)
+	if err != nil {
+		respondCaptureError(c, err)
+		return
+	}
+	util.Log.Logger.Info("创建快照任务: %s, 设备: %s, IP: %s", task.id, req.DeviceName, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": task.id,
+		"message": "快照任务已启动",
+	})
+}
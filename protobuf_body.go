@@ -0,0 +1,335 @@
+package main
+
+import (
+	"abc/a/util"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// 上传的.proto描述符集合的保存目录
+	protobufDescriptorDir = "data/descriptors"
+	// 无schema解码时嵌套消息的最大深度
+	maxProtobufDepth = 16
+)
+
+// 描述符集合文件的最大字节数，可通过配置文件的limits调整，启动后只读
+var maxDescriptorSetSize = 16 << 20
+
+// 描述符集合名称只能包含字母、数字、下划线、点和横线，同时用作文件名
+var descriptorSetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// 上传的描述符集合，由 protoc --descriptor_set_out=<文件> --include_imports 生成
+type protobufDescriptorSet struct {
+	Name       string    `json:"name"`
+	Files      []string  `json:"files"`    // 包含的.proto文件
+	Messages   []string  `json:"messages"` // 可用于解码的消息类型全名
+	UploadedAt time.Time `json:"uploaded_at"`
+
+	files *protoregistry.Files
+}
+
+// 已加载的描述符集合
+var protobufDescriptors = struct {
+	mutex sync.RWMutex
+	sets  map[string]*protobufDescriptorSet
+}{sets: make(map[string]*protobufDescriptorSet)}
+
+// 无schema解码出的一个字段
+type protobufField struct {
+	Number   protowire.Number `json:"number"`
+	WireType string           `json:"wire_type"`
+	Value    interface{}      `json:"value"`
+}
+
+// decodeProtobufBody 解码protobuf消息。指定了消息类型时使用上传的描述符解码为JSON，否则按字段编号无schema解码
+func decodeProtobufBody(parsed *ParsedBody, data []byte, messageType string) error {
+	if messageType == "" {
+		fields, err := decodeProtobufFields(data, 0)
+		if err != nil {
+			return err
+		}
+		parsed.Protobuf = fields
+		return nil
+	}
+
+	descriptor, err := findProtobufMessage(messageType)
+	if err != nil {
+		return err
+	}
+	message := dynamicpb.NewMessage(descriptor)
+	if err := proto.Unmarshal(data, message); err != nil {
+		return fmt.Errorf("按 %s 解码失败: %v", messageType, err)
+	}
+	pretty, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(message)
+	if err != nil {
+		return err
+	}
+	parsed.ProtobufMessage = messageType
+	parsed.Pretty = string(pretty)
+	return parseJSONTree(parsed, pretty)
+}
+
+// decodeProtobufFields 按wire格式解码全部字段。长度前缀的字段依次尝试解码为嵌套消息、UTF-8字符串，否则以base64表示
+func decodeProtobufFields(data []byte, depth int) ([]protobufField, error) {
+	fields := make([]protobufField, 0)
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fields, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		field := protobufField{Number: number}
+		switch wireType {
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return fields, protowire.ParseError(n)
+			}
+			field.WireType, field.Value = "varint", value
+			data = data[n:]
+		case protowire.Fixed32Type:
+			value, n := protowire.ConsumeFixed32(data)
+			if n < 0 {
+				return fields, protowire.ParseError(n)
+			}
+			field.WireType, field.Value = "fixed32", value
+			data = data[n:]
+		case protowire.Fixed64Type:
+			value, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return fields, protowire.ParseError(n)
+			}
+			field.WireType, field.Value = "fixed64", value
+			data = data[n:]
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return fields, protowire.ParseError(n)
+			}
+			field.WireType, field.Value = "bytes", decodeProtobufBytes(value, depth)
+			data = data[n:]
+		default:
+			// group已废弃，不再继续解码
+			return fields, fmt.Errorf("不支持的wire类型 %d，字段 %d", wireType, number)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// decodeProtobufBytes 推测长度前缀字段的内容：可打印的字符串、嵌套消息或二进制数据
+func decodeProtobufBytes(value []byte, depth int) interface{} {
+	if isPrintableText(value) {
+		return string(value)
+	}
+	if depth < maxProtobufDepth {
+		if nested, err := decodeProtobufFields(value, depth+1); err == nil && len(nested) > 0 {
+			return nested
+		}
+	}
+	return gin.H{"base64": base64.StdEncoding.EncodeToString(value)}
+}
+
+// isPrintableText 判断数据是否为不含控制字符（换行、制表符除外）的UTF-8文本
+func isPrintableText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// findProtobufMessage 在所有描述符集合中查找消息类型
+func findProtobufMessage(name string) (protoreflect.MessageDescriptor, error) {
+	protobufDescriptors.mutex.RLock()
+	defer protobufDescriptors.mutex.RUnlock()
+
+	for _, set := range protobufDescriptors.sets {
+		descriptor, err := set.files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			continue
+		}
+		if message, ok := descriptor.(protoreflect.MessageDescriptor); ok {
+			return message, nil
+		}
+	}
+	return nil, fmt.Errorf("未找到消息类型 %s，请先上传包含该类型的描述符集合", name)
+}
+
+// newProtobufDescriptorSet 解析protoc生成的FileDescriptorSet
+func newProtobufDescriptorSet(name string, data []byte) (*protobufDescriptorSet, error) {
+	var fileSet descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &fileSet); err != nil {
+		return nil, fmt.Errorf("无效的描述符集合: %v", err)
+	}
+	files, err := protodesc.NewFiles(&fileSet)
+	if err != nil {
+		return nil, fmt.Errorf("无效的描述符集合，生成时请加上--include_imports: %v", err)
+	}
+
+	set := &protobufDescriptorSet{Name: name, files: files, Files: []string{}, Messages: []string{}}
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		set.Files = append(set.Files, file.Path())
+		appendProtobufMessages(&set.Messages, file.Messages())
+		return true
+	})
+	sort.Strings(set.Files)
+	sort.Strings(set.Messages)
+	return set, nil
+}
+
+// appendProtobufMessages 收集消息类型及其嵌套类型的全名
+func appendProtobufMessages(names *[]string, messages protoreflect.MessageDescriptors) {
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		if message.IsMapEntry() {
+			continue
+		}
+		*names = append(*names, string(message.FullName()))
+		appendProtobufMessages(names, message.Messages())
+	}
+}
+
+// LoadProtobufDescriptors 启动时加载已上传的描述符集合
+func LoadProtobufDescriptors() {
+	paths, err := filepath.Glob(filepath.Join(protobufDescriptorDir, "*.pb"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			util.Log.Logger.Error("读取描述符集合失败: %v, 文件: %s", err, path)
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".pb")
+		set, err := newProtobufDescriptorSet(name, data)
+		if err != nil {
+			util.Log.Logger.Error("加载描述符集合失败: %v, 文件: %s", err, path)
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			set.UploadedAt = info.ModTime()
+		}
+		protobufDescriptors.mutex.Lock()
+		protobufDescriptors.sets[name] = set
+		protobufDescriptors.mutex.Unlock()
+	}
+}
+
+// ListProtobufDescriptors 列出已上传的描述符集合
+func ListProtobufDescriptors(c *gin.Context) {
+	protobufDescriptors.mutex.RLock()
+	sets := make([]*protobufDescriptorSet, 0, len(protobufDescriptors.sets))
+	for _, set := range protobufDescriptors.sets {
+		sets = append(sets, set)
+	}
+	protobufDescriptors.mutex.RUnlock()
+
+	sort.Slice(sets, func(i, j int) bool { return sets[i].Name < sets[j].Name })
+	c.JSON(http.StatusOK, gin.H{"descriptors": sets})
+}
+
+// UploadProtobufDescriptor 上传描述符集合，请求体为protoc --descriptor_set_out生成的二进制文件，
+// 也可以使用multipart表单的file字段上传。同名的集合会被替换
+func UploadProtobufDescriptor(c *gin.Context) {
+	name := c.Query("name")
+	if !descriptorSetNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name只能包含字母、数字、下划线、点和横线"})
+		return
+	}
+
+	var reader io.Reader = c.Request.Body
+	if file, _, err := c.Request.FormFile("file"); err == nil {
+		defer file.Close()
+		reader = file
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, int64(maxDescriptorSetSize)+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取描述符集合失败: " + err.Error()})
+		return
+	}
+	if len(data) > maxDescriptorSetSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "描述符集合过大"})
+		return
+	}
+
+	set, err := newProtobufDescriptorSet(name, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	set.UploadedAt = time.Now()
+
+	if err := saveProtobufDescriptor(name, data); err != nil {
+		util.Log.Logger.Error("保存描述符集合失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存描述符集合失败: " + err.Error()})
+		return
+	}
+	protobufDescriptors.mutex.Lock()
+	protobufDescriptors.sets[name] = set
+	protobufDescriptors.mutex.Unlock()
+
+	util.Log.Logger.Info("上传描述符集合: %s, 消息类型: %d, IP: %s", name, len(set.Messages), c.ClientIP())
+	c.JSON(http.StatusOK, set)
+}
+
+// DeleteProtobufDescriptor 删除描述符集合
+func DeleteProtobufDescriptor(c *gin.Context) {
+	name := c.Param("name")
+
+	protobufDescriptors.mutex.Lock()
+	_, ok := protobufDescriptors.sets[name]
+	delete(protobufDescriptors.sets, name)
+	protobufDescriptors.mutex.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "描述符集合不存在"})
+		return
+	}
+
+	if err := os.Remove(filepath.Join(protobufDescriptorDir, name+".pb")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		util.Log.Logger.Error("删除描述符集合文件失败: %v", err)
+	}
+	util.Log.Logger.Info("删除描述符集合: %s, IP: %s", name, c.ClientIP())
+	recordAudit(actorFromContext(c), AuditEntry{Action: auditActionDelete, Target: "descriptor:" + name})
+	c.JSON(http.StatusOK, gin.H{"message": "描述符集合已删除"})
+}
+
+// saveProtobufDescriptor 保存描述符集合文件，先写临时文件再重命名
+func saveProtobufDescriptor(name string, data []byte) error {
+	if err := os.MkdirAll(protobufDescriptorDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(protobufDescriptorDir, name+".pb")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
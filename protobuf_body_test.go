@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestDecodeProtobufFields(t *testing.T) {
+	var nested []byte
+	nested = protowire.AppendTag(nested, 1, protowire.VarintType)
+	nested = protowire.AppendVarint(nested, 7)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string // 字段序列化后的JSON
+		wantErr bool
+	}{
+		{name: "empty", data: nil, want: `[]`},
+		{
+			name: "scalars",
+			data: func() []byte {
+				var b []byte
+				b = protowire.AppendTag(b, 1, protowire.VarintType)
+				b = protowire.AppendVarint(b, 150)
+				b = protowire.AppendTag(b, 2, protowire.Fixed32Type)
+				b = protowire.AppendFixed32(b, 1)
+				b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+				b = protowire.AppendFixed64(b, 2)
+				return b
+			}(),
+			want: `[{"number":1,"wire_type":"varint","value":150},{"number":2,"wire_type":"fixed32","value":1},{"number":3,"wire_type":"fixed64","value":2}]`,
+		},
+		{
+			name: "string",
+			data: protowire.AppendString(protowire.AppendTag(nil, 4, protowire.BytesType), "hi\tthere"),
+			want: `[{"number":4,"wire_type":"bytes","value":"hi\tthere"}]`,
+		},
+		{
+			name: "nested message",
+			data: protowire.AppendBytes(protowire.AppendTag(nil, 5, protowire.BytesType), nested),
+			want: `[{"number":5,"wire_type":"bytes","value":[{"number":1,"wire_type":"varint","value":7}]}]`,
+		},
+		{
+			name: "binary falls back to base64",
+			data: protowire.AppendBytes(protowire.AppendTag(nil, 6, protowire.BytesType), []byte{0xff, 0x00}),
+			want: `[{"number":6,"wire_type":"bytes","value":{"base64":"/wA="}}]`,
+		},
+		{
+			name:    "truncated varint keeps earlier fields",
+			data:    append(protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1), 0x10, 0x80),
+			want:    `[{"number":1,"wire_type":"varint","value":1}]`,
+			wantErr: true,
+		},
+		{
+			name:    "group wire type",
+			data:    protowire.AppendTag(nil, 1, protowire.StartGroupType),
+			want:    `[]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := decodeProtobufFields(tt.data, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, _ := json.Marshal(fields)
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeProtobufBytesDepth(t *testing.T) {
+	// 超过最大深度的嵌套消息不再展开
+	data := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1)
+	for i := 0; i <= maxProtobufDepth; i++ {
+		data = protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), data)
+	}
+	value := decodeProtobufBytes(data, 0)
+	for depth := 0; ; depth++ {
+		fields, ok := value.([]protobufField)
+		if !ok {
+			if _, isBase64 := value.(gin.H); !isBase64 || depth != maxProtobufDepth {
+				t.Fatalf("stopped at depth %d with %T, want base64 at depth %d", depth, value, maxProtobufDepth)
+			}
+			return
+		}
+		value = fields[0].Value
+	}
+}
+
+func TestIsPrintableText(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"hello", true},
+		{"line\r\nbreak\ttab", true},
+		{"你好", true},
+		{"", true},
+		{"bell\x07", false},
+		{"del\x7f", false},
+		{"\xff", false},
+	}
+	for _, tt := range tests {
+		if got := isPrintableText([]byte(tt.data)); got != tt.want {
+			t.Errorf("isPrintableText(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeProtobufBodyWithDescriptor(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/user.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("id"), JsonName: proto.String("id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("name"), JsonName: proto.String("name"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		}},
+	}
+	setData, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := newProtobufDescriptorSet("test", setData)
+	if err != nil {
+		t.Fatalf("newProtobufDescriptorSet: %v", err)
+	}
+	if strings.Join(set.Messages, ",") != "test.User" {
+		t.Errorf("messages = %v", set.Messages)
+	}
+
+	protobufDescriptors.mutex.Lock()
+	protobufDescriptors.sets[set.Name] = set
+	protobufDescriptors.mutex.Unlock()
+	defer func() {
+		protobufDescriptors.mutex.Lock()
+		delete(protobufDescriptors.sets, set.Name)
+		protobufDescriptors.mutex.Unlock()
+	}()
+
+	var message []byte
+	message = protowire.AppendTag(message, 1, protowire.VarintType)
+	message = protowire.AppendVarint(message, 42)
+	message = protowire.AppendTag(message, 2, protowire.BytesType)
+	message = protowire.AppendString(message, "bob")
+
+	// 消息类型来自Content-Type的messageType参数
+	parsed := parseRequestBody(bodyPacket("application/x-protobuf; messageType=test.User", string(message)), bodyParseOptions{})
+	if parsed.Error != "" {
+		t.Fatalf("error: %s", parsed.Error)
+	}
+	if parsed.ProtobufMessage != "test.User" {
+		t.Errorf("message = %q", parsed.ProtobufMessage)
+	}
+	values, _ := queryJSONPath(parsed.JSON, "$.name")
+	if len(values) != 1 || values[0] != "bob" {
+		t.Errorf("name = %v", values)
+	}
+
+	// 选项中的消息类型优先，未知类型返回错误
+	parsed = parseRequestBody(bodyPacket("application/x-protobuf; messageType=test.User", string(message)), bodyParseOptions{ProtobufMessage: "test.Missing"})
+	if parsed.Error == "" {
+		t.Error("unknown message type: want error")
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// 脱敏方式：mask替换为固定文本，hash替换为HMAC-SHA256摘要，相同的值得到相同的摘要
+	redactionModeMask = "mask"
+	redactionModeHash = "hash"
+
+	// 自定义规则类型
+	redactionRuleRegex    = "regex"    // 正则表达式，作用于请求行、请求头、查询参数和文本内容
+	redactionRuleJSONPath = "jsonpath" // JSONPath，作用于JSON请求内容
+	redactionRuleHeader   = "header"   // 请求头名称，不区分大小写
+
+	redactedMask = "[REDACTED]"
+)
+
+// 内置规则的名称，记录在数据包的redactions中
+const (
+	redactionBuiltinAuthorization = "authorization"
+	redactionBuiltinCookie        = "cookie"
+	redactionBuiltinField         = "sensitive_field"
+	redactionBuiltinCard          = "credit_card"
+)
+
+// 内置规则脱敏的请求头，值为规则名称
+var builtinRedactedHeaders = map[string]string{
+	"authorization":       redactionBuiltinAuthorization,
+	"proxy-authorization": redactionBuiltinAuthorization,
+	"x-api-key":           redactionBuiltinAuthorization,
+	"x-auth-token":        redactionBuiltinAuthorization,
+	"cookie":              redactionBuiltinCookie,
+	"set-cookie":          redactionBuiltinCookie,
+}
+
+var (
+	// 常见的密码、令牌字段名，用于JSON字段、查询参数和表单字段
+	sensitiveFieldPattern = regexp.MustCompile(`(?i)password|passwd|secret|token|api[_-]?key|credential|^(pwd|pass|pin)$`)
+	// JSON中的"名称": 值，值为字符串、数字或布尔
+	jsonFieldPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"|-?\d[\d.eE+-]*|true|false)`)
+	// 查询字符串或表单中的名称=值
+	paramPattern = regexp.MustCompile(`(^|[?&;])([^=&?#;\s]+)=([^&#;\s]*)`)
+	// 13到19位的数字，可以用空格或横线分组，再用Luhn校验
+	cardNumberPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+)
+
+// hash方式使用的密钥，配置了redaction.hash_key或REDACTION_HASH_KEY环境变量时使用该值，否则每次启动随机生成，
+// 此时摘要只在同一次运行中可以关联
+var redactionHashKey = struct {
+	once sync.Once
+	key  []byte
+}{}
+
+// 脱敏配置，默认启用内置规则并以mask方式替换
+type RedactionConfig struct {
+	DisableBuiltin bool            `json:"disable_builtin"` // 关闭内置规则，只使用自定义规则
+	Mode           string          `json:"mode"`            // mask（默认）或hash
+	Rules          []RedactionRule `json:"rules"`           // 自定义规则
+}
+
+// 自定义脱敏规则
+type RedactionRule struct {
+	Name    string `json:"name"`    // 规则名称，为空时为rule<序号>
+	Type    string `json:"type"`    // regex、jsonpath或header
+	Pattern string `json:"pattern"` // 正则表达式有分组时只替换分组，否则替换整个匹配
+}
+
+type regexRedactionRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+type jsonPathRedactionRule struct {
+	name string
+	path string
+}
+
+// 编译后的脱敏规则，任务创建后不再修改，可以在多个解码协程中并发使用
+type redactor struct {
+	mode      string
+	builtin   bool
+	headers   map[string]string // 小写的请求头名称 -> 规则名称
+	regexes   []regexRedactionRule
+	jsonPaths []jsonPathRedactionRule
+}
+
+// newRedactor 校验并编译脱敏配置，配置无效时返回*fieldError
+func newRedactor(config RedactionConfig) (*redactor, error) {
+	r := &redactor{
+		mode:    config.Mode,
+		builtin: !config.DisableBuiltin,
+		headers: make(map[string]string),
+	}
+	switch r.mode {
+	case "":
+		r.mode = redactionModeMask
+	case redactionModeMask, redactionModeHash:
+	default:
+		return nil, &fieldError{Field: "redaction.mode", Code: fieldErrorUnsupported, Message: "不支持的脱敏方式: " + config.Mode, Value: config.Mode}
+	}
+	if r.builtin {
+		for name, rule := range builtinRedactedHeaders {
+			r.headers[name] = rule
+		}
+	}
+
+	for i, rule := range config.Rules {
+		name := rule.Name
+		if name == "" {
+			name = "rule" + strconv.Itoa(i+1)
+		}
+		field := "redaction.rules[" + strconv.Itoa(i) + "]"
+		if rule.Pattern == "" {
+			return nil, &fieldError{Field: field + ".pattern", Code: fieldErrorRequired, Message: "脱敏规则 " + name + " 缺少pattern"}
+		}
+		switch rule.Type {
+		case redactionRuleRegex:
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, &fieldError{Field: field + ".pattern", Code: fieldErrorInvalid, Message: fmt.Sprintf("脱敏规则 %s 的正则表达式无效: %v", name, err), Value: rule.Pattern}
+			}
+			r.regexes = append(r.regexes, regexRedactionRule{name: name, pattern: pattern})
+		case redactionRuleJSONPath:
+			if _, err := parseJSONPath(rule.Pattern); err != nil {
+				return nil, &fieldError{Field: field + ".pattern", Code: fieldErrorInvalid, Message: fmt.Sprintf("脱敏规则 %s 的JSONPath无效: %v", name, err), Value: rule.Pattern}
+			}
+			r.jsonPaths = append(r.jsonPaths, jsonPathRedactionRule{name: name, path: rule.Pattern})
+		case redactionRuleHeader:
+			r.headers[strings.ToLower(rule.Pattern)] = name
+		default:
+			return nil, &fieldError{Field: field + ".type", Code: fieldErrorUnsupported, Message: "脱敏规则 " + name + " 的类型无效: " + rule.Type, Value: rule.Type}
+		}
+	}
+	return r, nil
+}
+
+// 一次脱敏过程，记录命中的规则
+type redaction struct {
+	*redactor
+	applied map[string]bool
+}
+
+// redact 对数据包中的请求行、请求头、Cookie、查询参数和请求内容脱敏，在保存和广播之前调用。
+// redactor为nil时不做处理
+func (r *redactor) redact(packet *PacketInfo) {
+	if r == nil {
+		return
+	}
+	pass := &redaction{redactor: r, applied: make(map[string]bool)}
+
+	packet.RequestLine = pass.redactText(packet.RequestLine, true)
+	packet.Path = pass.redactText(packet.Path, true)
+	for name, values := range packet.Query {
+		for i, value := range values {
+			if pass.builtin && sensitiveFieldPattern.MatchString(name) {
+				values[i] = pass.replace(redactionBuiltinField, value)
+			} else {
+				values[i] = pass.redactText(value, false)
+			}
+		}
+	}
+
+	cookieRule, redactCookies := pass.headers["cookie"]
+	for i, header := range packet.Headers {
+		rule, ok := pass.headers[strings.ToLower(header.Name)]
+		switch {
+		case !ok:
+			packet.Headers[i].Value = pass.redactText(header.Value, false)
+		case strings.EqualFold(header.Name, "cookie"):
+			packet.Headers[i].Value = pass.redactCookieHeader(rule, header.Value, false)
+		case strings.EqualFold(header.Name, "set-cookie"):
+			packet.Headers[i].Value = pass.redactCookieHeader(rule, header.Value, true)
+		default:
+			packet.Headers[i].Value = pass.redactCredentials(rule, header.Value)
+		}
+	}
+	for i, cookie := range packet.Cookies {
+		if redactCookies {
+			packet.Cookies[i].Value = pass.replace(cookieRule, cookie.Value)
+		} else {
+			packet.Cookies[i].Value = pass.redactText(cookie.Value, false)
+		}
+	}
+
+	pass.redactBody(packet)
+
+	if len(pass.applied) > 0 {
+		packet.Redactions = make([]string, 0, len(pass.applied))
+		for name := range pass.applied {
+			packet.Redactions = append(packet.Redactions, name)
+		}
+		sort.Strings(packet.Redactions)
+	}
+}
+
+// replace 按脱敏方式生成替换值并记录命中的规则
+func (pass *redaction) replace(rule, value string) string {
+	pass.applied[rule] = true
+	if pass.mode == redactionModeHash {
+		return hashRedactedValue(value)
+	}
+	return redactedMask
+}
+
+// hashRedactedValue 计算值的HMAC-SHA256，取前16个十六进制字符
+func hashRedactedValue(value string) string {
+	redactionHashKey.once.Do(func() {
+		if key := appConfig.Redaction.HashKey; key != "" {
+			redactionHashKey.key = []byte(key)
+			return
+		}
+		redactionHashKey.key = make([]byte, 32)
+		if _, err := rand.Read(redactionHashKey.key); err != nil {
+			panic(err)
+		}
+	})
+	mac := hmac.New(sha256.New, redactionHashKey.key)
+	mac.Write([]byte(value))
+	return "[sha256:" + hex.EncodeToString(mac.Sum(nil))[:16] + "]"
+}
+
+// redactCredentials 替换认证类请求头的值，保留Bearer、Basic等认证方案
+func (pass *redaction) redactCredentials(rule, value string) string {
+	scheme, credentials, found := strings.Cut(strings.TrimSpace(value), " ")
+	if found && credentials != "" && !strings.ContainsAny(scheme, "=:;") {
+		return scheme + " " + pass.replace(rule, strings.TrimSpace(credentials))
+	}
+	return pass.replace(rule, value)
+}
+
+// redactCookieHeader 替换Cookie中各项的值，保留名称；setCookie为true时只替换第一项，Path等属性不变
+func (pass *redaction) redactCookieHeader(rule, value string, setCookie bool) string {
+	parts := strings.Split(value, ";")
+	for i, part := range parts {
+		name, cookieValue, found := strings.Cut(part, "=")
+		if !found || setCookie && i > 0 {
+			continue
+		}
+		parts[i] = name + "=" + pass.replace(rule, strings.TrimSpace(cookieValue))
+	}
+	return strings.Join(parts, ";")
+}
+
+// redactText 对文本应用卡号规则和自定义正则规则，params为true时同时替换敏感的查询参数
+func (pass *redaction) redactText(text string, params bool) string {
+	if text == "" {
+		return text
+	}
+	if pass.builtin {
+		if params {
+			text = pass.redactParams(text)
+		}
+		text = cardNumberPattern.ReplaceAllStringFunc(text, func(match string) string {
+			digits := strings.NewReplacer(" ", "", "-", "").Replace(match)
+			if !luhnValid(digits) {
+				return match
+			}
+			return pass.replace(redactionBuiltinCard, digits)
+		})
+	}
+	for _, rule := range pass.regexes {
+		text = pass.replaceRegex(rule, text)
+	}
+	return text
+}
+
+// redactParams 替换名称为密码、令牌等的查询参数或表单字段的值
+func (pass *redaction) redactParams(text string) string {
+	return replaceSubmatches(paramPattern, text, func(match []string) string {
+		if !sensitiveFieldPattern.MatchString(match[2]) || match[3] == "" {
+			return match[0]
+		}
+		return match[1] + match[2] + "=" + pass.replace(redactionBuiltinField, match[3])
+	})
+}
+
+// replaceRegex 替换正则表达式的匹配，有分组时只替换各分组
+func (pass *redaction) replaceRegex(rule regexRedactionRule, text string) string {
+	if rule.pattern.NumSubexp() == 0 {
+		return rule.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			return pass.replace(rule.name, match)
+		})
+	}
+
+	var output strings.Builder
+	last := 0
+	for _, loc := range rule.pattern.FindAllStringSubmatchIndex(text, -1) {
+		for group := 1; group*2 < len(loc); group++ {
+			start, end := loc[group*2], loc[group*2+1]
+			if start < last || start == end {
+				// 未参与匹配、为空或与前一个分组重叠的分组不替换
+				continue
+			}
+			output.WriteString(text[last:start])
+			output.WriteString(pass.replace(rule.name, text[start:end]))
+			last = end
+		}
+	}
+	output.WriteString(text[last:])
+	return output.String()
+}
+
+// replaceSubmatches 与ReplaceAllStringFunc相同，但回调可以得到各分组的内容
+func replaceSubmatches(pattern *regexp.Regexp, text string, replace func([]string) string) string {
+	var output strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringSubmatchIndex(text, -1) {
+		match := make([]string, len(loc)/2)
+		for i := range match {
+			if loc[i*2] >= 0 {
+				match[i] = text[loc[i*2]:loc[i*2+1]]
+			}
+		}
+		output.WriteString(text[last:loc[0]])
+		output.WriteString(replace(match))
+		last = loc[1]
+	}
+	output.WriteString(text[last:])
+	return output.String()
+}
+
+// redactBody 对请求内容脱敏：multipart按部分处理，其他内容只处理UTF-8文本，二进制内容不变。
+// 内容有分块或压缩编码时只能修改解码后的内容，原始内容被清空
+func (pass *redaction) redactBody(packet *PacketInfo) {
+	body := packet.Body
+	content := body.content()
+	if len(content) == 0 {
+		return
+	}
+
+	var redacted []byte
+	mediaType, params, _ := mime.ParseMediaType(packet.ContentType)
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		redacted = pass.redactMultipart(content, params["boundary"])
+	case utf8.Valid(content):
+		redacted = []byte(pass.redactContent(string(content), mediaType))
+	default:
+		return
+	}
+
+	if bytes.Equal(redacted, content) {
+		return
+	}
+	if len(body.Encodings) > 0 {
+		body.Decoded = redacted
+		body.DecodedSize = len(redacted)
+		body.Raw = nil
+	} else {
+		body.Raw = redacted
+	}
+	packet.Content = body.text()
+}
+
+// redactMultipart 按部分脱敏multipart内容，其他字节保持不变。
+// 名称为密码、令牌等的文本字段整体替换，其他文本部分按各自的Content-Type脱敏，文件和二进制部分不做处理
+func (pass *redaction) redactMultipart(content []byte, boundary string) []byte {
+	// 内容不完整时仍然处理已找到的部分
+	spans, _ := multipartSpans(content, boundary)
+	var output bytes.Buffer
+	last := 0
+	for _, span := range spans {
+		part := content[span.start:span.end]
+		if span.filename != "" || len(part) == 0 || !utf8.Valid(part) {
+			continue
+		}
+		var text string
+		if pass.builtin && sensitiveFieldPattern.MatchString(span.name) {
+			text = pass.replace(redactionBuiltinField, string(part))
+		} else {
+			mediaType, _, _ := mime.ParseMediaType(span.header.Get("Content-Type"))
+			text = pass.redactContent(string(part), mediaType)
+		}
+		output.Write(content[last:span.start])
+		output.WriteString(text)
+		last = span.end
+	}
+	if last == 0 {
+		return content
+	}
+	output.Write(content[last:])
+	return output.Bytes()
+}
+
+// redactContent 对文本内容应用内置的字段规则、卡号规则和自定义规则，mediaType决定是否按表单处理
+func (pass *redaction) redactContent(text, mediaType string) string {
+	if pass.builtin {
+		text = replaceSubmatches(jsonFieldPattern, text, func(match []string) string {
+			name, err := strconv.Unquote(`"` + match[1] + `"`)
+			if err != nil {
+				name = match[1]
+			}
+			if !sensitiveFieldPattern.MatchString(name) {
+				return match[0]
+			}
+			value := match[3]
+			if strings.HasPrefix(value, `"`) {
+				value = value[1 : len(value)-1]
+			}
+			return `"` + match[1] + `"` + match[2] + `"` + pass.replace(redactionBuiltinField, value) + `"`
+		})
+		if mediaType == "application/x-www-form-urlencoded" {
+			text = pass.redactParams(text)
+		}
+	}
+	text = pass.redactText(text, false)
+	return pass.redactJSONPaths(text)
+}
+
+// redactJSONPaths 应用JSONPath规则，有匹配时重新序列化JSON，对象的键按字母顺序输出
+func (pass *redaction) redactJSONPaths(text string) string {
+	if len(pass.jsonPaths) == 0 || !json.Valid([]byte(text)) {
+		return text
+	}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return text
+	}
+
+	total := 0
+	for _, rule := range pass.jsonPaths {
+		var count int
+		tree, count, _ = replaceJSONPath(tree, rule.path, func(value interface{}) interface{} {
+			if s, ok := value.(string); ok {
+				return pass.replace(rule.name, s)
+			}
+			// 对象、数组和数字按JSON文本计算摘要
+			encoded, _ := json.Marshal(value)
+			return pass.replace(rule.name, string(encoded))
+		})
+		total += count
+	}
+	if total == 0 {
+		return text
+	}
+
+	var output bytes.Buffer
+	encoder := json.NewEncoder(&output)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(tree); err != nil {
+		return text
+	}
+	return strings.TrimSuffix(output.String(), "\n")
+}
+
+// luhnValid 用Luhn算法校验卡号
+func luhnValid(digits string) bool {
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// redactedRequest 解析原始请求并按配置脱敏
+func redactedRequest(t *testing.T, config RedactionConfig, raw string) PacketInfo {
+	t.Helper()
+	r, err := newRedactor(config)
+	if err != nil {
+		t.Fatalf("newRedactor: %v", err)
+	}
+	var packet PacketInfo
+	parseHTTPPayload(&packet, raw, false)
+	r.redact(&packet)
+	return packet
+}
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"5500005555555559", true},
+		{"378282246310005", true},
+		{"4111111111111112", false},
+		{"411111111111", false},         // 少于13位
+		{"41111111111111111111", false}, // 多于19位
+		{"0000000000000", true},
+	}
+	for _, tt := range tests {
+		if got := luhnValid(tt.digits); got != tt.want {
+			t.Errorf("luhnValid(%q) = %v, want %v", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		redactions  []string
+	}{
+		{
+			name:        "json sensitive fields",
+			contentType: "application/json",
+			body:        `{"user":"bob","password":"hunter2","api_key": 12345,"nested":{"accessToken":true}}`,
+			want:        `{"user":"bob","password":"[REDACTED]","api_key": "[REDACTED]","nested":{"accessToken":"[REDACTED]"}}`,
+			redactions:  []string{redactionBuiltinField},
+		},
+		{
+			name:        "json escaped field name",
+			contentType: "application/json",
+			body:        `{"password":"x","note":"a \"token\" here"}`,
+			want:        `{"password":"[REDACTED]","note":"a \"token\" here"}`,
+			redactions:  []string{redactionBuiltinField},
+		},
+		{
+			name:        "json without sensitive fields",
+			contentType: "application/json",
+			body:        `{"user":"bob","count":3}`,
+			want:        `{"user":"bob","count":3}`,
+		},
+		{
+			name:        "form fields",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "user=bob&pwd=123&secret_answer=blue",
+			want:        "user=bob&pwd=[REDACTED]&secret_answer=[REDACTED]",
+			redactions:  []string{redactionBuiltinField},
+		},
+		{
+			name:        "card numbers need a valid checksum",
+			contentType: "text/plain",
+			body:        "card 4111 1111 1111 1111 order 4111111111111112",
+			want:        "card [REDACTED] order 4111111111111112",
+			redactions:  []string{redactionBuiltinCard},
+		},
+		{
+			name:        "multipart text parts",
+			contentType: "multipart/form-data; boundary=XYZ",
+			body: "--XYZ\r\nContent-Disposition: form-data; name=\"password\"\r\n\r\nhunter2\r\n" +
+				"--XYZ\r\nContent-Disposition: form-data; name=\"meta\"\r\nContent-Type: application/json\r\n\r\n{\"token\":\"abc\"}\r\n" +
+				"--XYZ\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.bin\"\r\n\r\n\xff\xfe4111111111111111\r\n" +
+				"--XYZ--\r\n",
+			want: "--XYZ\r\nContent-Disposition: form-data; name=\"password\"\r\n\r\n[REDACTED]\r\n" +
+				"--XYZ\r\nContent-Disposition: form-data; name=\"meta\"\r\nContent-Type: application/json\r\n\r\n{\"token\":\"[REDACTED]\"}\r\n" +
+				"--XYZ\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.bin\"\r\n\r\n\xff\xfe4111111111111111\r\n" +
+				"--XYZ--\r\n",
+			redactions: []string{redactionBuiltinField},
+		},
+		{
+			name:        "multipart cut off by the packet",
+			contentType: "multipart/form-data; boundary=XYZ",
+			body:        "--XYZ\r\nContent-Disposition: form-data; name=\"token\"\r\n\r\nabcdef",
+			want:        "--XYZ\r\nContent-Disposition: form-data; name=\"token\"\r\n\r\n[REDACTED]",
+			redactions:  []string{redactionBuiltinField},
+		},
+		{
+			name:        "binary body is left alone",
+			contentType: "application/octet-stream",
+			body:        "\xff\xfepassword=1",
+			want:        "\xff\xfepassword=1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := "POST /submit HTTP/1.1\r\nHost: example.com\r\nContent-Type: " + tt.contentType + "\r\n\r\n" + tt.body
+			packet := redactedRequest(t, RedactionConfig{}, raw)
+			if got := string(packet.Body.content()); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+			if strings.Join(packet.Redactions, ",") != strings.Join(tt.redactions, ",") {
+				t.Errorf("redactions = %v, want %v", packet.Redactions, tt.redactions)
+			}
+		})
+	}
+}
+
+func TestRedactCookies(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		cookies []string // 脱敏后Cookie各项的值
+	}{
+		{
+			name:    "cookie values",
+			header:  "Cookie: session=abc; theme=dark",
+			want:    "session=[REDACTED]; theme=[REDACTED]",
+			cookies: []string{redactedMask, redactedMask},
+		},
+		{
+			name:   "set-cookie keeps attributes",
+			header: "Set-Cookie: id=42; Path=/; HttpOnly",
+			want:   "id=[REDACTED]; Path=/; HttpOnly",
+		},
+		{
+			name:   "authorization keeps the scheme",
+			header: "Authorization: Bearer eyJhbGciOi",
+			want:   "Bearer [REDACTED]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := redactedRequest(t, RedactionConfig{}, "GET / HTTP/1.1\r\nHost: example.com\r\n"+tt.header+"\r\n\r\n")
+			if got := packet.Headers[1].Value; got != tt.want {
+				t.Errorf("header = %q, want %q", got, tt.want)
+			}
+			for i, want := range tt.cookies {
+				if got := packet.Cookies[i].Value; got != want {
+					t.Errorf("cookie %d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+
+	// 关闭内置规则后不处理Cookie
+	packet := redactedRequest(t, RedactionConfig{DisableBuiltin: true}, "GET / HTTP/1.1\r\nCookie: session=abc\r\n\r\n")
+	if got := packet.Headers[0].Value; got != "session=abc" {
+		t.Errorf("builtin disabled: header = %q", got)
+	}
+}
+
+func TestRedactHashMode(t *testing.T) {
+	hashPattern := regexp.MustCompile(`^\[sha256:[0-9a-f]{16}\]$`)
+	config := RedactionConfig{Mode: redactionModeHash}
+	raw := "GET /login?token=abc&user=bob HTTP/1.1\r\nAuthorization: Basic dXNlcjpwYXNz\r\n\r\n"
+
+	first := redactedRequest(t, config, raw)
+	second := redactedRequest(t, config, raw)
+	digest := first.Query["token"][0]
+	if !hashPattern.MatchString(digest) {
+		t.Fatalf("token = %q, want a sha256 digest", digest)
+	}
+	// 相同的值得到相同的摘要，可以跨请求关联
+	if second.Query["token"][0] != digest {
+		t.Errorf("digest differs between packets: %q vs %q", digest, second.Query["token"][0])
+	}
+	if first.Query["user"][0] != "bob" {
+		t.Errorf("user = %q, want bob", first.Query["user"][0])
+	}
+	if !strings.Contains(first.Path, "token="+digest) {
+		t.Errorf("path = %q, want the digest in place of the token", first.Path)
+	}
+	auth := strings.TrimPrefix(first.Headers[0].Value, "Basic ")
+	if !hashPattern.MatchString(auth) || auth == digest {
+		t.Errorf("authorization = %q", first.Headers[0].Value)
+	}
+}
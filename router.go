@@ -2,16 +2,18 @@ package main
 
 import (
 	"net/http"
-	"path/filepath"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRouter 配置所有路由
 func SetupRouter() *gin.Engine {
-	// 创建gin引擎
-	router := gin.Default()
+	// 创建gin引擎，访问日志中隐藏查询参数里的令牌
+	router := gin.New()
+	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{Formatter: accessLogFormatter}), gin.Recovery())
 	gin.SetMode(gin.DebugMode)
+	// 不信任任何代理，ClientIP使用连接的对端地址，避免通过X-Forwarded-For冒充本机请求
+	router.SetTrustedProxies(nil)
 
 	// API路由
 	setupApiRoutes(router)
@@ -22,34 +24,88 @@ func SetupRouter() *gin.Engine {
 	return router
 }
 
-// setupApiRoutes 配置API路由
+// setupApiRoutes 配置API路由，按角色分组：viewer只能查看，operator可以控制抓包，admin可以管理设置
 func setupApiRoutes(router *gin.Engine) {
+	// 登录不需要认证
+	router.POST("/auth/login", Login)
+
+	viewer := router.Group("/", requireRole(roleViewer))
+	operator := router.Group("/", requireRole(roleOperator))
+	admin := router.Group("/", requireRole(roleAdmin))
+
+	// 当前身份
+	viewer.GET("/auth/me", GetCurrentIdentity)
+	viewer.POST("/auth/logout", Logout)
+
 	// 设备列表接口
-	router.GET("/devices", ListDevices)
+	viewer.GET("/devices", ListDevices)
 
 	// 抓包任务相关路由
-	router.POST("/capture/start", StartCapture)
-	router.POST("/capture/stop", StopCapture)
+	operator.POST("/capture/start", StartCapture)
+	// 校验抓包配置并返回填入默认值后的配置，不启动任务
+	viewer.POST("/capture/validate", ValidateCaptureConfig)
+	operator.POST("/capture/stop", StopCapture)
+	operator.POST("/capture/pause", PauseCapture)
+	operator.POST("/capture/resume", ResumeCapture)
+
+	viewer.GET("/capture/results", GetCaptureResults)
+	viewer.GET("/capture/export", ExportCaptureResults)
+	viewer.GET("/capture/current", GetCurrentRunningTask)
+	viewer.GET("/capture/stats", GetCaptureStats)
+	viewer.GET("/capture/body", GetPacketBody)
+	viewer.GET("/capture/body/raw", DownloadPacketBody)
+	viewer.GET("/capture/body/hexdump", GetPacketBodyHexdump)
+
+	// protobuf描述符集合
+	viewer.GET("/protobuf/descriptors", ListProtobufDescriptors)
+	admin.POST("/protobuf/descriptors", UploadProtobufDescriptor)
+	admin.DELETE("/protobuf/descriptors/:name", DeleteProtobufDescriptor)
+
+	// 抓包权限诊断
+	viewer.GET("/permissions", GetPermissionStatus)
+
+	// 预触发缓冲与快照
+	viewer.GET("/buffers", ListBuffers)
+	operator.POST("/buffers", StartBuffer)
+	operator.DELETE("/buffers/:device", StopBuffer)
+	operator.POST("/capture/snapshot", CreateSnapshot)
+
+	// 计划抓包任务
+	viewer.GET("/schedules", ListSchedules)
+	admin.POST("/schedules", CreateSchedule)
+	admin.PUT("/schedules/:id", UpdateSchedule)
+	admin.DELETE("/schedules/:id", DeleteSchedule)
+
+	// 触发器
+	viewer.GET("/triggers", ListTriggers)
+	admin.POST("/triggers", CreateTrigger)
+	admin.PUT("/triggers/:id", UpdateTrigger)
+	admin.DELETE("/triggers/:id", DeleteTrigger)
+
+	// 审计日志
+	admin.GET("/audit", GetAuditLog)
 
-	router.GET("/capture/results", GetCaptureResults)
-	router.GET("/capture/current", GetCurrentRunningTask)
+	// 当前生效的配置，令牌和密钥已隐藏
+	admin.GET("/config", GetAppConfig)
 
-	// WebSocket连接
-	router.GET("/ws/capture", WebSocketHandler)
+	// WebSocket连接，控制指令需要operator角色
+	viewer.GET("/ws/capture", WebSocketHandler)
+	// Server-Sent Events推送，供无法使用WebSocket的环境
+	viewer.GET("/sse/capture", SSEHandler)
 
 	// 系统信息相关路由
-	router.GET("/local-ip", getLocalIpHandler)
+	viewer.GET("/local-ip", getLocalIpHandler)
 }
 
 // setupStaticRoutes 配置静态文件路由
 func setupStaticRoutes(router *gin.Engine) {
 	// 托管静态文件目录
-	router.StaticFS("/static", http.Dir(filepath.Join(RootDir(), "static")))
+	router.StaticFS("/static", http.Dir(appConfig.StaticDir))
 
 	// 获取index.html路径
 	staticIndexPath := GetStaticIndexPath()
 
-	// 配置根路径路由，确保访问http://127.0.0.1:8081时能自动跳转到index.html
+	// 配置根路径路由，确保访问http://127.0.0.1:8081（默认监听地址）时能自动跳转到index.html
 	router.GET("/", func(c *gin.Context) {
 		c.File(staticIndexPath)
 	})
@@ -32,12 +32,12 @@ chmod +x "$APP_PATH"
 echo "正在启动HTTP数据包捕获工具..."
 echo "----------------------------------"
 echo "访问以下地址打开Web界面:"
-echo "  - http://localhost:8080"
+echo "  - http://localhost:8081（默认监听地址，可通过config.yaml或-listen参数修改）"
 echo "  - 或者通过服务器的IP地址访问（启动后会显示）"
 echo "----------------------------------"
 
-# 启动应用程序 - 在output目录中运行以确保正确加载静态文件
-cd "$OUTPUT_DIR" && STATIC_DIR="." ./$APP_NAME
+# 启动应用程序 - 在output目录中运行，配置文件、data和log目录都相对于该目录，额外的参数传给应用程序
+cd "$OUTPUT_DIR" && ./$APP_NAME "$@"
 
 # 如果应用程序意外退出，显示信息
 if [ $? -ne 0 ]; then
@@ -45,7 +45,7 @@ if [ $? -ne 0 ]; then
     echo "应用程序意外退出。"
     echo "可能的原因:"
     echo "1. 需要管理员/root权限来捕获网络数据包"
-    echo "2. 端口8080已被占用"
+    echo "2. 监听端口（默认8081）已被占用"
     echo "3. 缺少必要的依赖"
     echo "----------------------------------"
     exit 1
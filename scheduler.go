@@ -0,0 +1,296 @@
+package main
+
+import (
+	"abc/a/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 计划任务和触发器的持久化文件
+const schedulerStorePath = "data/schedules.json"
+
+// 计划抓包任务，按cron表达式定时启动抓包并在指定时长后自动停止
+type Schedule struct {
+	ID       string        `json:"id"`
+	Name     string        `json:"name"`
+	Cron     string        `json:"cron" binding:"required"` // 5段cron表达式：分 时 日 月 周，如"0 2 * * *"
+	Duration int           `json:"duration"`                // 每次抓包时长（秒），为0时使用config.max_duration
+	Enabled  bool          `json:"enabled"`
+	Config   CaptureConfig `json:"config"`
+
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastTaskID string     `json:"last_task_id,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// 持久化文件内容
+type schedulerStore struct {
+	Schedules []*Schedule `json:"schedules"`
+	Triggers  []*Trigger  `json:"triggers"`
+}
+
+// 计划任务调度器，同时管理触发器的监听协程
+var scheduler = struct {
+	mutex     sync.Mutex
+	schedules map[string]*Schedule
+	triggers  map[string]*Trigger
+	watchers  map[string]*triggerWatcher
+}{
+	schedules: make(map[string]*Schedule),
+	triggers:  make(map[string]*Trigger),
+	watchers:  make(map[string]*triggerWatcher),
+}
+
+// StartScheduler 加载已保存的计划任务和触发器，并启动调度协程
+func StartScheduler() {
+	store, err := loadSchedulerStore()
+	if err != nil {
+		util.Log.Logger.Error("加载计划任务失败: %v", err)
+	}
+
+	scheduler.mutex.Lock()
+	for _, schedule := range store.Schedules {
+		scheduler.schedules[schedule.ID] = schedule
+		updateNextRun(schedule, time.Now())
+	}
+	for _, trigger := range store.Triggers {
+		scheduler.triggers[trigger.ID] = trigger
+	}
+	scheduler.mutex.Unlock()
+
+	for _, trigger := range store.Triggers {
+		startTriggerWatcher(trigger.ID)
+	}
+
+	util.Log.Logger.Info("调度器已启动，计划任务: %d, 触发器: %d", len(store.Schedules), len(store.Triggers))
+	go runScheduleLoop()
+}
+
+// runScheduleLoop 每分钟检查一次需要执行的计划任务
+func runScheduleLoop() {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(next.Sub(now))
+
+		minute := time.Now().Truncate(time.Minute)
+		scheduler.mutex.Lock()
+		var due []*Schedule
+		for _, schedule := range scheduler.schedules {
+			if !schedule.Enabled {
+				continue
+			}
+			spec, err := parseCron(schedule.Cron)
+			if err == nil && spec.matches(minute) {
+				due = append(due, schedule)
+			}
+		}
+		scheduler.mutex.Unlock()
+
+		for _, schedule := range due {
+			go runSchedule(schedule.ID)
+		}
+	}
+}
+
+// runSchedule 启动计划任务对应的抓包，并记录执行结果
+func runSchedule(id string) {
+	scheduler.mutex.Lock()
+	schedule, ok := scheduler.schedules[id]
+	if !ok {
+		scheduler.mutex.Unlock()
+		return
+	}
+	config := schedule.Config
+	if schedule.Duration > 0 {
+		config.MaxDuration = schedule.Duration
+	}
+	origin := taskOrigin{Type: "schedule", ID: schedule.ID, Name: schedule.Name}
+	scheduler.mutex.Unlock()
+
+	util.Log.Logger.Info("执行计划抓包任务: %s (%s)", origin.Name, origin.ID)
+	task, err := startCaptureTask(config, "", origin)
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	now := time.Now()
+	schedule.LastRunAt = &now
+	schedule.LastError = ""
+	if err != nil {
+		util.Log.Logger.Error("计划抓包任务启动失败: %s, 错误: %v", schedule.ID, err)
+		schedule.LastError = err.Error()
+	} else {
+		schedule.LastTaskID = task.id
+	}
+	updateNextRun(schedule, now)
+	saveSchedulerStoreLocked()
+}
+
+// updateNextRun 计算计划任务的下次执行时间
+func updateNextRun(schedule *Schedule, after time.Time) {
+	schedule.NextRunAt = nil
+	if !schedule.Enabled {
+		return
+	}
+	spec, err := parseCron(schedule.Cron)
+	if err != nil {
+		return
+	}
+	if next := spec.next(after); !next.IsZero() {
+		schedule.NextRunAt = &next
+	}
+}
+
+// loadSchedulerStore 读取持久化文件，文件不存在时返回空内容
+func loadSchedulerStore() (schedulerStore, error) {
+	var store schedulerStore
+	data, err := os.ReadFile(schedulerStorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return store, err
+	}
+	err = json.Unmarshal(data, &store)
+	return store, err
+}
+
+// saveSchedulerStoreLocked 将计划任务和触发器写入持久化文件，调用方需持有scheduler.mutex
+func saveSchedulerStoreLocked() {
+	store := schedulerStore{Schedules: make([]*Schedule, 0), Triggers: make([]*Trigger, 0)}
+	for _, schedule := range scheduler.schedules {
+		store.Schedules = append(store.Schedules, schedule)
+	}
+	for _, trigger := range scheduler.triggers {
+		store.Triggers = append(store.Triggers, trigger)
+	}
+
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		util.Log.Logger.Error("计划任务序列化失败: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(schedulerStorePath), 0755); err != nil {
+		util.Log.Logger.Error("创建计划任务目录失败: %v", err)
+		return
+	}
+	// 先写临时文件再重命名，避免写入中断导致文件损坏
+	tmpPath := schedulerStorePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		util.Log.Logger.Error("保存计划任务失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, schedulerStorePath); err != nil {
+		util.Log.Logger.Error("保存计划任务失败: %v", err)
+	}
+}
+
+// cron表达式解析结果，每个字段用位图表示允许的取值
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// 日和周是否为*，两者都有限制时满足其一即可（与标准cron一致）
+	domAny, dowAny bool
+}
+
+// parseCron 解析5段cron表达式，支持*、数字、范围a-b、列表a,b和步长*/n
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron表达式需要5个字段（分 时 日 月 周）: %q", expr)
+	}
+
+	spec := &cronSpec{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	ranges := []struct {
+		target   *uint64
+		min, max int
+	}{
+		{&spec.minute, 0, 59},
+		{&spec.hour, 0, 23},
+		{&spec.dom, 1, 31},
+		{&spec.month, 1, 12},
+		{&spec.dow, 0, 7},
+	}
+	for i, r := range ranges {
+		bits, err := parseCronField(fields[i], r.min, r.max)
+		if err != nil {
+			return nil, fmt.Errorf("cron表达式第%d个字段无效: %v", i+1, err)
+		}
+		*r.target = bits
+	}
+	// 周日既可以写0也可以写7
+	if spec.dow&(1<<7) != 0 {
+		spec.dow |= 1
+	}
+	return spec, nil
+}
+
+// parseCronField 解析cron的单个字段
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if index := strings.Index(part, "/"); index >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[index+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("无效的步长 %q", part)
+			}
+			part = part[:index]
+		}
+
+		low, high := min, max
+		if part != "*" {
+			var err error
+			if index := strings.Index(part, "-"); index >= 0 {
+				if low, err = strconv.Atoi(part[:index]); err == nil {
+					high, err = strconv.Atoi(part[index+1:])
+				}
+			} else if low, err = strconv.Atoi(part); err == nil && step == 1 {
+				high = low
+			}
+			if err != nil {
+				return 0, fmt.Errorf("无效的取值 %q", part)
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("取值 %q 超出范围 %d-%d", part, min, max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matches 判断时间是否满足cron表达式（精确到分钟）
+func (s *cronSpec) matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if !s.domAny && !s.dowAny {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// next 返回after之后第一个满足cron表达式的时间，一年内没有满足的时间时返回零值
+func (s *cronSpec) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(1, 0, 1); t.Before(end); t = t.Add(time.Minute) {
+		if s.matches(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
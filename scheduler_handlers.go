@@ -0,0 +1,273 @@
+package main
+
+import (
+	"abc/a/util"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// ListSchedules 列出所有计划抓包任务
+func ListSchedules(c *gin.Context) {
+	scheduler.mutex.Lock()
+	schedules := make([]Schedule, 0, len(scheduler.schedules))
+	for _, schedule := range scheduler.schedules {
+		schedules = append(schedules, *schedule)
+	}
+	scheduler.mutex.Unlock()
+
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID < schedules[j].ID })
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+// CreateSchedule 创建计划抓包任务
+func CreateSchedule(c *gin.Context) {
+	var schedule Schedule
+	if !bindSchedule(c, &schedule) {
+		return
+	}
+	schedule.ID = "sched_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	scheduler.mutex.Lock()
+	updateNextRun(&schedule, time.Now())
+	scheduler.schedules[schedule.ID] = &schedule
+	saveSchedulerStoreLocked()
+	response := schedule
+	scheduler.mutex.Unlock()
+
+	util.Log.Logger.Info("创建计划抓包任务: %s, cron: %s, IP: %s", schedule.ID, schedule.Cron, c.ClientIP())
+	recordAudit(actorFromContext(c), scheduleAuditEntry(auditActionCreate, response))
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateSchedule 修改计划抓包任务，保留执行记录
+func UpdateSchedule(c *gin.Context) {
+	var update Schedule
+	if !bindSchedule(c, &update) {
+		return
+	}
+
+	scheduler.mutex.Lock()
+	schedule, ok := scheduler.schedules[c.Param("id")]
+	if !ok {
+		scheduler.mutex.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "计划任务不存在"})
+		return
+	}
+	schedule.Name = update.Name
+	schedule.Cron = update.Cron
+	schedule.Duration = update.Duration
+	schedule.Enabled = update.Enabled
+	schedule.Config = update.Config
+	updateNextRun(schedule, time.Now())
+	saveSchedulerStoreLocked()
+	response := *schedule
+	scheduler.mutex.Unlock()
+
+	util.Log.Logger.Info("修改计划抓包任务: %s, IP: %s", response.ID, c.ClientIP())
+	recordAudit(actorFromContext(c), scheduleAuditEntry(auditActionUpdate, response))
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteSchedule 删除计划抓包任务
+func DeleteSchedule(c *gin.Context) {
+	id := c.Param("id")
+
+	scheduler.mutex.Lock()
+	_, ok := scheduler.schedules[id]
+	if ok {
+		delete(scheduler.schedules, id)
+		saveSchedulerStoreLocked()
+	}
+	scheduler.mutex.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "计划任务不存在"})
+		return
+	}
+	util.Log.Logger.Info("删除计划抓包任务: %s, IP: %s", id, c.ClientIP())
+	recordAudit(actorFromContext(c), AuditEntry{Action: auditActionDelete, Target: "schedule:" + id})
+	c.JSON(http.StatusOK, gin.H{"message": "计划任务已删除", "id": id})
+}
+
+// scheduleAuditEntry 返回创建或修改计划任务的审计记录，detail为cron表达式和是否启用
+func scheduleAuditEntry(action string, schedule Schedule) AuditEntry {
+	return AuditEntry{
+		Action: action,
+		Target: "schedule:" + schedule.ID,
+		Config: &schedule.Config,
+		Detail: fmt.Sprintf("cron: %s, enabled: %v", schedule.Cron, schedule.Enabled),
+	}
+}
+
+// bindSchedule 绑定并校验计划任务参数，失败时已写入响应
+func bindSchedule(c *gin.Context, schedule *Schedule) bool {
+	if err := c.ShouldBindJSON(schedule); err != nil {
+		util.Log.Logger.Error("参数绑定失败: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if _, err := parseCron(schedule.Cron); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if schedule.Duration < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration不能为负数"})
+		return false
+	}
+	return validateStoredCaptureConfig(c, schedule.Config)
+}
+
+// ListTriggers 列出所有触发器
+func ListTriggers(c *gin.Context) {
+	scheduler.mutex.Lock()
+	triggers := make([]gin.H, 0, len(scheduler.triggers))
+	for _, trigger := range scheduler.triggers {
+		_, watching := scheduler.watchers[trigger.ID]
+		triggers = append(triggers, gin.H{"trigger": *trigger, "watching": watching})
+	}
+	scheduler.mutex.Unlock()
+
+	sort.Slice(triggers, func(i, j int) bool {
+		return triggers[i]["trigger"].(Trigger).ID < triggers[j]["trigger"].(Trigger).ID
+	})
+	c.JSON(http.StatusOK, gin.H{"triggers": triggers})
+}
+
+// CreateTrigger 创建触发器，启用时立即开始监听
+func CreateTrigger(c *gin.Context) {
+	var trigger Trigger
+	if !bindTrigger(c, &trigger) {
+		return
+	}
+	trigger.ID = "trig_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	scheduler.mutex.Lock()
+	scheduler.triggers[trigger.ID] = &trigger
+	saveSchedulerStoreLocked()
+	scheduler.mutex.Unlock()
+
+	startTriggerWatcher(trigger.ID)
+	scheduler.mutex.Lock()
+	response := trigger
+	scheduler.mutex.Unlock()
+
+	util.Log.Logger.Info("创建触发器: %s, 设备: %s, IP: %s", trigger.ID, trigger.DeviceName, c.ClientIP())
+	recordAudit(actorFromContext(c), triggerAuditEntry(auditActionCreate, response))
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateTrigger 修改触发器并按新的配置重新监听
+func UpdateTrigger(c *gin.Context) {
+	var update Trigger
+	if !bindTrigger(c, &update) {
+		return
+	}
+
+	scheduler.mutex.Lock()
+	trigger, ok := scheduler.triggers[c.Param("id")]
+	if !ok {
+		scheduler.mutex.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "触发器不存在"})
+		return
+	}
+	stopTriggerWatcherLocked(trigger.ID)
+	trigger.Name = update.Name
+	trigger.DeviceName = update.DeviceName
+	trigger.Condition = update.Condition
+	trigger.Duration = update.Duration
+	trigger.Cooldown = update.Cooldown
+	trigger.PreTrigger = update.PreTrigger
+	trigger.Enabled = update.Enabled
+	trigger.Config = update.Config
+	trigger.LastError = ""
+	saveSchedulerStoreLocked()
+	scheduler.mutex.Unlock()
+
+	startTriggerWatcher(trigger.ID)
+	scheduler.mutex.Lock()
+	response := *trigger
+	scheduler.mutex.Unlock()
+
+	util.Log.Logger.Info("修改触发器: %s, IP: %s", response.ID, c.ClientIP())
+	recordAudit(actorFromContext(c), triggerAuditEntry(auditActionUpdate, response))
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteTrigger 删除触发器并停止监听
+func DeleteTrigger(c *gin.Context) {
+	id := c.Param("id")
+
+	scheduler.mutex.Lock()
+	_, ok := scheduler.triggers[id]
+	if ok {
+		stopTriggerWatcherLocked(id)
+		delete(scheduler.triggers, id)
+		saveSchedulerStoreLocked()
+	}
+	scheduler.mutex.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "触发器不存在"})
+		return
+	}
+	util.Log.Logger.Info("删除触发器: %s, IP: %s", id, c.ClientIP())
+	recordAudit(actorFromContext(c), AuditEntry{Action: auditActionDelete, Target: "trigger:" + id})
+	c.JSON(http.StatusOK, gin.H{"message": "触发器已删除", "id": id})
+}
+
+// triggerAuditEntry 返回创建或修改触发器的审计记录，detail为监听网卡和是否启用
+func triggerAuditEntry(action string, trigger Trigger) AuditEntry {
+	return AuditEntry{
+		Action: action,
+		Target: "trigger:" + trigger.ID,
+		Config: &trigger.Config,
+		Detail: fmt.Sprintf("device: %s, enabled: %v", trigger.DeviceName, trigger.Enabled),
+	}
+}
+
+// bindTrigger 绑定并校验触发器参数，失败时已写入响应。
+// 抓包配置的device_name可以省略，此时使用监听网卡，因此先补全再校验
+func bindTrigger(c *gin.Context, trigger *Trigger) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(trigger); err != nil {
+		util.Log.Logger.Error("参数绑定失败: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if trigger.Config.DeviceName == "" && len(trigger.Config.DeviceNames) == 0 {
+		trigger.Config.DeviceName = trigger.DeviceName
+	}
+	if err := binding.Validator.ValidateStruct(trigger); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if !trigger.Condition.isValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "至少需要设置一个触发条件（status_min或request）"})
+		return false
+	}
+	if trigger.Duration < 0 || trigger.Cooldown < 0 || trigger.PreTrigger < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration、cooldown和pre_trigger不能为负数"})
+		return false
+	}
+	return validateStoredCaptureConfig(c, trigger.Config)
+}
+
+// validateStoredCaptureConfig 校验计划任务和触发器中的抓包配置，失败时已写入响应。
+// 保存的是原始配置，默认值在启动任务时填入，修改配置的默认值后对已有计划任务同样生效
+func validateStoredCaptureConfig(c *gin.Context, config CaptureConfig) bool {
+	errs := normalizeCaptureConfig(&config)
+	if len(errs) == 0 {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "抓包配置无效: " + errs[0].Message,
+		"errors": prefixFieldErrors("config.", errs),
+	})
+	return false
+}
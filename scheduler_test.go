@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "empty", expr: ""},
+		{name: "four fields", expr: "* * * *"},
+		{name: "six fields", expr: "* * * * * *"},
+		{name: "minute out of range", expr: "60 * * * *"},
+		{name: "hour out of range", expr: "* 24 * * *"},
+		{name: "day of month zero", expr: "* * 0 * *"},
+		{name: "month out of range", expr: "* * * 13 *"},
+		{name: "day of week out of range", expr: "* * * * 8"},
+		{name: "zero step", expr: "*/0 * * * *"},
+		{name: "negative step", expr: "*/-5 * * * *"},
+		{name: "reversed range", expr: "5-1 * * * *"},
+		{name: "not a number", expr: "a * * * *"},
+		{name: "bad range end", expr: "1-x * * * *"},
+		{name: "empty list item", expr: "1,,2 * * * *"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseCron(tt.expr); err == nil {
+				t.Errorf("parseCron(%q) 应返回错误", tt.expr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-01 是周一
+	after := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		expr string
+		want time.Time
+	}{
+		{name: "every minute", expr: "* * * * *", want: time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{name: "top of the hour", expr: "0 * * * *", want: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{name: "list", expr: "0,30 * * * *", want: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{name: "step within hour range", expr: "*/15 9-17 * * *", want: time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{name: "step from a start value", expr: "5/20 * * * *", want: time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{name: "first day of month", expr: "0 0 1 * *", want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "weekdays", expr: "0 9 * * 1-5", want: time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{name: "sunday as 0", expr: "0 9 * * 0", want: time.Date(2024, 1, 7, 9, 0, 0, 0, time.UTC)},
+		{name: "sunday as 7", expr: "0 9 * * 7", want: time.Date(2024, 1, 7, 9, 0, 0, 0, time.UTC)},
+		{name: "day of month or day of week", expr: "0 0 13 * 5", want: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{name: "current minute is skipped", expr: "30 10 1 1 *", want: time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{name: "never matches", expr: "0 0 31 2 *"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron(%q) 失败: %v", tt.expr, err)
+			}
+			if got := spec.next(after); !got.Equal(tt.want) {
+				t.Errorf("下次执行时间为 %v，应为 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateNextRun(t *testing.T) {
+	after := time.Date(2024, 1, 1, 10, 30, 20, 0, time.UTC)
+
+	schedule := &Schedule{Cron: "0 * * * *", Enabled: true}
+	updateNextRun(schedule, after)
+	if want := time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC); schedule.NextRunAt == nil || !schedule.NextRunAt.Equal(want) {
+		t.Errorf("启用时 NextRunAt 为 %v，应为 %v", schedule.NextRunAt, want)
+	}
+
+	// 禁用或表达式无效时清空下次执行时间
+	schedule.Enabled = false
+	updateNextRun(schedule, after)
+	if schedule.NextRunAt != nil {
+		t.Errorf("禁用时 NextRunAt 应为nil，实际为 %v", schedule.NextRunAt)
+	}
+	schedule = &Schedule{Cron: "bad", Enabled: true}
+	updateNextRun(schedule, after)
+	if schedule.NextRunAt != nil {
+		t.Errorf("表达式无效时 NextRunAt 应为nil，实际为 %v", schedule.NextRunAt)
+	}
+}
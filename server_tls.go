@@ -0,0 +1,204 @@
+package main
+
+import (
+	"abc/a/util"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// 自动生成的自签名证书和私钥
+	selfSignedCertPath = "data/tls/server.crt"
+	selfSignedKeyPath  = "data/tls/server.key"
+	// 自签名证书的有效期
+	selfSignedValidity = 825 * 24 * time.Hour
+)
+
+// 客户端证书校验方式
+const (
+	clientAuthRequire       = "require"         // 必须提供由client_ca_file签发的证书
+	clientAuthVerifyIfGiven = "verify_if_given" // 提供了证书时校验，没有证书的客户端仍可连接
+)
+
+// HTTPS配置
+type tlsSettings struct {
+	Enabled  bool   `json:"enabled" yaml:"enabled" toml:"enabled"`
+	CertFile string `json:"cert_file" yaml:"cert_file" toml:"cert_file"` // PEM格式的证书链
+	KeyFile  string `json:"key_file" yaml:"key_file" toml:"key_file"`    // PEM格式的私钥
+	// 证书文件不存在时生成自签名证书，cert_file和key_file为空时保存在data/tls下
+	SelfSigned bool     `json:"self_signed" yaml:"self_signed" toml:"self_signed"`
+	Hosts      []string `json:"hosts" yaml:"hosts" toml:"hosts"` // 自签名证书的域名和IP，默认为localhost、127.0.0.1和本机IP
+
+	ClientCAFile string `json:"client_ca_file" yaml:"client_ca_file" toml:"client_ca_file"` // 设置后校验API客户端的证书（mTLS）
+	ClientAuth   string `json:"client_auth" yaml:"client_auth" toml:"client_auth"`          // require（默认）或verify_if_given
+}
+
+// loadServerTLSConfig 按配置文件中的tls返回HTTPS配置，未启用时返回nil
+func loadServerTLSConfig() (*tls.Config, error) {
+	if !appConfig.TLS.Enabled {
+		return nil, nil
+	}
+	return newServerTLSConfig(appConfig.TLS)
+}
+
+// newServerTLSConfig 加载证书并按配置开启客户端证书校验
+func newServerTLSConfig(settings tlsSettings) (*tls.Config, error) {
+	if settings.SelfSigned {
+		if settings.CertFile == "" && settings.KeyFile == "" {
+			settings.CertFile, settings.KeyFile = selfSignedCertPath, selfSignedKeyPath
+		}
+		if err := ensureSelfSignedCertificate(settings.CertFile, settings.KeyFile, settings.Hosts); err != nil {
+			return nil, fmt.Errorf("生成自签名证书失败: %v", err)
+		}
+	}
+	if settings.CertFile == "" || settings.KeyFile == "" {
+		return nil, errors.New("启用HTTPS时需要设置cert_file和key_file，或开启self_signed")
+	}
+	certificate, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载证书失败: %v", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if leaf, err := x509.ParseCertificate(certificate.Certificate[0]); err == nil {
+		fingerprint := sha256.Sum256(leaf.Raw)
+		util.Log.Logger.Info("HTTPS证书: %s, 有效期至: %s, SHA-256指纹: %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.DateOnly), hex.EncodeToString(fingerprint[:]))
+	}
+
+	if settings.ClientCAFile == "" {
+		return config, nil
+	}
+	caData, err := os.ReadFile(settings.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取客户端CA证书失败: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("客户端CA证书中没有有效的PEM证书: %s", settings.ClientCAFile)
+	}
+	config.ClientCAs = pool
+	switch settings.ClientAuth {
+	case "", clientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	case clientAuthVerifyIfGiven:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("不支持的客户端证书校验方式: %s", settings.ClientAuth)
+	}
+	util.Log.Logger.Info("已开启客户端证书校验，方式: %s, CA: %s", config.ClientAuth, settings.ClientCAFile)
+	return config, nil
+}
+
+// ensureSelfSignedCertificate 证书和私钥文件都不存在时生成ECDSA P-256自签名证书，都存在时不做处理。
+// 只缺少其中一个时返回错误，不覆盖已有的文件，避免证书与私钥不匹配或替换掉用户自己的证书
+func ensureSelfSignedCertificate(certFile, keyFile string, hosts []string) error {
+	certExists, err := fileExists(certFile)
+	if err != nil {
+		return err
+	}
+	keyExists, err := fileExists(keyFile)
+	if err != nil {
+		return err
+	}
+	switch {
+	case certExists && keyExists:
+		return nil
+	case certExists:
+		return fmt.Errorf("证书文件%s存在但私钥文件%s不存在，请补全私钥或删除证书后重新生成", certFile, keyFile)
+	case keyExists:
+		return fmt.Errorf("私钥文件%s存在但证书文件%s不存在，请补全证书或删除私钥后重新生成", keyFile, certFile)
+	}
+
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+		if localIP := util.GetLocalIP(); localIP != "" {
+			hosts = append(hosts, localIP)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"packet-capture-tool"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	// 私钥只有当前用户可以读取
+	if err := writePEMFile(keyFile, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return err
+	}
+	if err := writePEMFile(certFile, "CERTIFICATE", der, 0644); err != nil {
+		return err
+	}
+	util.Log.Logger.Info("已生成自签名证书: %s, 域名和IP: %v", certFile, hosts)
+	return nil
+}
+
+// fileExists 判断文件是否存在，无法判断时返回错误
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// writePEMFile 写入PEM文件，先写临时文件再重命名
+func writePEMFile(path, blockType string, der []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureSelfSignedCertificate(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string // 预先存在的文件
+		wantErr  bool
+	}{
+		{name: "both missing"},
+		{name: "both present", existing: []string{"server.crt", "server.key"}},
+		{name: "key missing", existing: []string{"server.crt"}, wantErr: true},
+		{name: "cert missing", existing: []string{"server.key"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certFile := filepath.Join(dir, "server.crt")
+			keyFile := filepath.Join(dir, "server.key")
+			for _, name := range tt.existing {
+				writeTestFile(t, filepath.Join(dir, name), "existing")
+			}
+
+			err := ensureSelfSignedCertificate(certFile, keyFile, []string{"localhost"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// 已有的文件不能被覆盖，只缺少一个文件时也不能生成另一个
+			for _, name := range tt.existing {
+				if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != "existing" {
+					t.Errorf("%s was overwritten", name)
+				}
+			}
+			if tt.wantErr {
+				if entries, _ := os.ReadDir(dir); len(entries) != len(tt.existing) {
+					t.Errorf("files = %d, want %d", len(entries), len(tt.existing))
+				}
+			}
+			if len(tt.existing) == 0 {
+				if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+					t.Errorf("generated key pair is invalid: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"abc/a/util"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SSE心跳周期，避免代理因连接空闲而断开
+	sseHeartbeatPeriod = 15 * time.Second
+	// 单条事件写超时
+	sseWriteWait = 10 * time.Second
+	// 建议浏览器断线后的重连间隔（毫秒）
+	sseRetryMillis = 3000
+)
+
+// SSEHandler 以Server-Sent Events推送new_packet和task_update事件，作为WebSocket的替代。
+// 查询参数与/ws/capture相同；请求头Last-Event-ID（或查询参数last_event_id）
+// 用于断线后从任务已存储的数据包中补发
+func SSEHandler(c *gin.Context) {
+	subscription, replay, err := subscriptionFromQuery(c)
+	if err != nil {
+		util.Log.Logger.Error("SSE参数绑定失败: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if subscription == nil {
+		subscription = &clientSubscription{}
+	}
+
+	// 解析断线前收到的最后一个事件ID，格式为"任务ID:序号"，优先于last/since_seq参数
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	if lastEventID != "" {
+		taskID, seq, ok := parseEventID(lastEventID)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的Last-Event-ID: " + lastEventID})
+			return
+		}
+		if subscription.TaskID == "" || subscription.TaskID == taskID {
+			subscription.TaskID = taskID
+			replay = &replayOptions{SinceSeq: seq}
+		}
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	connID := "sse:" + c.ClientIP() + ":" + c.Request.RemoteAddr
+	client := newHubClient(connID)
+	sendCurrentTaskStatus(client)
+	replayed := hub.subscribe(client, subscription, replay)
+	defer hub.unregister(client)
+	recordReplay(actorFromContext(c), "sse", subscription.TaskID, replayed)
+
+	util.Log.Logger.Info("SSE连接已建立: %s, 任务ID: %s, 补发数据包: %d, IP: %s", connID, subscription.TaskID, replayed, c.ClientIP())
+
+	controller := http.NewResponseController(c.Writer)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", sseRetryMillis)
+
+	ticker := time.NewTicker(sseHeartbeatPeriod)
+	defer ticker.Stop()
+
+	queue, _ := hub.queue(client)
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			util.Log.Logger.Info("SSE连接已关闭: %s, IP: %s", connID, c.ClientIP())
+			return
+		case msg, ok := <-queue:
+			if !ok {
+				// 补发时队列被替换则继续消费新队列，已注销时退出
+				var registered bool
+				if queue, registered = hub.queue(client); !registered {
+					return
+				}
+				continue
+			}
+			controller.SetWriteDeadline(time.Now().Add(sseWriteWait))
+			if err := writeSSEEvent(c, msg); err != nil {
+				util.Log.Logger.Error("SSE消息发送失败 (%s): %v", connID, err)
+				return
+			}
+		case <-ticker.C:
+			controller.SetWriteDeadline(time.Now().Add(sseWriteWait))
+			if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+				util.Log.Logger.Error("SSE心跳发送失败 (%s): %v", connID, err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeSSEEvent 按SSE格式写出一条事件并立即刷新
+func writeSSEEvent(c *gin.Context, msg outboundMessage) error {
+	var builder strings.Builder
+	if msg.id != "" {
+		builder.WriteString("id: " + msg.id + "\n")
+	}
+	if msg.event != "" {
+		builder.WriteString("event: " + msg.event + "\n")
+	}
+	builder.WriteString("data: ")
+	builder.Write(msg.data)
+	builder.WriteString("\n\n")
+
+	if _, err := c.Writer.WriteString(builder.String()); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// parseEventID 解析"任务ID:序号"格式的事件ID
+func parseEventID(eventID string) (string, uint64, bool) {
+	index := strings.LastIndex(eventID, ":")
+	if index <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(eventID[index+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return eventID[:index], seq, true
+}
@@ -4,21 +4,13 @@ import (
 	"abc/a/util"
 	"os"
 	"path/filepath"
-	"runtime"
 )
 
-// GetStaticIndexPath 获取index.html文件的路径
+// GetStaticIndexPath 获取配置的静态文件目录下index.html的路径
 func GetStaticIndexPath() string {
-	staticIndexPath := filepath.Join(RootDir(), "static", "index.html")
+	staticIndexPath := filepath.Join(appConfig.StaticDir, "index.html")
 	if _, err := os.Stat(staticIndexPath); err != nil {
-		util.Log.Logger.Warn("未找到static/index.html，将使用根目录下的index.html: %v", err)
-		staticIndexPath = filepath.Join(RootDir(), "index.html")
+		util.Log.Logger.Warn("未找到index.html，请通过static_dir配置静态文件目录: %v", err)
 	}
 	return staticIndexPath
 }
-
-// RootDir 获取当前根目录
-func RootDir() string {
-	_, f, _, _ := runtime.Caller(0) // 返回当前源文件绝对路径
-	return filepath.Dir(f)
-}
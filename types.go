@@ -2,24 +2,57 @@ package main
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/google/gopacket/pcap"
 )
 
 // 抓包任务配置
 type CaptureConfig struct {
-	DeviceName     string   `json:"device_name" binding:"required"`
+	DeviceName     string   `json:"device_name"`     // 与device_names至少设置一个
+	DeviceNames    []string `json:"device_names"`    // 同时抓取多个网卡，设置后忽略device_name；Linux上可使用"any"
 	Protocols      []string `json:"protocols"`       // 支持的协议列表，如["http"]
 	PathFilter     string   `json:"path_filter"`     // URL路径过滤
 	ContainsFilter string   `json:"contains_filter"` // 内容包含过滤
-	SnapshotLen    int32    `json:"snapshot_len" default:"1024"`
-	Promiscuous    bool     `json:"promiscuous" default:"false"`
-	Timeout        int      `json:"timeout" default:"30"` // 秒
+	SnapshotLen    int32    `json:"snapshot_len"`    // 为0时使用配置的默认值，默认1024
+	Promiscuous    bool     `json:"promiscuous"`
+	Timeout        int      `json:"timeout"` // 秒，为0时使用配置的默认值，默认30
+
+	// 抓包后端，pcap（默认）或afpacket（仅Linux）
+	Backend       string `json:"backend"`
+	FanoutWorkers int    `json:"fanout_workers"` // afpacket每个网卡的socket数量，大于1时通过fanout分担流量
+	RingSizeMB    int    `json:"ring_size_mb"`   // afpacket每个socket的环形缓冲区大小（MB），默认64
+	DecodeWorkers int    `json:"decode_workers"` // 并行解码的协程数量，默认与CPU数量相同
+
+	// 自动停止条件，为0或false时不限制
+	MaxDuration      int   `json:"max_duration"`        // 最长抓包时间（秒）
+	MaxRequests      int   `json:"max_requests"`        // 最多匹配的请求数
+	MaxBytes         int64 `json:"max_bytes"`           // 最多读取的原始数据包字节数，暂停期间不计入
+	StopOnFirstMatch bool  `json:"stop_on_first_match"` // 匹配到第一个请求后停止
+
+	// 敏感数据脱敏，在保存和广播之前应用，默认启用内置规则
+	Redaction RedactionConfig `json:"redaction"`
+}
+
+// devices 返回需要抓包的网卡列表，设置了device_names时使用device_names，并去除重复
+func (config CaptureConfig) devices() []string {
+	if len(config.DeviceNames) == 0 {
+		return []string{config.DeviceName}
+	}
+	devices := make([]string, 0, len(config.DeviceNames))
+	seen := make(map[string]bool)
+	for _, device := range config.DeviceNames {
+		if device != "" && !seen[device] {
+			seen[device] = true
+			devices = append(devices, device)
+		}
+	}
+	return devices
 }
 
 // 抓包结果
 type PacketInfo struct {
+	Seq         uint64    `json:"seq"`       // 任务内递增的序号，从1开始
+	Interface   string    `json:"interface"` // 捕获该数据包的网卡
 	Timestamp   time.Time `json:"timestamp"`
 	SourceIP    string    `json:"source_ip"`
 	DestIP      string    `json:"dest_ip"`
@@ -27,16 +60,78 @@ type PacketInfo struct {
 	DestPort    int       `json:"dest_port"`
 	Protocol    string    `json:"protocol"`
 	Host        string    `json:"host"`
-	Path        string    `json:"path"`
+	Path        string    `json:"path"` // 请求目标，包含查询字符串；响应为对应请求的请求目标
 	RequestLine string    `json:"request_line"`
-	Content     string    `json:"content"`
+	Content     string    `json:"content"` // 消息内容，有分块或压缩编码时为解码后的内容；不是UTF-8文本时为空
+
+	// 消息方向，request或response。响应只在同一连接上的请求已保存时保存，
+	// method、path和host为对应请求的取值
+	Direction  string `json:"direction"`
+	StatusCode int    `json:"status_code,omitempty"` // 响应状态码
+	StatusLine string `json:"status_line,omitempty"` // 响应状态行，如"HTTP/1.1 200 OK"
+
+	Method        string              `json:"method"`
+	HTTPVersion   string              `json:"http_version"`
+	Query         map[string][]string `json:"query,omitempty"`   // 解析后的查询参数
+	Headers       []HTTPHeader        `json:"headers"`           // 按原始顺序和大小写保存的消息头
+	Cookies       []HTTPCookie        `json:"cookies,omitempty"` // Cookie请求头中的各项
+	ContentType   string              `json:"content_type,omitempty"`
+	ContentLength int64               `json:"content_length"`       // Content-Length消息头，没有时为-1
+	Body          *HTTPBody           `json:"body,omitempty"`       // 原始内容和解码后的内容，没有内容时省略
+	Redactions    []string            `json:"redactions,omitempty"` // 命中的脱敏规则名称
+
+	// 按Content-Type解析的内容，只在查询结果时指定parse_body=true才会填充
+	ParsedBody *ParsedBody `json:"parsed_body,omitempty"`
+}
+
+// 数据包过滤条件，所有非空字段需同时满足
+type PacketFilter struct {
+	Method    string `json:"method" form:"method"`       // 请求方法，如GET，不区分大小写
+	Host      string `json:"host" form:"host"`           // 域名包含
+	Path      string `json:"path" form:"path"`           // URL路径包含
+	SourceIP  string `json:"source_ip" form:"source_ip"` // 源IP精确匹配
+	DestIP    string `json:"dest_ip" form:"dest_ip"`     // 目标IP精确匹配
+	Port      int    `json:"port" form:"port"`           // 源端口或目标端口
+	Contains  string `json:"contains" form:"contains"`   // 请求行、状态行或内容包含
+	Interface string `json:"interface" form:"interface"` // 捕获的网卡
+}
+
+// 抓包任务来源
+type taskOrigin struct {
+	Type string `json:"type"`           // manual / schedule / trigger
+	ID   string `json:"id,omitempty"`   // 计划任务或触发器ID
+	Name string `json:"name,omitempty"` // 计划任务或触发器名称
+	User string `json:"user,omitempty"` // 手动启动或快照时为请求的用户
+	Role string `json:"role,omitempty"`
+}
+
+// manualOrigin 返回手动启动的任务来源
+func manualOrigin(identity authIdentity) taskOrigin {
+	return taskOrigin{Type: "manual", User: identity.Name, Role: identity.Role}
 }
 
 // 抓包任务结构体
 type captureTask struct {
+	id        string
+	origin    taskOrigin
 	config    CaptureConfig
 	packets   []PacketInfo
 	packetsMu sync.Mutex
-	handle    *pcap.Handle
+	lastSeq   uint64          // 最近一个数据包的序号，由packetsMu保护
+	handles   []captureHandle // 任务打开的网卡，由TaskMutex保护，停止时取出并全部关闭
 	running   bool
+	paused    bool      // 暂停时网卡保持打开，但丢弃所有数据包
+	redactor  *redactor // 由config.Redaction编译的脱敏规则，创建任务后不再修改
+
+	// 以下字段由TaskMutex保护
+	startedAt     time.Time
+	stoppedAt     time.Time
+	stopReason    string      // 停止原因，任务运行中为空
+	durationTimer *time.Timer // max_duration计时器
+	// 停止时网卡的最终统计，网卡关闭后无法再读取
+	finalSourceStats []interfaceStats
+
+	matchedRequests atomic.Int64 // 累计匹配的请求数，清空结果不影响
+	capturedBytes   atomic.Int64 // 累计读取的原始数据包字节数
+	counters        taskCounters // 数据包处理计数
 }
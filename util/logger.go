@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -18,6 +19,9 @@ const (
 	FATAL
 )
 
+// DefaultLogDir 默认的日志目录，相对于工作目录
+const DefaultLogDir = "log"
+
 // Logger 结构体用于日志记录
 type Logger struct {
 	Level         LogLevel
@@ -28,16 +32,9 @@ type Logger struct {
 
 // NewLogger 创建一个新的Logger实例
 func NewLogger(level LogLevel, consoleOutput bool, fileOutput bool, logFilePath string) *Logger {
-	// 如果需要文件输出但文件路径为空，使用默认路径
+	// 如果需要文件输出但文件路径为空，使用默认目录
 	if fileOutput && logFilePath == "" {
-		// 确保日志目录存在
-		logDir := "../log"
-		if _, err := os.Stat(logDir); os.IsNotExist(err) {
-			os.MkdirAll(logDir, 0755)
-		}
-		// 生成日期格式的日志文件名
-		currentDate := time.Now().Format("2006-01-02")
-		logFilePath = filepath.Join(logDir, fmt.Sprintf("app-%s.log", currentDate))
+		logFilePath = LogFilePath(DefaultLogDir)
 	}
 
 	return &Logger{
@@ -48,10 +45,31 @@ func NewLogger(level LogLevel, consoleOutput bool, fileOutput bool, logFilePath
 	}
 }
 
+// LogFilePath 返回日志目录下当天的日志文件路径，目录不存在时创建
+func LogFilePath(logDir string) string {
+	if _, err := os.Stat(logDir); os.IsNotExist(err) {
+		os.MkdirAll(logDir, 0755)
+	}
+	// 生成日期格式的日志文件名
+	currentDate := time.Now().Format("2006-01-02")
+	return filepath.Join(logDir, fmt.Sprintf("app-%s.log", currentDate))
+}
+
 // 日志级别对应的字符串
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
 func (l *Logger) levelString(level LogLevel) string {
-	levels := []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
-	return levels[level]
+	return levelNames[level]
+}
+
+// ParseLogLevel 解析日志级别名称，不区分大小写
+func ParseLogLevel(name string) (LogLevel, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return LogLevel(i), nil
+		}
+	}
+	return INFO, fmt.Errorf("无效的日志级别: %s", name)
 }
 
 // 写入日志
@@ -117,9 +135,18 @@ type Logging struct {
 
 var Log *Logging
 
-// InitLogger 初始化全局日志实例
+// InitLogger 初始化全局日志实例，加载配置前只输出到控制台
 func InitLogger() {
 	Log = &Logging{
-		Logger: NewLogger(INFO, true, true, ""), // 默认日志级别为INFO，同时输出到控制台和文件
+		Logger: NewLogger(INFO, true, false, ""),
+	}
+}
+
+// ConfigureLogger 按配置替换全局日志实例，应在启动其他协程之前调用
+func ConfigureLogger(level LogLevel, consoleOutput bool, fileOutput bool, logDir string) {
+	logFilePath := ""
+	if fileOutput {
+		logFilePath = LogFilePath(logDir)
 	}
+	Log.Logger = NewLogger(level, consoleOutput, fileOutput, logFilePath)
 }
@@ -4,34 +4,49 @@ import (
 	"abc/a/util"
 	"encoding/json"
 	"net/http"
-	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+const (
+	// 单条消息写超时
+	wsWriteWait = 10 * time.Second
+	// 等待客户端pong的超时，超时后视为连接已断开
+	wsPongWait = 60 * time.Second
+	// 发送ping的周期，必须小于wsPongWait
+	wsPingPeriod = wsPongWait * 9 / 10
+	// 客户端消息最大长度
+	wsMaxMessageSize = 64 * 1024
+)
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// 允许所有来源，在生产环境中应该根据需要限制
-		return true
-	},
+	// 只允许同源和allowed_origins中的来源，见auth.go
+	CheckOrigin: checkWebSocketOrigin,
 }
 
-// WebSocket连接管理器
-var wsConnections = struct {
-	connections map[string]*websocket.Conn
-	mutex       sync.Mutex
-}{}
-
-// 初始化WebSocket连接管理器
-func init() {
-	wsConnections.connections = make(map[string]*websocket.Conn)
+// 客户端发送的消息
+type wsClientMessage struct {
+	Type   string         `json:"type"` // subscribe / unsubscribe / command
+	TaskID string         `json:"task_id"`
+	Filter *PacketFilter  `json:"filter"`
+	Replay *replayOptions `json:"replay"` // 订阅时先补发历史数据包
+	wsCommand
 }
 
-// WebSocketHandler 处理WebSocket连接
+// WebSocketHandler 处理WebSocket连接。
+// 查询参数task_id与PacketFilter各字段指定初始订阅条件，last或since_seq指定连接时补发的历史数据包
 func WebSocketHandler(c *gin.Context) {
+	subscription, replay, err := subscriptionFromQuery(c)
+	if err != nil {
+		util.Log.Logger.Error("WebSocket参数绑定失败: %v, IP: %s", err, c.ClientIP())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 将HTTP连接升级为WebSocket连接
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -39,114 +54,153 @@ func WebSocketHandler(c *gin.Context) {
 		return
 	}
 
-	defer conn.Close()
-
-	// 生成连接ID
+	// 生成连接ID，先放入当前任务状态，再注册到推送中心并补发历史数据包，之后才是实时消息
 	connID := c.ClientIP() + ":" + c.Request.RemoteAddr
+	client := newHubClient(connID)
+	client.identity = requestIdentity(c)
+	sendCurrentTaskStatus(client)
+	replayed := hub.subscribe(client, subscription, replay)
+	if subscription != nil {
+		recordReplay(actorFromContext(c), "websocket", subscription.TaskID, replayed)
+	}
 
-	// 添加连接到管理器
-	wsConnections.mutex.Lock()
-	wsConnections.connections[connID] = conn
-	wsConnections.mutex.Unlock()
-
-	util.Log.Logger.Info("WebSocket连接已建立: %s, IP: %s", connID, c.ClientIP())
+	util.Log.Logger.Info("WebSocket连接已建立: %s, 补发数据包: %d, IP: %s", connID, replayed, c.ClientIP())
 
-	// 发送当前任务状态
-	sendCurrentTaskStatus(conn)
+	// 启动写协程，所有发往该连接的消息都由它按顺序写出
+	go wsWritePump(conn, client)
 
 	// 处理从客户端接收的消息
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
 	for {
-		// 读取消息类型，不需要实际处理消息内容
-		_, _, err := conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			util.Log.Logger.Error("WebSocket连接读取失败: %v, 连接ID: %s, IP: %s", err, connID, c.ClientIP())
 			break
 		}
+		handleClientMessage(client, c.RemoteIP(), message)
 	}
 
-	// 从管理器中移除连接
-	wsConnections.mutex.Lock()
-	delete(wsConnections.connections, connID)
-	wsConnections.mutex.Unlock()
+	// 从推送中心移除连接，写协程会在队列关闭后关闭连接
+	hub.unregister(client)
 
 	util.Log.Logger.Info("WebSocket连接已关闭: %s, IP: %s", connID, c.ClientIP())
 }
 
+// wsWritePump 消费客户端发送队列并定期发送ping保活
+func wsWritePump(conn *websocket.Conn, client *hubClient) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	queue, _ := hub.queue(client)
+	for {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				// 补发时队列被替换，继续消费新队列
+				var registered bool
+				if queue, registered = hub.queue(client); registered {
+					continue
+				}
+				// 已注销，通知客户端关闭连接
+				conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, msg.data); err != nil {
+				util.Log.Logger.Error("WebSocket消息发送失败 (%s): %v", client.id, err)
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				util.Log.Logger.Error("WebSocket ping发送失败 (%s): %v", client.id, err)
+				return
+			}
+		}
+	}
+}
+
+// 处理客户端发送的消息
+func handleClientMessage(client *hubClient, clientIP string, message []byte) {
+	var msg wsClientMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		util.Log.Logger.Warn("无法解析WebSocket消息: %v, 连接ID: %s", err, client.id)
+		hub.sendTo(client, gin.H{"type": "error", "error": "无法解析消息: " + err.Error()})
+		return
+	}
+
+	switch msg.Type {
+	case "subscribe":
+		subscription := &clientSubscription{TaskID: msg.TaskID, Filter: msg.Filter}
+		replayed := hub.subscribe(client, subscription, msg.Replay)
+		recordReplay(identityActor(client.identity, clientIP), "websocket", subscription.TaskID, replayed)
+
+		util.Log.Logger.Info("WebSocket客户端更新订阅，连接ID: %s, 任务ID: %s, 补发数据包: %d", client.id, msg.TaskID, replayed)
+		hub.sendTo(client, gin.H{
+			"type":     "subscribed",
+			"task_id":  subscription.TaskID,
+			"filter":   subscription.Filter,
+			"replayed": replayed,
+		})
+	case "unsubscribe":
+		hub.subscribe(client, nil, nil)
+
+		util.Log.Logger.Info("WebSocket客户端取消订阅，连接ID: %s", client.id)
+		hub.sendTo(client, gin.H{"type": "unsubscribed"})
+	case "command":
+		msg.wsCommand.TaskID = msg.TaskID
+		handleCommand(client, clientIP, msg.wsCommand)
+	default:
+		hub.sendTo(client, gin.H{"type": "error", "error": "不支持的消息类型: " + msg.Type})
+	}
+}
+
 // 发送当前任务状态
-func sendCurrentTaskStatus(conn *websocket.Conn) {
+func sendCurrentTaskStatus(client *hubClient) {
 	TaskMutex.Lock()
-	defer TaskMutex.Unlock()
-
 	response := gin.H{"type": "task_status"}
 
 	if CurrentTask != nil && CurrentTask.running {
+		response["task_id"] = CurrentTask.id
 		response["running"] = true
+		response["paused"] = CurrentTask.paused
 		response["config"] = CurrentTask.config
 	} else {
 		response["running"] = false
 	}
+	TaskMutex.Unlock()
 
-	jsonData, err := json.Marshal(response)
-	if err != nil {
-		util.Log.Logger.Error("JSON序列化失败: %v", err)
-		return
-	}
-
-	err = conn.WriteMessage(websocket.TextMessage, jsonData)
-	if err != nil {
-		util.Log.Logger.Error("WebSocket消息发送失败: %v", err)
-	}
+	hub.sendTo(client, response)
 }
 
-// 向所有连接的客户端广播新的数据包
-func BroadcastNewPacket(packet PacketInfo) {
-	wsConnections.mutex.Lock()
-	defer wsConnections.mutex.Unlock()
-
-	response := gin.H{
-		"type":   "new_packet",
-		"packet": packet,
+// BroadcastNewPacket 向订阅了该任务且满足过滤条件的客户端广播新的数据包。
+// 只做非阻塞入队，调用方应在抓包协程中同步调用以保证消息顺序；没有客户端需要时不序列化
+func BroadcastNewPacket(taskID string, packet PacketInfo) {
+	wants := func(client *hubClient) bool {
+		return client.subscription.wants(taskID, packet)
 	}
-
-	jsonData, err := json.Marshal(response)
-	if err != nil {
-		util.Log.Logger.Error("JSON序列化失败: %v", err)
+	if !hub.hasClient(wants) {
 		return
 	}
-
-	// 向所有连接发送消息
-	for connID, conn := range wsConnections.connections {
-		err := conn.WriteMessage(websocket.TextMessage, jsonData)
-		if err != nil {
-			util.Log.Logger.Error("WebSocket消息发送失败 (%s): %v", connID, err)
-			// 移除不可用的连接
-			conn.Close()
-			delete(wsConnections.connections, connID)
-		}
+	msg, ok := newPacketMessage(taskID, packet)
+	if !ok {
+		return
 	}
+	hub.broadcast(msg, wants)
 }
 
-// 向所有连接的客户端广播任务状态更新
+// BroadcastTaskStatus 向所有连接的客户端广播任务状态更新
 func BroadcastTaskStatus(update gin.H) {
-	wsConnections.mutex.Lock()
-	defer wsConnections.mutex.Unlock()
-
 	update["type"] = "task_update"
-
-	jsonData, err := json.Marshal(update)
-	if err != nil {
-		util.Log.Logger.Error("JSON序列化失败: %v", err)
-		return
-	}
-
-	// 向所有连接发送消息
-	for connID, conn := range wsConnections.connections {
-		err := conn.WriteMessage(websocket.TextMessage, jsonData)
-		if err != nil {
-			util.Log.Logger.Error("WebSocket消息发送失败 (%s): %v", connID, err)
-			// 移除不可用的连接
-			conn.Close()
-			delete(wsConnections.connections, connID)
-		}
+	if msg, ok := newOutboundMessage(update); ok {
+		hub.broadcast(msg, nil)
 	}
 }
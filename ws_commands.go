@@ -0,0 +1,101 @@
+package main
+
+import (
+	"abc/a/util"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebSocket控制指令，客户端通过 {"type": "command"} 消息发送
+type wsCommand struct {
+	RequestID     string               `json:"request_id"` // 客户端生成的请求ID，原样返回在ack中
+	Action        string               `json:"action"`     // start / stop / pause / resume / clear / set_filter
+	Config        *CaptureConfig       `json:"config"`     // start使用
+	TaskID        string               `json:"-"`          // stop使用，取自消息的task_id，为空时停止当前任务
+	CaptureFilter *captureFilterUpdate `json:"capture_filter"`
+}
+
+// handleCommand 执行客户端发送的控制指令，并通过ack消息返回执行结果
+func handleCommand(client *hubClient, clientIP string, cmd wsCommand) {
+	util.Log.Logger.Info("收到WebSocket控制指令: %s, 请求ID: %s, 连接ID: %s", cmd.Action, cmd.RequestID, client.id)
+
+	var result gin.H
+	var err error
+	if roleAllows(client.identity.Role, roleOperator) {
+		result, err = executeCommand(client, clientIP, cmd)
+	} else {
+		err = &captureError{status: http.StatusForbidden, message: "需要" + roleOperator + "角色"}
+	}
+
+	ack := gin.H{
+		"type":       "ack",
+		"request_id": cmd.RequestID,
+		"action":     cmd.Action,
+		"ok":         err == nil,
+	}
+	if err != nil {
+		util.Log.Logger.Warn("WebSocket控制指令执行失败: %s, 错误: %v, 连接ID: %s", cmd.Action, err, client.id)
+		ack["error"] = err.Error()
+		if ce, ok := err.(*captureError); ok {
+			ack["status"] = ce.status
+			if ce.hint != "" {
+				ack["hint"] = ce.hint
+			}
+			if ce.details != nil {
+				ack["details"] = ce.details
+			}
+			if len(ce.fields) > 0 {
+				ack["errors"] = ce.fields
+			}
+		}
+	} else {
+		ack["result"] = result
+	}
+	hub.sendTo(client, ack)
+}
+
+// executeCommand 根据指令类型调用对应的抓包任务操作
+func executeCommand(client *hubClient, clientIP string, cmd wsCommand) (gin.H, error) {
+	actor := identityActor(client.identity, clientIP)
+	switch cmd.Action {
+	case "start":
+		if cmd.Config == nil {
+			return nil, &captureError{status: http.StatusBadRequest, message: "缺少抓包配置config"}
+		}
+		task, err := startCaptureTask(*cmd.Config, clientIP, manualOrigin(client.identity))
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"task_id": task.id, "config": task.config}, nil
+	case "stop":
+		task, capturedPackets, err := stopCaptureTask(actor, cmd.TaskID)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"task_id": task.id, "captured_packets": capturedPackets}, nil
+	case "pause", "resume":
+		task, err := setCapturePaused(cmd.Action == "pause")
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"task_id": task.id, "paused": cmd.Action == "pause"}, nil
+	case "clear":
+		task, cleared, err := clearCapturePackets(actor)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"task_id": task.id, "cleared": cleared}, nil
+	case "set_filter":
+		if cmd.CaptureFilter == nil {
+			return nil, &captureError{status: http.StatusBadRequest, message: "缺少过滤条件capture_filter"}
+		}
+		task, config, err := updateCaptureFilter(*cmd.CaptureFilter)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"task_id": task.id, "config": config}, nil
+	default:
+		return nil, &captureError{status: http.StatusBadRequest, message: "不支持的指令: " + cmd.Action}
+	}
+}